@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LapsAttributes holds the names of the ldap attributes read for each
+// computer. The defaults depend on LAPS_MODE and can be overridden by
+// LDAP_ATTR_* for directories with a non-standard LAPS schema.
+type LapsAttributes struct {
+	Mode              string // LAPS_MODE the LAPS attributes belong to
+	Name              string
+	DNSHostName       string
+	SAMAccountName    string
+	ObjectGUID        string
+	Password          string
+	Expiration        string
+	EncryptedPassword string // empty if LAPS_DECRYPT is disabled
+	PasswordHistory   string // empty if LAPS_SYNC_HISTORY is disabled
+	// LAPS attributes of the other LAPS_MODE, only set with LAPS_FALLBACK
+	Fallback *LapsAttributes
+	// Optional attributes, only requested if the related feature is enabled
+	UserAccountControl string
+	LastLogonTimestamp string
+	PwdLastSet         string
+	// Computer info
+	Description            string
+	OperatingSystem        string
+	OperatingSystemVersion string
+	WhenCreated            string
+	// Additional attributes of OP_ITEM_TEMPLATE
+	Extra []string
+}
+
+// lapsModeAttributes returns the default LAPS attribute names of lapsMode
+func lapsModeAttributes(lapsMode string) LapsAttributes {
+	attrs := LapsAttributes{Mode: lapsMode}
+	if lapsMode == lapsModeWindows {
+		attrs.Password = "msLAPS-Password"
+		attrs.Expiration = "msLAPS-PasswordExpirationTime"
+		if getEnvBool("LAPS_DECRYPT", false) {
+			attrs.EncryptedPassword = "msLAPS-EncryptedPassword"
+		}
+		if getEnvBool("LAPS_SYNC_HISTORY", false) {
+			attrs.PasswordHistory = getEnv("LDAP_ATTR_PASSWORD_HISTORY", "msLAPS-EncryptedPasswordHistory")
+		}
+	} else {
+		attrs.Password = "ms-Mcs-AdmPwd"
+		attrs.Expiration = "ms-Mcs-AdmPwdExpirationTime"
+	}
+	return attrs
+}
+
+// GetLapsAttributes returns the attribute names for lapsMode
+func GetLapsAttributes(lapsMode string) LapsAttributes {
+	attrs := lapsModeAttributes(lapsMode)
+	attrs.Name = getEnv("LDAP_ATTR_NAME", "name")
+	attrs.DNSHostName = getEnv("LDAP_ATTR_DNSHOSTNAME", "dNSHostName")
+	attrs.SAMAccountName = getEnv("LDAP_ATTR_SAMACCOUNTNAME", "sAMAccountName")
+	attrs.ObjectGUID = getEnv("LDAP_ATTR_OBJECTGUID", "objectGUID")
+	attrs.Password = getEnv("LDAP_ATTR_PASSWORD", attrs.Password)
+	attrs.Expiration = getEnv("LDAP_ATTR_EXPIRATION", attrs.Expiration)
+	if attrs.EncryptedPassword != "" {
+		attrs.EncryptedPassword = getEnv("LDAP_ATTR_ENCRYPTED_PASSWORD", attrs.EncryptedPassword)
+	}
+
+	if getEnvBool("LAPS_FALLBACK", false) {
+		fallbackMode := lapsModeWindows
+		if lapsMode == lapsModeWindows {
+			fallbackMode = lapsModeLegacy
+		}
+		fallback := lapsModeAttributes(fallbackMode)
+		attrs.Fallback = &fallback
+	}
+
+	if getEnvBool("LDAP_EXCLUDE_DISABLED", false) || itemRulesNeedDC() {
+		attrs.UserAccountControl = "userAccountControl"
+	}
+	if getEnvBool("LDAP_SYNC_COMPUTER_INFO", false) {
+		attrs.Description = "description"
+		attrs.OperatingSystem = "operatingSystem"
+		attrs.OperatingSystemVersion = "operatingSystemVersion"
+		attrs.WhenCreated = "whenCreated"
+	}
+	if getEnvInt("LDAP_STALE_DAYS", 0) > 0 {
+		attrs.LastLogonTimestamp = "lastLogonTimestamp"
+		attrs.PwdLastSet = "pwdLastSet"
+	}
+	attrs.Extra = itemTemplateAttributes()
+	return attrs
+}
+
+// List returns all configured attribute names for a search request
+func (a LapsAttributes) List() []string {
+	list := []string{}
+	for _, attr := range []string{
+		a.Name, a.DNSHostName, a.SAMAccountName, a.ObjectGUID,
+		a.UserAccountControl, a.LastLogonTimestamp, a.PwdLastSet,
+		a.Description, a.OperatingSystem, a.OperatingSystemVersion, a.WhenCreated,
+	} {
+		if attr != "" {
+			list = append(list, attr)
+		}
+	}
+	list = append(list, a.Extra...)
+	return append(list, a.LapsList()...)
+}
+
+// userAccountControl flag of disabled accounts
+const uacAccountDisable = 0x2
+
+// hasUACFlag returns true if the userAccountControl value has flag set
+func hasUACFlag(userAccountControl string, flag int64) bool {
+	uac, err := strconv.ParseInt(userAccountControl, 10, 64)
+	if err != nil {
+		return false
+	}
+	return uac&flag != 0
+}
+
+// isAccountDisabled returns true if the userAccountControl value has the
+// ACCOUNTDISABLE flag set
+func isAccountDisabled(userAccountControl string) bool {
+	return hasUACFlag(userAccountControl, uacAccountDisable)
+}
+
+// getLastActivity returns the most recent of lastLogonTimestamp and pwdLastSet,
+// the zero time is returned if neither is set
+func getLastActivity(lastLogonTimestamp string, pwdLastSet string) time.Time {
+	lastActivity := time.Time{}
+	for _, value := range []string{lastLogonTimestamp, pwdLastSet} {
+		state, t, err := parseFiletime(value)
+		if err != nil || state != expirationKnown {
+			continue
+		}
+		if t.After(lastActivity) {
+			lastActivity = t
+		}
+	}
+	return lastActivity
+}
+
+// LapsList returns the attribute names holding LAPS data, these are
+// confidential and not replicated to the global catalog
+func (a LapsAttributes) LapsList() []string {
+	list := []string{}
+	for _, attr := range []string{a.Password, a.Expiration, a.EncryptedPassword, a.PasswordHistory} {
+		if attr != "" {
+			list = append(list, attr)
+		}
+	}
+	if a.Fallback != nil {
+		list = append(list, a.Fallback.LapsList()...)
+	}
+	return list
+}
+
+// GlobalCatalogList returns all configured attribute names except LapsList
+func (a LapsAttributes) GlobalCatalogList() []string {
+	list := []string{}
+	for _, attr := range a.List() {
+		if !containsString(a.LapsList(), attr) {
+			list = append(list, attr)
+		}
+	}
+	return list
+}
+
+// containsString returns true if list contains s
+func containsString(list []string, s string) bool {
+	for _, element := range list {
+		if element == s {
+			return true
+		}
+	}
+	return false
+}
+
+// getHostname returns the first non empty value of dNSHostName, name and
+// sAMAccountName (without the trailing $) and the attribute it was taken from
+func getHostname(entry *ldap.Entry, attrs LapsAttributes) (string, string) {
+	if hostname := entry.GetAttributeValue(attrs.DNSHostName); hostname != "" {
+		return hostname, attrs.DNSHostName
+	}
+	if hostname := entry.GetAttributeValue(attrs.Name); hostname != "" {
+		return hostname, attrs.Name
+	}
+	if hostname := strings.TrimSuffix(entry.GetAttributeValue(attrs.SAMAccountName), "$"); hostname != "" {
+		return hostname, attrs.SAMAccountName
+	}
+	return "", ""
+}
+
+// parseGeneralizedTime parses a ldap GeneralizedTime value like whenCreated
+func parseGeneralizedTime(value string) (time.Time, error) {
+	return time.Parse("20060102150405.0Z0700", value)
+}
+
+// formatObjectGUID converts a binary objectGUID into its string form, the
+// first three groups are stored little endian
+func formatObjectGUID(raw []byte) string {
+	if len(raw) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%x-%x",
+		raw[3], raw[2], raw[1], raw[0], raw[5], raw[4], raw[7], raw[6], raw[8:10], raw[10:])
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// auditRecord is one line of the AUDIT_LOG file
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	RunID       string    `json:"runId"`
+	Action      string    `json:"action"` // created, updated, archived, deleted, tagged, expired
+	Destination string    `json:"destination"`
+	Vault       string    `json:"vault,omitempty"`
+	Hostname    string    `json:"hostname"`
+	Reason      string    `json:"reason,omitempty"`
+	Actor       string    `json:"actor"` // fingerprint of the credential used
+	Success     bool      `json:"success"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// auditMutex serializes the writes of concurrent workers
+var auditMutex sync.Mutex
+
+// actorCredentialKeys are the settings holding the credential each
+// destination writes with, the first one set identifies the actor
+var actorCredentialKeys = map[string][]string{
+	destinationOnePassword: {"OP_SERVICE_ACCOUNT_TOKEN", "OP_CONNECT_TOKEN"},
+	destinationVault:       {"VAULT_TOKEN", "VAULT_ROLE_ID"},
+	destinationBitwarden:   {"BW_CLIENTID", "BW_SESSION"},
+	destinationAWS:         {"AWS_ACCESS_KEY_ID", "AWS_PROFILE"},
+	destinationCyberArk:    {"CYBERARK_USERNAME"},
+	destinationPass:        {"PASS_STORE_DIR"},
+	"ldap":                 {"LDAP_AUTH_CN", "LDAP_KRB5_PRINCIPAL"},
+}
+
+// actorFingerprint returns the first 16 hex digits of the sha256 of the
+// credential destination writes with, the credential itself is never logged
+func actorFingerprint(destination string) string {
+	for _, key := range actorCredentialKeys[destination] {
+		if value := os.Getenv(key); value != "" {
+			sum := sha256.Sum256([]byte(value))
+			return key + ":" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return "default"
+}
+
+// writeAudit appends a record of action on hostname to AUDIT_LOG, the
+// file is only readable by its owner and every record is synced to disk
+func writeAudit(action string, destination string, vault string, hostname string, reason string, err error) {
+	path := os.Getenv("AUDIT_LOG")
+	if path == "" || flag_dry_run {
+		return
+	}
+	record := auditRecord{
+		Time:        time.Now().UTC(),
+		RunID:       runID,
+		Action:      action,
+		Destination: destination,
+		Vault:       vault,
+		Hostname:    hostname,
+		Reason:      reason,
+		Actor:       actorFingerprint(destination),
+		Success:     err == nil,
+	}
+	if err != nil {
+		record.Error = redactSecrets(err.Error())
+	}
+	line, jsonErr := json.Marshal(record)
+	if jsonErr != nil {
+		log.Error("writeAudit: ", jsonErr)
+		return
+	}
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	file, fileErr := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if fileErr != nil {
+		log.Error("writeAudit: ", fileErr)
+		return
+	}
+	defer file.Close()
+	_, fileErr = file.Write(append(line, '\n'))
+	if fileErr == nil {
+		fileErr = file.Sync()
+	}
+	if fileErr != nil {
+		log.Error("writeAudit: ", fileErr)
+	}
+}
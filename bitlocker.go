@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// bitlockerKey is a BitLocker recovery password stored below a computer object
+type bitlockerKey struct {
+	id       string // msFVE-RecoveryGuid, shown as key id by BitLocker
+	password string
+	created  time.Time
+}
+
+// bitlockerSectionID identifies the item section holding BitLocker recovery keys
+const bitlockerSectionID = "bitlocker"
+
+// IsBitLockerEnabled returns true if BITLOCKER_ENABLED is set
+func IsBitLockerEnabled() bool {
+	return getEnvBool("BITLOCKER_ENABLED", false)
+}
+
+// normalizeDN returns dn in a canonical lower case form for comparisons
+func normalizeDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+	return strings.ToLower(parsed.String())
+}
+
+// parentDN returns the normalized dn of the parent object of dn
+func parentDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) < 2 {
+		return ""
+	}
+	parent := ldap.DN{RDNs: parsed.RDNs[1:]}
+	return strings.ToLower(parent.String())
+}
+
+// getBitLockerKeys reads all msFVE-RecoveryInformation objects below the
+// search base DNs and returns their recovery passwords by the normalized DN
+// of the computer they belong to, newest first
+func getBitLockerKeys(ctx context.Context, ldapCON *ldap.Conn) (map[string][]bitlockerKey, error) {
+	keys := map[string][]bitlockerKey{}
+	for _, baseDN := range GetSearchBaseDNs() {
+		searchReq := ldap.NewSearchRequest(
+			baseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases,
+			0,
+			0,
+			false,
+			"(&(objectClass=msFVE-RecoveryInformation)(msFVE-RecoveryPassword=*))",
+			[]string{"msFVE-RecoveryPassword", "msFVE-RecoveryGuid", "whenCreated"},
+			nil,
+		)
+		result, err := searchLdap(ctx, ldapCON, searchReq)
+		if err != nil {
+			return keys, fmt.Errorf("can't read BitLocker recovery information: %v", err)
+		}
+		log.Debug("getBitLockerKeys: Got ", len(result.Entries), " recovery passwords below ", baseDN)
+		for _, entry := range result.Entries {
+			key := bitlockerKey{
+				id:       strings.ToUpper(formatObjectGUID(entry.GetRawAttributeValue("msFVE-RecoveryGuid"))),
+				password: entry.GetAttributeValue("msFVE-RecoveryPassword"),
+			}
+			registerSecret(key.password)
+			key.created, _ = time.Parse("20060102150405.0Z0700", entry.GetAttributeValue("whenCreated"))
+			computer := parentDN(entry.DN)
+			keys[computer] = append(keys[computer], key)
+		}
+	}
+	for _, computerKeys := range keys {
+		sort.SliceStable(computerKeys, func(i, j int) bool { return computerKeys[i].created.After(computerKeys[j].created) })
+	}
+	return keys, nil
+}
+
+// bitlockerFields returns the BitLocker recovery keys of lapsEntry as
+// concealed item fields labeled with key id and creation date
+func bitlockerFields(lapsEntry LapsEntry) []itemField {
+	fields := []itemField{}
+	for _, key := range lapsEntry.bitlocker {
+		label := "Recovery key " + key.id
+		if !key.created.IsZero() {
+			label += " (" + key.created.Local().Format("2006-01-02") + ")"
+		}
+		fields = append(fields, itemField{label: label, value: key.password, fieldType: "CONCEALED"})
+	}
+	return fields
+}
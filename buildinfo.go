@@ -0,0 +1,82 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// commit and buildDate of laps2onepassword, set at build time with
+// -ldflags "-X main.commit=... -X main.buildDate=...". Without them they are
+// taken from the version control info go build embeds.
+var (
+	commit    = ""
+	buildDate = ""
+)
+
+// init fills version, commit and buildDate from the embedded build info
+// unless they were set with -ldflags
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	// tagged releases only, pseudo versions just repeat the commit
+	if version == "dev" && strings.HasPrefix(info.Main.Version, "v") && !strings.ContainsAny(info.Main.Version, "-+") {
+		version = info.Main.Version
+	}
+	if commit != "" {
+		return
+	}
+	modified := false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			commit = setting.Value
+		case "vcs.time":
+			if buildDate == "" {
+				buildDate = setting.Value
+			}
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if modified && commit != "" {
+		commit += "-dirty"
+	}
+}
+
+// buildVersion returns the version with commit and build date,
+// e.g. v1.4.0 (3f2a9c1d7e0b, 2024-05-02T07:00:12Z)
+func buildVersion() string {
+	details := []string{}
+	for _, detail := range []string{commit, buildDate} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	if len(details) == 0 {
+		return version
+	}
+	return version + " (" + strings.Join(details, ", ") + ")"
+}
+
+// versionString returns the output of --version and the version command
+func versionString() string {
+	return "laps2onepassword " + buildVersion() + " " + runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// logRunStart logs the first line of a run of command with the build of
+// this binary, so items and logs can be traced back to it
+func logRunStart(command string) {
+	if profile := GetConfigProfile(); profile != "" {
+		log.Info("logRunStart: Starting ", command, " run ", runID, " of profile ", profile, " with laps2onepassword ", buildVersion())
+		return
+	}
+	log.Info("logRunStart: Starting ", command, " run ", runID, " with laps2onepassword ", buildVersion())
+}
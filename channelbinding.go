@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/go-ldap/ldap/v3/gssapi"
+	krb5gssapi "github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// IsChannelBinding returns true if LDAP_CHANNEL_BINDING is set
+func IsChannelBinding() bool {
+	return getEnvBool("LDAP_CHANNEL_BINDING", false)
+}
+
+// tlsServerEndPoint returns the tls-server-end-point channel binding data
+// (RFC 5929) of the certificate presented by the ldap server
+func tlsServerEndPoint(ldapCON *ldap.Conn) ([]byte, error) {
+	state, ok := ldapCON.TLSConnectionState()
+	if !ok || len(state.PeerCertificates) == 0 {
+		return nil, errors.New("channel binding requires a ldaps:// or StartTLS connection")
+	}
+	cert := state.PeerCertificates[0]
+	hash := crypto.SHA256
+	switch cert.SignatureAlgorithm {
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384, x509.SHA384WithRSAPSS:
+		hash = crypto.SHA384
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512, x509.SHA512WithRSAPSS:
+		hash = crypto.SHA512
+	}
+	h := hash.New()
+	h.Write(cert.Raw)
+	return append([]byte("tls-server-end-point:"), h.Sum(nil)...), nil
+}
+
+// channelBindingHash returns the MD5 hash of a gss_channel_bindings_struct
+// without addresses carrying applicationData (RFC 4121 section 4.1.1.2)
+func channelBindingHash(applicationData []byte) []byte {
+	bindings := make([]byte, 20, 20+len(applicationData))
+	binary.LittleEndian.PutUint32(bindings[16:], uint32(len(applicationData)))
+	bindings = append(bindings, applicationData...)
+	hash := md5.Sum(bindings)
+	return hash[:]
+}
+
+// channelBindingGSSAPIClient adds the channel binding of the TLS connection
+// to the kerberos AP-REQ, as required by domain controllers enforcing LDAP
+// channel binding. All other steps are passed to the wrapped client. LDAP
+// signing and sealing by SASL are not supported, only by TLS.
+type channelBindingGSSAPIClient struct {
+	*gssapi.Client
+	bindingHash []byte
+}
+
+// newChannelBindingGSSAPIClient wraps client to bind it to the TLS connection of ldapCON
+func newChannelBindingGSSAPIClient(client closableGSSAPIClient, ldapCON *ldap.Conn) (closableGSSAPIClient, error) {
+	krb5client, ok := client.(*gssapi.Client)
+	if !ok {
+		return nil, errors.New("channel binding requires LDAP_KRB5_KEYTAB or a credential cache")
+	}
+	applicationData, err := tlsServerEndPoint(ldapCON)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("newChannelBindingGSSAPIClient: Binding to ", string(applicationData[:21]), " of the server certificate")
+	return &channelBindingGSSAPIClient{Client: krb5client, bindingHash: channelBindingHash(applicationData)}, nil
+}
+
+// InitSecContext builds the initial AP-REQ with the channel binding hash in
+// the authenticator checksum. The wrapped client is initialized first as it
+// keeps the session key of the (cached) service ticket for the later steps.
+func (c *channelBindingGSSAPIClient) InitSecContext(target string, input []byte) ([]byte, bool, error) {
+	if input != nil {
+		return c.Client.InitSecContext(target, input)
+	}
+	if _, _, err := c.Client.InitSecContext(target, nil); err != nil {
+		return nil, false, err
+	}
+	tkt, ekey, err := c.Client.GetServiceTicket(target)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// RFC 4121 section 4.1.1: length of Bnd, Bnd, flags. Integrity and
+	// confidentiality aren't requested, the SASL handshake of go-ldap never
+	// negotiates a security layer, signing and sealing are left to TLS.
+	checksum := make([]byte, 24)
+	binary.LittleEndian.PutUint32(checksum[:4], 16)
+	copy(checksum[4:20], c.bindingHash)
+	binary.LittleEndian.PutUint32(checksum[20:], uint32(krb5gssapi.ContextFlagMutual))
+
+	auth, err := types.NewAuthenticator(c.Client.Credentials.Domain(), c.Client.Credentials.CName())
+	if err != nil {
+		return nil, false, err
+	}
+	auth.Cksum = types.Checksum{CksumType: chksumtype.GSSAPI, Checksum: checksum}
+
+	token, err := spnego.NewKRB5TokenAPREQ(c.Client.Client, tkt, ekey, []int{}, []int{})
+	if err != nil {
+		return nil, false, err
+	}
+	token.APReq, err = messages.NewAPReq(tkt, ekey, auth)
+	if err != nil {
+		return nil, false, err
+	}
+	output, err := token.Marshal()
+	if err != nil {
+		return nil, false, err
+	}
+	return output, true, nil
+}
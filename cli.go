@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// cliCommand is a subcommand of the command line
+type cliCommand struct {
+	name  string
+	args  string // usage of the arguments
+	usage string
+	flags func(fs *flag.FlagSet)
+}
+
+// envFlag is a command line flag setting the environment variable of a
+// setting, it takes precedence over the environment, .env and the config file
+type envFlag string
+
+func (f envFlag) String() string {
+	return ""
+}
+
+func (f envFlag) Set(value string) error {
+	return os.Setenv(string(f), value)
+}
+
+// envBoolFlag is an envFlag without value, e.g. --incremental
+type envBoolFlag string
+
+func (f envBoolFlag) String() string {
+	return ""
+}
+
+func (f envBoolFlag) Set(value string) error {
+	return os.Setenv(string(f), value)
+}
+
+func (f envBoolFlag) IsBoolFlag() bool {
+	return true
+}
+
+// ldapFlags are the flags of the commands reading ldap
+func ldapFlags(fs *flag.FlagSet) {
+	fs.Var(envFlag("LDAP_URL"), "ldap-url", "comma separated ldap `urls`, sets LDAP_URL")
+	fs.Var(envFlag("LDAP_AUTH_CN"), "ldap-user", "bind `dn`, sets LDAP_AUTH_CN")
+	fs.Var(envFlag("LDAP_SEARCH_BASEDN"), "basedn", "search base `dns` separated by ;, sets LDAP_SEARCH_BASEDN")
+	fs.Var(envFlag("LDAP_SEARCH_FILTER"), "filter", "search `filter`, sets LDAP_SEARCH_FILTER")
+	fs.Var(envFlag("LAPS_MODE"), "laps-mode", "`mode` legacy or windows, sets LAPS_MODE")
+}
+
+// destinationFlags are the flags of the commands reading or writing the
+// destinations
+func destinationFlags(fs *flag.FlagSet) {
+	fs.Var(envFlag("DESTINATION"), "destination", "comma separated `destinations`, sets DESTINATION")
+	fs.Var(envFlag("OP_VAULT_TITLE"), "vault", "1Password `vault` title, sets OP_VAULT_TITLE")
+	fs.Var(envFlag("OP_CONNECT_HOST"), "connect-host", "1Password Connect server `url`, sets OP_CONNECT_HOST")
+}
+
+// archiveFlags are the flags of the commands writing to the archive vault
+func archiveFlags(fs *flag.FlagSet) {
+	destinationFlags(fs)
+	fs.Var(envFlag("OP_ORPHAN_ARCHIVE_VAULT"), "archive-vault", "1Password archive `vault`, sets OP_ORPHAN_ARCHIVE_VAULT")
+}
+
+// outputFlag is the flag of the commands with a json result
+func outputFlag(fs *flag.FlagSet) {
+	fs.StringVar(&flag_output, "output", outputText, "result `format` on stdout, text or json (a single line per run)")
+}
+
+// cliCommands are all subcommands, the first is the default
+var cliCommands = []cliCommand{
+	{name: "sync", usage: "Export all LAPS passwords to the destinations (default)", flags: func(fs *flag.FlagSet) {
+		ldapFlags(fs)
+		destinationFlags(fs)
+		fs.Var(envFlag("OP_WRITE_WORKERS"), "workers", "`number` of concurrent writes, sets OP_WRITE_WORKERS")
+		fs.Var(envFlag("OP_ORPHAN_ACTION"), "orphan-action", "`action` none, tag, archive or delete, sets OP_ORPHAN_ACTION")
+		fs.Var(envBoolFlag("LDAP_INCREMENTAL"), "incremental", "only read computers changed since the last run, sets LDAP_INCREMENTAL")
+		fs.Var(envBoolFlag("SYNC_SKIP_UNCHANGED"), "skip-unchanged", "skip computers unchanged since they were written, sets SYNC_SKIP_UNCHANGED")
+		fs.Var(envFlag("SYNC_INTERVAL"), "interval", "`duration` between runs with --daemon, sets SYNC_INTERVAL")
+		fs.Var(envFlag("RUN_DEADLINE"), "deadline", "overall `duration` of a run, sets RUN_DEADLINE")
+		fs.Var(&flag_hosts, "host", "sync only this `hostname` (repeatable, - reads them from stdin)")
+		outputFlag(fs)
+	}},
+	{name: "verify", usage: "Compare every item with LAPS without writing, exits with 2 on drift", flags: func(fs *flag.FlagSet) {
+		ldapFlags(fs)
+		destinationFlags(fs)
+		outputFlag(fs)
+	}},
+	{name: "export", usage: "Write all LAPS entries as CSV, JSON or YAML to stdout or --out", flags: func(fs *flag.FlagSet) {
+		ldapFlags(fs)
+		outputFlag(fs)
+	}},
+	{name: "list", usage: "List the secrets in the destinations without passwords", flags: destinationFlags},
+	{name: "get", args: "<hostname>", usage: "Print the current LAPS password of a computer read from ldap", flags: func(fs *flag.FlagSet) {
+		ldapFlags(fs)
+		fs.BoolVar(&flag_copy, "copy", false, "copy the password to the clipboard and clear it after CLIPBOARD_CLEAR_AFTER")
+		fs.Var(envFlag("CLIPBOARD_CLEAR_AFTER"), "clear-after", "`duration` until the clipboard is cleared, sets CLIPBOARD_CLEAR_AFTER")
+	}},
+	{name: "rotate", args: "<hostname>", usage: "Expire the LAPS password of a computer", flags: ldapFlags},
+	{name: "import", args: "<file>", usage: "Create archived items from a LAPS-UI or export CSV file or a KeePass database", flags: archiveFlags},
+	{name: "dedupe", usage: "Archive duplicate items of the same computer", flags: archiveFlags},
+	{name: "check-config", usage: "Check the settings, ldap, the LAPS schema and the destinations without writing", flags: func(fs *flag.FlagSet) {
+		ldapFlags(fs)
+		destinationFlags(fs)
+	}},
+	{name: "doctor", usage: "Same as check-config", flags: func(fs *flag.FlagSet) {
+		ldapFlags(fs)
+		destinationFlags(fs)
+	}},
+	{name: "init", args: "[file]", usage: "Prompt for the ldap and 1Password Connect settings, test them and write a config file (default " + defaultInitConfigFile + ")"},
+	{name: "install-schedule", usage: "Run sync periodically with the current directory, config and profile: a scheduled task on Windows, a systemd timer as root or a crontab line", flags: func(fs *flag.FlagSet) {
+		fs.DurationVar(&flag_every, "every", 0, "`interval` between two runs (default SYNC_INTERVAL)")
+	}},
+	{name: "uninstall-schedule", usage: "Remove the schedule of install-schedule"},
+	{name: "keyring-set", args: "<setting>", usage: "Store a credential in the OS credential store"},
+	{name: "version", usage: "Print the version"},
+}
+
+// findCommand returns the subcommand name
+func findCommand(name string) (cliCommand, bool) {
+	for _, command := range cliCommands {
+		if command.name == name {
+			return command, true
+		}
+	}
+	return cliCommand{}, false
+}
+
+// usage prints the commands and the global flags
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] <command> [command flags] [arguments]\n\nCommands:\n", os.Args[0])
+	for _, command := range cliCommands {
+		fmt.Fprintf(out, "  %-24s %s\n", strings.TrimSpace(command.name+" "+command.args), command.usage)
+	}
+	fmt.Fprintf(out, "\nFlags (also accepted after the command):\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nRun %s <command> -h for the flags of a command.\n", os.Args[0])
+}
+
+// parseCommandLine returns the subcommand and its arguments. The flags
+// after the command are parsed as well, the global flags are accepted
+// there too. flag.ErrHelp is returned after printing the help of -h.
+func parseCommandLine() (string, []string, error) {
+	name := flag.Arg(0)
+	if name == "" {
+		name = cliCommands[0].name
+	}
+	if name == "help" {
+		usage()
+		return name, nil, flag.ErrHelp
+	}
+	command, found := findCommand(name)
+	if !found {
+		return name, nil, fmt.Errorf("unknown command %s, run %s help", name, os.Args[0])
+	}
+
+	fs := flag.NewFlagSet(command.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\n%s\n\nFlags:\n", os.Args[0], command.name, command.args, command.usage)
+		fs.PrintDefaults()
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	if command.flags != nil {
+		command.flags(fs)
+	}
+	if flag.NArg() > 1 {
+		err := fs.Parse(flag.Args()[1:])
+		if err != nil {
+			return name, nil, err
+		}
+	}
+
+	// the logger was set up before the command flags were parsed
+	relog := false
+	fs.Visit(func(f *flag.Flag) {
+		relog = relog || f.Name == "loglevel" || f.Name == "logfile" || f.Name == "kubernetes" || f.Name == "quiet" || f.Name == "no-color"
+	})
+	if relog {
+		InitLogger()
+	}
+	return name, fs.Args(), nil
+}
+
+// isHelp returns whether err is the result of -h
+func isHelp(err error) bool {
+	return errors.Is(err, flag.ErrHelp)
+}
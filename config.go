@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// configListSeparators are the settings whose lists are separated by ;
+// instead of , because their elements may contain commas
+var configListSeparators = map[string]string{
+	"LDAP_SEARCH_BASEDN": ";",
+	"LDAP_SITES":         ";",
+	"LDAP_MEMBER_OF":     ";",
+	"OP_VAULT_ROUTES":    ";",
+	"AWS_SM_TAGS":        ";",
+	"SYNC_INCLUDE":       ";",
+	"SYNC_EXCLUDE":       ";",
+}
+
+// GetConfigFile returns the config file given with --config or CONFIG_FILE
+func GetConfigFile() string {
+	if flag_config != "" {
+		return flag_config
+	}
+	return os.Getenv("CONFIG_FILE")
+}
+
+// GetConfigProfile returns the profile given with --profile or CONFIG_PROFILE
+func GetConfigProfile() string {
+	if flag_profile != "" {
+		return flag_profile
+	}
+	return os.Getenv("CONFIG_PROFILE")
+}
+
+// LoadConfigFile reads the YAML or TOML (.toml) file path and sets every
+// setting not already set in the environment or .env. Sections are joined
+// with their keys, e.g. url in the ldap section is LDAP_URL and interval
+// in sync is SYNC_INTERVAL, lists are joined with , (; for the settings
+// of configListSeparators). The sections of profile in the profiles
+// section override the settings outside of it.
+func LoadConfigFile(path string, profile string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := map[string]interface{}{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(data, &config)
+	} else {
+		err = yaml.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	profiles, _ := config["profiles"].(map[string]interface{})
+	delete(config, "profiles")
+	settings := map[string]string{}
+	err = flattenConfig("", config, settings)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if profile != "" {
+		profileConfig, found := profiles[profile]
+		if !found {
+			return fmt.Errorf("%s: no profile %s, profiles are %s", path, profile, strings.Join(profileNames(profiles), ", "))
+		}
+		if profileConfig != nil {
+			err = flattenConfig("", profileConfig, settings)
+			if err != nil {
+				return fmt.Errorf("%s: profile %s: %v", path, profile, err)
+			}
+		}
+		log.Debug("LoadConfigFile: Using profile ", profile)
+	}
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, found := os.LookupEnv(key); found {
+			log.Debug("LoadConfigFile: ", key, " overridden by the environment")
+			continue
+		}
+		os.Setenv(key, settings[key])
+	}
+	log.Debug("LoadConfigFile: Read ", len(settings), " settings from ", path)
+	return nil
+}
+
+// profileNames returns the sorted names of profiles
+func profileNames(profiles map[string]interface{}) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flattenConfig adds the settings of value below the section prefix to
+// settings
+func flattenConfig(prefix string, value interface{}, settings map[string]string) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, child := range v {
+			key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+			if prefix != "" {
+				key = prefix + "_" + key
+			}
+			err := flattenConfig(key, child, settings)
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		elements := []string{}
+		for _, element := range v {
+			switch element.(type) {
+			case map[string]interface{}, []interface{}:
+				return fmt.Errorf("%s must be a list of values", prefix)
+			}
+			elements = append(elements, fmt.Sprint(element))
+		}
+		separator, found := configListSeparators[prefix]
+		if !found {
+			separator = ","
+		}
+		settings[prefix] = strings.Join(elements, separator)
+	case nil:
+		settings[prefix] = ""
+	default:
+		if prefix == "" {
+			return fmt.Errorf("not a mapping of settings")
+		}
+		settings[prefix] = fmt.Sprint(v)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+	log "github.com/sirupsen/logrus"
+)
+
+// Supported OP_CONFLICT_POLICY values
+const (
+	conflictPolicyOverwrite = "overwrite" // overwrite manual edits
+	conflictPolicySkip      = "skip"      // leave the item untouched and warn
+	conflictPolicyDuplicate = "duplicate" // keep the edited item with OP_CONFLICT_SUFFIX and create a new one
+)
+
+// conflictTag is set on items detached by the duplicate conflict policy
+const conflictTag = "conflict"
+
+// lastSyncedLabel labels the field holding the time laps2onepassword last wrote the item
+const lastSyncedLabel = "Last synced"
+
+// GetConflictPolicy returns the configured OP_CONFLICT_POLICY, defaults to overwrite
+func GetConflictPolicy() string {
+	policy := strings.ToLower(os.Getenv("OP_CONFLICT_POLICY"))
+	if policy == "" {
+		return conflictPolicyOverwrite
+	}
+	return policy
+}
+
+// lastSyncedField returns the "Last synced" field with the current time
+func lastSyncedField() itemField {
+	return itemField{label: lastSyncedLabel, value: time.Now().UTC().Format(time.RFC3339)}
+}
+
+// markItemSynced sets the "Last synced" time of item, every write of
+// laps2onepassword must call this so it isn't taken for a manual edit
+func markItemSynced(item *onepassword.Item) {
+	setItemSectionFields(item, syncSectionID, "laps2onepassword", []itemField{lastSyncedField()})
+}
+
+// isManuallyEdited returns true if onepassentry was changed more than
+// OP_CONFLICT_TOLERANCE after laps2onepassword last wrote it and its
+// username or password differs from lapsEntry. Items without a
+// "Last synced" time are never taken as edited.
+func isManuallyEdited(onepassentry onepassword.Item, lapsEntry LapsEntry) bool {
+	lastSynced, err := time.Parse(time.RFC3339, getItemSectionValue(onepassentry, syncSectionID, lastSyncedLabel))
+	if err != nil {
+		return false
+	}
+	if !onepassentry.UpdatedAt.After(lastSynced.Add(getEnvDuration("OP_CONFLICT_TOLERANCE", 2*time.Minute))) {
+		return false
+	}
+	return getItemCredential(onepassentry, "USERNAME") != lapsEntry.Username() || getItemCredential(onepassentry, "PASSWORD") != lapsEntry.password
+}
+
+// detachOnePassEntry keeps a manually edited item by renaming it with
+// OP_CONFLICT_SUFFIX, tagging it as conflict and removing its objectGUID,
+// so it is no longer matched to the computer
+func detachOnePassEntry(onepassentry onepassword.Item) error {
+	err := checkManagedItem(onepassentry)
+	if err != nil {
+		return err
+	}
+	title := onepassentry.Title + getEnv("OP_CONFLICT_SUFFIX", " (manual edit)")
+	if flag_dry_run {
+		printDryRun("~", onepassentry.Title, fmt.Sprintf("title %q -> %q", onepassentry.Title, title), "tag "+conflictTag)
+		return nil
+	}
+	client, err := NewOnePassClient()
+	if err != nil {
+		return err
+	}
+	opitem, err := client.GetItem(onepassentry.ID, onepassentry.Vault.ID)
+	if err != nil {
+		return err
+	}
+	opitem.Title = title
+	setItemTag(opitem, conflictTag, true)
+	setItemSectionFields(opitem, syncSectionID, "laps2onepassword", []itemField{{label: "objectGUID", value: ""}})
+	markItemSynced(opitem)
+	_, err = client.UpdateItem(opitem, opitem.Vault.ID)
+	if err != nil {
+		return err
+	}
+	log.Info("detachOnePassEntry: Kept manually edited ", onepassentry.Title, " as ", title)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NewConnectTransport builds the http transport for the 1Password Connect
+// server from OP_CONNECT_CA_FILE, OP_CONNECT_TLS_MIN_VERSION,
+// OP_CONNECT_INSECURE_SKIP_VERIFY, OP_CONNECT_PROXY and the timeouts
+// OP_CONNECT_DIAL_TIMEOUT and OP_CONNECT_TIMEOUT
+func NewConnectTransport() (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: getEnvBool("OP_CONNECT_INSECURE_SKIP_VERIFY", false),
+	}
+	if tlsConfig.InsecureSkipVerify {
+		log.Warn("NewConnectTransport: Certificate validation is disabled")
+	}
+
+	minVersion := os.Getenv("OP_CONNECT_TLS_MIN_VERSION")
+	if minVersion != "" {
+		version, found := tlsVersions[minVersion]
+		if !found {
+			return nil, fmt.Errorf("invalid OP_CONNECT_TLS_MIN_VERSION %s", minVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	caFile := os.Getenv("OP_CONNECT_CA_FILE")
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+		log.Debug("NewConnectTransport: Using CA bundle ", caFile)
+	}
+
+	// HTTPS_PROXY/HTTP_PROXY/NO_PROXY are used unless OP_CONNECT_PROXY is set
+	proxy := http.ProxyFromEnvironment
+	if proxyURL := os.Getenv("OP_CONNECT_PROXY"); proxyURL != "" {
+		parsed, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OP_CONNECT_PROXY %s: %v", proxyURL, err)
+		}
+		proxy = http.ProxyURL(parsed)
+		log.Debug("NewConnectTransport: Using proxy ", parsed.Redacted())
+	}
+
+	dialer := &net.Dialer{Timeout: getEnvDuration("OP_CONNECT_DIAL_TIMEOUT", 30*time.Second), KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: getEnvDuration("OP_CONNECT_TIMEOUT", time.Minute),
+		ExpectContinueTimeout: time.Second,
+	}, nil
+}
+
+// connectHTTPClient is the http client of all requests to the 1Password
+// Connect server, set by InstallConnectHTTPClient. Other http traffic
+// (webhooks, notifications, Entra, Vault, ...) doesn't use it.
+var connectHTTPClient *http.Client
+
+// InstallConnectHTTPClient builds connectHTTPClient with NewConnectTransport
+// and the retries of newRetryTransport
+func InstallConnectHTTPClient() error {
+	if connectHTTPClient != nil {
+		return nil
+	}
+	transport, err := NewConnectTransport()
+	if err != nil {
+		return err
+	}
+	connectHTTPClient = &http.Client{Transport: newRetryTransport(transport)}
+	return nil
+}
+
+// getConnectHTTPClient returns connectHTTPClient, installing it if needed
+func getConnectHTTPClient() (*http.Client, error) {
+	err := InstallConnectHTTPClient()
+	return connectHTTPClient, err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// flag_quiet only logs errors and the summary of each run
+var flag_quiet bool
+
+// flag_no_color disables ANSI colors like NO_COLOR
+var flag_no_color bool
+
+// useColor returns true if colors are written to f: not with --no-color or
+// NO_COLOR (https://no-color.org) and only to a terminal, so the output
+// captured by the Task Scheduler, cron or a pipe stays plain
+func useColor(f *os.File) bool {
+	if flag_no_color || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// consoleFormatter returns the formatter of log entries written to f
+func consoleFormatter(f *os.File) *log.TextFormatter {
+	color := useColor(f)
+	return &log.TextFormatter{
+		ForceColors:     color, // Seems like automatic color detection doesn't work on windows terminals
+		DisableColors:   !color,
+		FullTimestamp:   true,
+		TimestampFormat: time.RFC3339,
+	}
+}
+
+// colorize wraps text in the ANSI color code if colors are written to f
+func colorize(f *os.File, code string, text string) string {
+	if !useColor(f) {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+// logSummary logs message at level, with --quiet as well
+func logSummary(level log.Level, message string) {
+	if flag_quiet && !log.IsLevelEnabled(level) {
+		log.SetLevel(level)
+		defer log.SetLevel(log.ErrorLevel)
+	}
+	log.StandardLogger().Log(level, message)
+}
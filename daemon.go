@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// syncMutex prevents overlapping sync runs
+var syncMutex sync.Mutex
+
+// GetSyncInterval returns SYNC_INTERVAL, the time between two runs in daemon mode
+func GetSyncInterval() time.Duration {
+	return getEnvDuration("SYNC_INTERVAL", 15*time.Minute)
+}
+
+// GetSyncJitter returns SYNC_JITTER, the maximum random delay added to
+// SYNC_INTERVAL, defaults to a tenth of the interval
+func GetSyncJitter() time.Duration {
+	return getEnvDuration("SYNC_JITTER", GetSyncInterval()/10)
+}
+
+// runSyncExclusive runs runSync for hosts (all if empty) unless another run
+// is in progress, returns false if it was skipped
+func runSyncExclusive(ctx context.Context, command string, hosts []string) (int, bool) {
+	if !syncMutex.TryLock() {
+		return 0, false
+	}
+	defer syncMutex.Unlock()
+	runID = uuid.New().String()
+	setRunStarted(time.Now())
+	defer setRunStarted(time.Time{})
+	sdNotify("STATUS=Syncing")
+	code := runSync(ctx, command, hosts)
+	recordRunResult(code)
+	sdNotify("STATUS=Last run " + time.Now().Format(time.RFC3339) + " exited with " + strconv.Itoa(code))
+	return code, true
+}
+
+// RunDaemon runs command at once and then every SYNC_INTERVAL plus up to
+// SYNC_JITTER until ctx is cancelled by SIGINT or SIGTERM. A run in progress
+// stops after its items in progress, failed runs are retried with the next
+// interval. Readiness
+// and watchdog pings are sent to systemd with Type=notify and WatchdogSec.
+// With WEBHOOK_LISTEN runs can also be triggered by POST /sync. In
+// kubernetes mode or with PROBE_LISTEN liveness and readiness probes are
+// served. After MAX_CONSECUTIVE_FAILURES failed runs in a row the daemon
+// exits with exitFailures.
+func RunDaemon(ctx context.Context, command string) int {
+	log.Info("RunDaemon: Syncing every ", GetSyncInterval(), " with up to ", GetSyncJitter(), " jitter")
+	startWatchdog(ctx.Done())
+	if isWebhookEnabled() {
+		startWebhook(ctx, command)
+	}
+	if IsKubernetesMode() || os.Getenv("PROBE_LISTEN") != "" {
+		startProbes(ctx)
+	}
+	sdNotify("READY=1")
+	for {
+		code, ran := runSyncExclusive(ctx, command, nil)
+		if ctx.Err() != nil {
+			log.Info("RunDaemon: Stopped by signal")
+			sdNotify("STOPPING=1")
+			return 0
+		}
+		if !ran {
+			log.Warn("RunDaemon: Skipped run, the previous run is still in progress")
+		} else if code != 0 {
+			log.Warn("RunDaemon: Run failed with exit code ", code, ", retrying with the next interval")
+		}
+		runHealth.Lock()
+		failures := runHealth.failures
+		runHealth.Unlock()
+		if max := GetMaxConsecutiveFailures(); max > 0 && failures >= max {
+			log.Error("RunDaemon: Stopping after ", failures, " failed runs in a row (MAX_CONSECUTIVE_FAILURES)")
+			sdNotify("STOPPING=1")
+			return exitFailures
+		}
+		delay := GetSyncInterval()
+		if jitter := GetSyncJitter(); jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(jitter)))
+		}
+		log.Debug("RunDaemon: Next run in ", delay.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			log.Info("RunDaemon: Stopped by signal")
+			sdNotify("STOPPING=1")
+			return 0
+		case <-time.After(delay):
+		}
+	}
+}
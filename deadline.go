@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exitDeadline is the exit code of a run stopped by RUN_DEADLINE
+const exitDeadline = 8
+
+// errRunDeadline is the cause of a run context cancelled by RUN_DEADLINE
+var errRunDeadline = errors.New("RUN_DEADLINE exceeded")
+
+// errWriteTimeout is the result of a write which didn't finish within
+// OP_WRITE_TIMEOUT
+var errWriteTimeout = errors.New("OP_WRITE_TIMEOUT exceeded, the write may still complete")
+
+// NewRunContext returns a context which is cancelled after RUN_DEADLINE
+// (0 = no deadline). A run past its deadline stops like an interrupted one.
+func NewRunContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if deadline := getEnvDuration("RUN_DEADLINE", 0); deadline > 0 {
+		return context.WithTimeoutCause(parent, deadline, errRunDeadline)
+	}
+	return context.WithCancel(parent)
+}
+
+// NewOnePassListContext returns a context which is cancelled after
+// OP_LIST_DEADLINE (0 = no deadline) to bound listing and reading the
+// 1Password items
+func NewOnePassListContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if deadline := getEnvDuration("OP_LIST_DEADLINE", 0); deadline > 0 {
+		return context.WithTimeout(parent, deadline)
+	}
+	return context.WithCancel(parent)
+}
+
+// stoppedCode returns the exit code of a run whose ctx was cancelled,
+// exitDeadline after RUN_DEADLINE and exitInterrupted after a signal
+func stoppedCode(ctx context.Context) int {
+	if context.Cause(ctx) == errRunDeadline {
+		log.Error("stoppedCode: Run stopped after ", getEnvDuration("RUN_DEADLINE", 0), " (RUN_DEADLINE)")
+		return exitDeadline
+	}
+	return exitInterrupted
+}
+
+// callWithContext runs fn and returns its error, or the error of ctx if it
+// is cancelled first. For the Connect SDK calls, which don't take a context,
+// the abandoned call finishes in the background.
+func callWithContext(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("aborted: %w", ctx.Err())
+	}
+}
+
+// writeWithTimeout runs write within OP_WRITE_TIMEOUT (0 = no timeout)
+func writeWithTimeout(write func() error) error {
+	timeout := getEnvDuration("OP_WRITE_TIMEOUT", 0)
+	if timeout <= 0 {
+		return write()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := callWithContext(ctx, write)
+	if ctx.Err() != nil {
+		return errWriteTimeout
+	}
+	return err
+}
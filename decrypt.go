@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// LapsDecryptor decrypts the DPAPI-NG protected blob of msLAPS-EncryptedPassword
+// and returns the plaintext as stored by Windows LAPS (UTF-16LE encoded JSON)
+type LapsDecryptor interface {
+	Decrypt(blob []byte) ([]byte, error)
+}
+
+// commandDecryptor pipes the DPAPI-NG blob to an external command and
+// reads the decrypted plaintext from its stdout
+type commandDecryptor struct {
+	args []string // executable and arguments
+}
+
+// Decrypt runs the configured command with the blob as stdin
+func (cd commandDecryptor) Decrypt(blob []byte) ([]byte, error) {
+	cmd := exec.Command(cd.args[0], cd.args[1:]...)
+	cmd.Stdin = bytes.NewReader(blob)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("decrypt command failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// splitCommand splits command into the executable and its arguments at
+// whitespace. Parts containing spaces are quoted with " or ', e.g.
+// "C:\Program Files\decrypt.exe" --stdin. A backslash escapes a following
+// quote outside of quotes and " inside of ", nothing inside of '. Other
+// backslashes are kept as they are, they separate windows paths.
+func splitCommand(command string) ([]string, error) {
+	args := []string{}
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		escaped := r == '\\' && i+1 < len(runes) && quote != '\'' &&
+			(runes[i+1] == '"' || (quote == 0 && runes[i+1] == '\''))
+		switch {
+		case escaped:
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
+
+// NewLapsDecryptor returns the decryptor configured by LAPS_DECRYPT_COMMAND,
+// or the native DPAPI-NG decryptor (windows only) if no command is set
+func NewLapsDecryptor() (LapsDecryptor, error) {
+	command := os.Getenv("LAPS_DECRYPT_COMMAND")
+	if command != "" {
+		args, err := splitCommand(command)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LAPS_DECRYPT_COMMAND: %v", err)
+		}
+		return commandDecryptor{args: args}, nil
+	}
+	return newNativeLapsDecryptor()
+}
+
+// decryptWindowsLapsPassword strips the header of a msLAPS-EncryptedPassword
+// value, decrypts the DPAPI-NG blob and parses the contained JSON
+func decryptWindowsLapsPassword(decryptor LapsDecryptor, value []byte) (windowsLapsPassword, error) {
+	// Header: 8 bytes update timestamp, 4 bytes blob size, 4 bytes reserved
+	const headerSize = 16
+	if len(value) < headerSize {
+		return windowsLapsPassword{}, errors.New("msLAPS-EncryptedPassword too short")
+	}
+	blobSize := int(binary.LittleEndian.Uint32(value[8:12]))
+	if blobSize > len(value)-headerSize {
+		return windowsLapsPassword{}, errors.New("msLAPS-EncryptedPassword blob size exceeds value")
+	}
+	plain, err := decryptor.Decrypt(value[headerSize : headerSize+blobSize])
+	if err != nil {
+		return windowsLapsPassword{}, err
+	}
+	return parseWindowsLapsPassword(decodeUTF16LE(plain))
+}
+
+// decodeUTF16LE converts a null terminated UTF-16LE byte slice to a string,
+// input that doesn't look like UTF-16 (e.g. from a decrypt command) is
+// returned as is
+func decodeUTF16LE(b []byte) string {
+	if len(b) < 2 || len(b)%2 != 0 || b[1] != 0 {
+		return strings.TrimRight(string(b), "\x00\r\n")
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "errors"
+
+func newNativeLapsDecryptor() (LapsDecryptor, error) {
+	return nil, errors.New("native DPAPI-NG decryption is only available on windows, set LAPS_DECRYPT_COMMAND")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSplitCommand checks quoting, escaping and the errors of the
+// LAPS_DECRYPT_COMMAND parser
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{name: "plain", command: "decrypt --stdin", want: []string{"decrypt", "--stdin"}},
+		{name: "extra whitespace", command: "  decrypt \t --stdin  ", want: []string{"decrypt", "--stdin"}},
+		{name: "double quoted path with spaces", command: `"C:\Program Files\decrypt.exe" --stdin`, want: []string{`C:\Program Files\decrypt.exe`, "--stdin"}},
+		{name: "single quoted path with spaces", command: `'/opt/laps tools/decrypt' --stdin`, want: []string{"/opt/laps tools/decrypt", "--stdin"}},
+		{name: "quoted part of an argument", command: `decrypt --key="my key"`, want: []string{"decrypt", "--key=my key"}},
+		{name: "empty quoted argument", command: `decrypt ""`, want: []string{"decrypt", ""}},
+		{name: "escaped quote inside double quotes", command: `decrypt "say \"hi\""`, want: []string{"decrypt", `say "hi"`}},
+		{name: "escaped quotes outside quotes", command: `decrypt \"a\" \'b\'`, want: []string{"decrypt", `"a"`, "'b'"}},
+		{name: "backslash inside single quotes", command: `decrypt 'a\b'`, want: []string{"decrypt", `a\b`}},
+		{name: "double quote inside single quotes", command: `decrypt 'say "hi"'`, want: []string{"decrypt", `say "hi"`}},
+		{name: "unterminated double quote", command: `"C:\Program Files\decrypt.exe --stdin`, wantErr: true},
+		{name: "unterminated single quote", command: `decrypt 'abc`, wantErr: true},
+		{name: "escaped closing quote", command: `decrypt "abc\"`, wantErr: true},
+		{name: "empty", command: "", wantErr: true},
+		{name: "whitespace only", command: " \t ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitCommand(tt.command)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("splitCommand(%q) = %q, want an error", tt.command, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitCommand(%q) failed: %v", tt.command, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modncrypt                 = windows.NewLazySystemDLL("ncrypt.dll")
+	procNCryptUnprotectSecret = modncrypt.NewProc("NCryptUnprotectSecret")
+)
+
+const ncryptSilentFlag = 0x40
+
+// dpapiNGDecryptor decrypts with NCryptUnprotectSecret under the identity
+// of the current process, which must be an authorized decryptor
+type dpapiNGDecryptor struct{}
+
+func newNativeLapsDecryptor() (LapsDecryptor, error) {
+	err := procNCryptUnprotectSecret.Find()
+	if err != nil {
+		return nil, err
+	}
+	return dpapiNGDecryptor{}, nil
+}
+
+// Decrypt calls NCryptUnprotectSecret on the DPAPI-NG blob
+func (dpapiNGDecryptor) Decrypt(blob []byte) ([]byte, error) {
+	if len(blob) == 0 {
+		return nil, errors.New("empty DPAPI-NG blob")
+	}
+	var data *byte
+	var size uint32
+	r, _, _ := procNCryptUnprotectSecret.Call(
+		0, // no descriptor handle
+		ncryptSilentFlag,
+		uintptr(unsafe.Pointer(&blob[0])),
+		uintptr(len(blob)),
+		0, // default memory allocation
+		0, // no window handle
+		uintptr(unsafe.Pointer(&data)),
+		uintptr(unsafe.Pointer(&size)),
+	)
+	if r != 0 {
+		return nil, fmt.Errorf("NCryptUnprotectSecret failed with 0x%x", r)
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(data)))
+	plain := make([]byte, size)
+	copy(plain, unsafe.Slice(data, size))
+	return plain, nil
+}
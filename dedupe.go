@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+	log "github.com/sirupsen/logrus"
+)
+
+// findDuplicateOnePassEntries groups the items of the same computer in a
+// vault, matched by objectGUID or case insensitive title. Only groups with
+// more than one item are returned, the canonical item first.
+func findDuplicateOnePassEntries(onepassentries []onepassword.Item) [][]onepassword.Item {
+	groups := map[string][]onepassword.Item{}
+	guidOfTitle := map[string]string{}
+	keys := []string{}
+	for _, onepassentry := range onepassentries {
+		titleKey := onepassentry.Vault.ID + "/" + strings.ToLower(onepassentry.Title)
+		if guid := getItemSectionValue(onepassentry, syncSectionID, "objectGUID"); guid != "" {
+			guidOfTitle[titleKey] = onepassentry.Vault.ID + "/" + guid
+		}
+	}
+	for _, onepassentry := range onepassentries {
+		key := onepassentry.Vault.ID + "/" + strings.ToLower(onepassentry.Title)
+		if guid := getItemSectionValue(onepassentry, syncSectionID, "objectGUID"); guid != "" {
+			key = onepassentry.Vault.ID + "/" + guid
+		} else if guidKey, found := guidOfTitle[key]; found {
+			key = guidKey // unmanaged item with the title of a managed one
+		}
+		if _, found := groups[key]; !found {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], onepassentry)
+	}
+	duplicates := [][]onepassword.Item{}
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		// managed items (with objectGUID) first, then the most recently updated
+		sort.SliceStable(group, func(i, j int) bool {
+			iManaged := getItemSectionValue(group[i], syncSectionID, "objectGUID") != ""
+			jManaged := getItemSectionValue(group[j], syncSectionID, "objectGUID") != ""
+			if iManaged != jManaged {
+				return iManaged
+			}
+			return group[i].UpdatedAt.After(group[j].UpdatedAt)
+		})
+		duplicates = append(duplicates, group)
+	}
+	return duplicates
+}
+
+// getItemNotes returns the notes of item
+func getItemNotes(item onepassword.Item) string {
+	for _, field := range item.Fields {
+		if field.Purpose == "NOTES" {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// DedupeOnePassEntries finds duplicate items of the same computer, merges
+// the notes of the duplicates into the canonical item and moves the
+// duplicates to OP_ORPHAN_ARCHIVE_VAULT
+func DedupeOnePassEntries(ctx context.Context) error {
+	if os.Getenv("OP_ORPHAN_ARCHIVE_VAULT") == "" {
+		return errors.New("dedupe requires OP_ORPHAN_ARCHIVE_VAULT to archive the duplicates")
+	}
+	onepassentries, err := GetOnePassEntries(ctx)
+	if err != nil {
+		return err
+	}
+	duplicates := findDuplicateOnePassEntries(onepassentries)
+	_archived_total := 0
+	for _, group := range duplicates {
+		for _, duplicate := range group[1:] {
+			printDryRun("-", duplicate.Title, "duplicate of "+group[0].Title+" ("+group[0].ID+"), id "+duplicate.ID)
+			_archived_total++
+		}
+	}
+	if _archived_total == 0 {
+		log.Info("DedupeOnePassEntries: No duplicates found")
+		return nil
+	}
+	for _, group := range duplicates {
+		for _, item := range group {
+			err = checkManagedItem(item)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if flag_dry_run {
+		log.Infof("DedupeOnePassEntries: Dry run, %d duplicates not archived", _archived_total)
+		return nil
+	}
+	if !confirm(fmt.Sprintf("Archive %d duplicate items?", _archived_total)) {
+		return errors.New("aborted")
+	}
+
+	client, err := NewOnePassClient()
+	if err != nil {
+		return err
+	}
+	_archived_total = 0
+	for _, group := range duplicates {
+		if ctx.Err() != nil {
+			log.Warnf("DedupeOnePassEntries: Interrupted, archived=%d", _archived_total)
+			return ctx.Err()
+		}
+		canonical, err := client.GetItem(group[0].ID, group[0].Vault.ID)
+		if err != nil {
+			return err
+		}
+		notes := getItemFieldByPurpose(canonical, "NOTES", "notesPlain")
+		for _, duplicate := range group[1:] {
+			if duplicateNotes := getItemNotes(duplicate); duplicateNotes != "" && !strings.Contains(notes.Value, duplicateNotes) {
+				notes.Value += fmt.Sprintf("\n\nMerged from duplicate %s (%s):\n%s", duplicate.Title, duplicate.ID, duplicateNotes)
+			}
+		}
+		markItemSynced(canonical)
+		_, err = client.UpdateItem(canonical, canonical.Vault.ID)
+		writeAudit("updated", destinationOnePassword, canonical.Vault.ID, canonical.Title, "notes of duplicates merged", err)
+		if err != nil {
+			return err
+		}
+		for _, duplicate := range group[1:] {
+			err = archiveOnePassEntry(client, duplicate)
+			writeAudit("archived", destinationOnePassword, duplicate.Vault.ID, duplicate.Title, "duplicate of "+canonical.ID, err)
+			if err != nil {
+				return err
+			}
+			log.Info("DedupeOnePassEntries: Archived ", duplicate.Title, " (", duplicate.ID, ")")
+			_archived_total++
+		}
+	}
+	log.Infof("DedupeOnePassEntries: Total archived=%d", _archived_total)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// orphanedTag is set on items of computers deleted from the directory
+const orphanedTag = "orphaned"
+
+// controlTypeShowRecycled is the LDAP_SERVER_SHOW_RECYCLED_OID control
+const controlTypeShowRecycled = "1.2.840.113556.1.4.2064"
+
+// IsDetectDeleted returns true if LDAP_DETECT_DELETED is enabled
+func IsDetectDeleted() bool {
+	return getEnvBool("LDAP_DETECT_DELETED", false)
+}
+
+// UsesSyncState returns true if any enabled feature requires the state file
+func UsesSyncState() bool {
+	return IsIncremental() || IsDetectDeleted() || IsSkipUnchanged() || usesOrphanState()
+}
+
+// detectDeletedComputers returns the dNSHostNames of computers which were
+// synced before but are gone now. found maps the lower case name of every
+// computer found by this run to its dNSHostName.
+// Full runs diff found against the state file, incremental runs search the
+// Deleted Objects container for tombstones changed since the last run.
+func detectDeletedComputers(ldapCON *ldap.Conn, found map[string]string) ([]string, error) {
+	deleted := []string{}
+	computers := map[string]string{}
+
+	if syncState.incrementalSince > 0 {
+		tombstones, err := searchDeletedComputers(ldapCON, syncState.incrementalSince)
+		if err != nil {
+			if !IsSamba() {
+				return deleted, err
+			}
+			log.Warn("detectDeletedComputers: Can't search tombstones, skipping deleted computers: ", err)
+		}
+		for name, dnshostname := range syncState.Computers {
+			computers[name] = dnshostname
+		}
+		for _, name := range tombstones {
+			if dnshostname, known := computers[name]; known {
+				deleted = append(deleted, dnshostname)
+				delete(computers, name)
+			}
+		}
+	} else {
+		for name, dnshostname := range syncState.Computers {
+			if _, exists := found[name]; !exists {
+				deleted = append(deleted, dnshostname)
+			}
+		}
+	}
+	for name, dnshostname := range found {
+		computers[name] = dnshostname
+	}
+	syncState.pendingComputers = computers
+
+	for _, dnshostname := range deleted {
+		log.Info("detectDeletedComputers: ", dnshostname, " no longer found in ldap")
+	}
+	return deleted, nil
+}
+
+// searchDeletedComputers returns the lower case names of computer tombstones
+// changed since usn, requires read access to the Deleted Objects container
+func searchDeletedComputers(ldapCON *ldap.Conn, usn int64) ([]string, error) {
+	names := []string{}
+	namingContext, err := getNamingContext(ldapCON)
+	if err != nil {
+		return names, err
+	}
+	baseDN := "CN=Deleted Objects," + namingContext
+
+	controls := []ldap.Control{ldap.NewControlMicrosoftShowDeleted()}
+	if IsSamba() {
+		// Samba hides tombstones flagged isRecycled without this control
+		controls = append(controls, ldap.NewControlString(controlTypeShowRecycled, false, ""))
+	}
+
+	searchReq := ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		fmt.Sprintf("(&(objectClass=computer)(isDeleted=TRUE)(uSNChanged>=%d))", usn),
+		[]string{"name"},
+		controls,
+	)
+	result, err := ldapCON.Search(searchReq)
+	if err != nil {
+		return names, err
+	}
+	for _, entry := range result.Entries {
+		// Tombstone names are mangled to "<name>\nDEL:<objectGUID>"
+		name := strings.SplitN(entry.GetAttributeValue("name"), "\n", 2)[0]
+		names = append(names, strings.ToLower(name))
+	}
+	log.Debug("searchDeletedComputers: Got ", len(names), " tombstones since USN ", usn)
+	return names, nil
+}
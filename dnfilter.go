@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetSearchBaseDNs returns the semicolon separated list of LDAP_SEARCH_BASEDN.
+// Without any base DN a single search starts at the empty base DN.
+func GetSearchBaseDNs() []string {
+	baseDNs := getEnvList("LDAP_SEARCH_BASEDN", ";")
+	if len(baseDNs) == 0 {
+		return []string{""}
+	}
+	return baseDNs
+}
+
+// DNFilter decides by regular expressions if a distinguished name is synced
+type DNFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewDNFilter compiles the semicolon separated, case insensitive
+// patterns of LDAP_INCLUDE_DN and LDAP_EXCLUDE_DN
+func NewDNFilter() (DNFilter, error) {
+	dnfilter := DNFilter{}
+	var err error
+	dnfilter.include, err = compilePatterns("LDAP_INCLUDE_DN")
+	if err != nil {
+		return dnfilter, err
+	}
+	dnfilter.exclude, err = compilePatterns("LDAP_EXCLUDE_DN")
+	if err != nil {
+		return dnfilter, err
+	}
+	return dnfilter, nil
+}
+
+// compilePatterns compiles all patterns of a list environment variable
+func compilePatterns(key string) ([]*regexp.Regexp, error) {
+	patterns := []*regexp.Regexp{}
+	for _, pattern := range getEnvList(key, ";") {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return patterns, fmt.Errorf("invalid pattern %s in %s: %v", pattern, key, err)
+		}
+		log.Debug("compilePatterns: ", key, " contains ", pattern)
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// Match returns true if dn matches any include pattern (or none are
+// configured) and no exclude pattern
+func (f DNFilter) Match(dn string) bool {
+	included := len(f.include) == 0
+	for _, re := range f.include {
+		if re.MatchString(dn) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(dn) {
+			return false
+		}
+	}
+	return true
+}
+
+// ldapMatchingRuleInChain resolves nested group memberships on Active Directory
+const ldapMatchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+// memberOfFilter restricts filter to members of any group in the semicolon
+// separated LDAP_MEMBER_OF, nested groups are resolved with LDAP_MEMBER_OF_NESTED
+func memberOfFilter(filter string) string {
+	groups := getEnvList("LDAP_MEMBER_OF", ";")
+	if len(groups) == 0 {
+		return filter
+	}
+	attribute := "memberOf"
+	if getEnvBool("LDAP_MEMBER_OF_NESTED", false) {
+		attribute = "memberOf:" + ldapMatchingRuleInChain + ":"
+	}
+	clauses := []string{}
+	for _, group := range groups {
+		clauses = append(clauses, fmt.Sprintf("(%s=%s)", attribute, ldap.EscapeFilter(group)))
+	}
+	return fmt.Sprintf("(&%s(|%s))", filter, strings.Join(clauses, ""))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/mattn/go-colorable"
+)
+
+// doctorCheck is a line of the check-config checklist
+type doctorCheck struct {
+	name   string
+	detail string
+	err    error
+	code   int // exit code if the check failed
+}
+
+// doctor runs the checks of check-config and prints them as they finish
+type doctor struct {
+	out    io.Writer
+	failed int // exit code of the first failed check
+}
+
+// check prints the result of a check
+func (d *doctor) check(c doctorCheck) bool {
+	if c.err != nil {
+		fmt.Fprintf(d.out, "%s %s: %v\n", colorize(os.Stdout, "31", "[FAIL]"), c.name, c.err)
+		if d.failed == exitOK {
+			d.failed = c.code
+		}
+		return false
+	}
+	if c.detail != "" {
+		fmt.Fprintf(d.out, "%s %s: %s\n", colorize(os.Stdout, "32", "[ OK ]"), c.name, c.detail)
+	} else {
+		fmt.Fprintf(d.out, "%s %s\n", colorize(os.Stdout, "32", "[ OK ]"), c.name)
+	}
+	return true
+}
+
+// skip prints a check which wasn't run
+func (d *doctor) skip(name string, reason string) {
+	fmt.Fprintf(d.out, "%s %s: %s\n", colorize(os.Stdout, "33", "[SKIP]"), name, reason)
+}
+
+// RunDoctor checks the settings (settingsErr is the result of
+// GetAndCheckEnvironment), the ldap servers, the LAPS schema and the
+// destinations without writing anything. Prints a checklist and returns
+// the exit code of the first failed check.
+func RunDoctor(ctx context.Context, settingsErr error) int {
+	// nothing is written, not even a vault of OP_VAULT_AUTOCREATE
+	flag_dry_run = true
+	d := &doctor{out: colorable.NewColorableStdout()}
+	d.check(doctorCheck{name: "Settings", err: settingsErr, code: exitConfig, detail: "all settings valid"})
+
+	ldapCON := d.checkLdap()
+	if ldapCON != nil {
+		defer ldapCON.Close()
+		attrs := GetLapsAttributes(GetLapsMode())
+		d.check(doctorCheck{name: "LDAP search", code: exitLdap, err: checkLdapSearch(ctx, ldapCON, attrs)})
+		missing, err := missingSchemaAttributes(ldapCON, attrs.LapsList())
+		if err == nil && len(missing) > 0 {
+			err = fmt.Errorf("%s not in the schema, check LAPS_MODE and LDAP_ATTR_*", strings.Join(missing, ", "))
+		}
+		d.check(doctorCheck{name: "LAPS schema", code: exitLdap, err: err, detail: strings.Join(attrs.LapsList(), ", ")})
+	} else {
+		d.skip("LDAP search", "no ldap server bound")
+		d.skip("LAPS schema", "no ldap server bound")
+	}
+
+	for _, destination := range GetDestinations() {
+		if destination == destinationOnePassword {
+			d.checkOnePassword()
+			continue
+		}
+		store, err := NewSecretStore(destination)
+		if d.check(doctorCheck{name: "Destination " + destination, code: exitDestination, err: err}) {
+			secrets, err := store.List(ctx)
+			d.check(doctorCheck{name: "Destination " + destination + " read access", code: exitDestination, err: err, detail: fmt.Sprintf("%d secrets", len(secrets))})
+		}
+	}
+
+	if d.failed != exitOK {
+		fmt.Fprintln(d.out, "Some checks failed")
+	} else {
+		fmt.Fprintln(d.out, "All checks passed")
+	}
+	return d.failed
+}
+
+// checkLdap checks every LDAP_URL and returns the first bound connection
+func (d *doctor) checkLdap() *ldap.Conn {
+	var bound *ldap.Conn
+	if len(GetLdapURLs()) == 0 {
+		d.check(doctorCheck{name: "LDAP_URL", code: exitConfig, err: errors.New("not set")})
+		return nil
+	}
+	for _, ldapURL := range GetLdapURLs() {
+		u, err := url.Parse(ldapURL)
+		if err == nil && (u.Hostname() == "" || (u.Scheme != "ldap" && u.Scheme != "ldaps")) {
+			err = errors.New("expected ldap://host[:port] or ldaps://host[:port]")
+		}
+		if !d.check(doctorCheck{name: "LDAP_URL " + ldapURL, code: exitConfig, err: err}) {
+			continue
+		}
+		ldapCON, err := DialLdap(ldapURL)
+		if !d.check(doctorCheck{name: "LDAP connect " + ldapURL, code: exitLdap, err: err, detail: "tls mode " + GetLdapTLSMode()}) {
+			continue
+		}
+		err = BindLdap(ldapCON, ldapHost(ldapURL))
+		if !d.check(doctorCheck{name: "LDAP bind " + ldapURL, code: exitLdap, err: err, detail: GetLdapAuthMethod()}) {
+			ldapCON.Close()
+			continue
+		}
+		if bound == nil {
+			bound = ldapCON
+		} else {
+			ldapCON.Close()
+		}
+	}
+	return bound
+}
+
+// checkLdapSearch runs the configured search for a single computer
+func checkLdapSearch(ctx context.Context, ldapCON *ldap.Conn, attrs LapsAttributes) error {
+	ctx, cancel := NewLdapContext(ctx)
+	defer cancel()
+	for _, baseDN := range GetSearchBaseDNs() {
+		searchReq := ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree, GetDerefAliases(), 1, 0, false,
+			memberOfFilter(getEnv("LDAP_SEARCH_FILTER", "")), attrs.List(), nil)
+		_, err := searchLdap(ctx, ldapCON, searchReq)
+		if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return fmt.Errorf("%s: %v", baseDN, err)
+		}
+	}
+	return nil
+}
+
+// missingSchemaAttributes returns the attributes of names not defined in
+// the schema of the server
+func missingSchemaAttributes(ldapCON *ldap.Conn, names []string) ([]string, error) {
+	root, err := ldapCON.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)", []string{"subschemaSubentry"}, nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(root.Entries) == 0 || root.Entries[0].GetAttributeValue("subschemaSubentry") == "" {
+		return nil, errors.New("rootDSE has no subschemaSubentry")
+	}
+	schema, err := ldapCON.Search(ldap.NewSearchRequest(root.Entries[0].GetAttributeValue("subschemaSubentry"), ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)", []string{"attributeTypes"}, nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(schema.Entries) == 0 {
+		return nil, errors.New("schema not readable")
+	}
+	types := strings.ToLower(strings.Join(schema.Entries[0].GetAttributeValues("attributeTypes"), "\n"))
+	missing := []string{}
+	for _, name := range names {
+		if !strings.Contains(types, "name '"+strings.ToLower(name)+"'") {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// checkOnePassword checks the Connect server, the token and the read
+// access to every destination vault
+func (d *doctor) checkOnePassword() {
+	if GetOnePassBackend() == onePassBackendConnect {
+		if !d.check(doctorCheck{name: "1Password Connect TLS settings", code: exitConfig, err: InstallConnectHTTPClient()}) {
+			return
+		}
+		if !d.check(doctorCheck{name: "1Password Connect health", code: exitDestination, err: checkConnectHealth(), detail: getEnv("OP_CONNECT_HOST", "")}) {
+			return
+		}
+	}
+	client, err := NewOnePassClient()
+	if !d.check(doctorCheck{name: "1Password client", code: exitConfig, err: err, detail: GetOnePassBackend()}) {
+		return
+	}
+	vaults, err := client.GetVaults()
+	if err != nil {
+		err = errors.New(describeOnePassError(err))
+	}
+	if !d.check(doctorCheck{name: "1Password token", code: exitDestination, err: err, detail: fmt.Sprintf("%d vaults accessible", len(vaults))}) {
+		return
+	}
+	titles := GetVaultTitles()
+	if archive := getEnv("OP_ORPHAN_ARCHIVE_VAULT", ""); archive != "" && !containsString(titles, archive) {
+		titles = append(titles, archive)
+	}
+	for _, title := range titles {
+		name := "1Password vault " + vaultDisplayName(title)
+		vault, err := getVault(client, title)
+		if err == nil && vault.ID == "" {
+			d.skip(name, "doesn't exist yet, created by the first sync")
+			continue
+		}
+		if err == nil {
+			_, err = client.GetItems(vault.ID)
+		}
+		if err != nil {
+			err = errors.New(describeOnePassError(err))
+		}
+		d.check(doctorCheck{name: name, code: exitDestination, err: err, detail: "readable, write access is checked by the first sync"})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+)
+
+// printDryRun prints a change a dry run would make, passwords are never shown
+func printDryRun(op string, title string, details ...string) {
+	if IsJSONOutput() {
+		summary.addItem(itemResult{Title: title, Action: dryRunActions[op], Details: details})
+		return
+	}
+	if len(details) > 0 {
+		fmt.Printf("%s %s (%s)\n", op, title, strings.Join(details, ", "))
+	} else {
+		fmt.Printf("%s %s\n", op, title)
+	}
+}
+
+// changedFields returns the names of the item fields an update from
+// lapsEntry would change
+func changedFields(onepassentry onepassword.Item, lapsEntry LapsEntry) []string {
+	current := map[string]string{
+		"USERNAME": getItemCredential(onepassentry, "USERNAME"),
+		"PASSWORD": getItemCredential(onepassentry, "PASSWORD"),
+	}
+	changed := []string{}
+	if onepassentry.Title != lapsEntry.Title() {
+		changed = append(changed, fmt.Sprintf("title %q -> %q", onepassentry.Title, lapsEntry.Title()))
+	}
+	if expiration := getItemSectionValue(onepassentry, syncSectionID, "Password expires"); expiration != expirationDate(lapsEntry) {
+		changed = append(changed, fmt.Sprintf("expiration %q -> %q", expiration, expirationDate(lapsEntry)))
+	}
+	if getItemSectionValue(onepassentry, syncSectionID, "objectGUID") != lapsEntry.guid {
+		changed = append(changed, "objectGUID")
+	}
+	if dn := getItemSectionValue(onepassentry, syncSectionID, "distinguishedName"); dn != lapsEntry.dn {
+		changed = append(changed, fmt.Sprintf("distinguishedName %q -> %q", dn, lapsEntry.dn))
+	}
+	if current["USERNAME"] != lapsEntry.Username() {
+		changed = append(changed, fmt.Sprintf("username %q -> %q", current["USERNAME"], lapsEntry.Username()))
+	}
+	if current["PASSWORD"] != lapsEntry.password {
+		changed = append(changed, "password")
+	}
+	if !syncHashMatches(getItemSectionValue(onepassentry, syncSectionID, syncHashLabel), lapsEntry) && len(changed) == 0 {
+		changed = append(changed, "synced content")
+	}
+	return changed
+}
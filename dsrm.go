@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// lapsModeDSRM is the LapsEntry source of Directory Services Restore Mode passwords
+const lapsModeDSRM = "dsrm"
+
+// dsrmTitleSuffix is appended to the item title of DSRM entries
+const dsrmTitleSuffix = " (DSRM)"
+
+// userAccountControl flag of domain controller computer accounts
+const uacServerTrustAccount = 8192
+
+// IsDSRMEnabled returns true if DSRM_ENABLED is set
+func IsDSRMEnabled() bool {
+	return getEnvBool("DSRM_ENABLED", false)
+}
+
+// getDSRMEntries reads the DSRM password attribute (DSRM_ATTRIBUTE) of all
+// domain controllers below DSRM_SEARCH_BASEDN, defaulting to the domain
+func getDSRMEntries(ctx context.Context, ldapCON *ldap.Conn, decryptor LapsDecryptor) ([]LapsEntry, error) {
+	lapsentries := []LapsEntry{}
+	attribute := getEnv("DSRM_ATTRIBUTE", "msLAPS-EncryptedDSRMPassword")
+	baseDN := os.Getenv("DSRM_SEARCH_BASEDN")
+	if baseDN == "" {
+		var err error
+		baseDN, err = getNamingContext(ldapCON)
+		if err != nil {
+			return lapsentries, err
+		}
+	}
+
+	searchReq := ldap.NewSearchRequest(
+		baseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		fmt.Sprintf("(&(objectClass=computer)(userAccountControl:1.2.840.113556.1.4.803:=%d)(%s=*))", uacServerTrustAccount, attribute),
+		[]string{"name", "dNSHostName", attribute},
+		nil,
+	)
+	result, err := searchLdap(ctx, ldapCON, searchReq)
+	if err != nil {
+		return lapsentries, err
+	}
+	log.Debug("getDSRMEntries: Got ", len(result.Entries), " domain controllers from ldap")
+
+	for _, entry := range result.Entries {
+		var wlp windowsLapsPassword
+		raw := entry.GetRawAttributeValue(attribute)
+		if decryptor != nil {
+			wlp, err = decryptWindowsLapsPassword(decryptor, raw)
+		} else {
+			wlp, err = parseWindowsLapsPassword(string(raw))
+		}
+		if err != nil {
+			quarantineEntry(entry.DN, entry.GetAttributeValue("dNSHostName"), lapsModeDSRM, err.Error())
+			continue
+		}
+		account := wlp.Account
+		if account == "" {
+			account = "Administrator"
+		}
+		registerSecret(wlp.Password)
+		lapsentry := LapsEntry{
+			name:            entry.GetAttributeValue("name"),
+			dnshostname:     entry.GetAttributeValue("dNSHostName"),
+			dn:              entry.DN,
+			account:         account,
+			password:        wlp.Password,
+			source:          lapsModeDSRM,
+			dc:              true,
+			expirationstate: expirationUnknown,
+		}
+		lapsentry.updated, err = wlp.UpdateTime()
+		if err != nil {
+			lapsentry.problems = append(lapsentry.problems, fmt.Sprintf("malformed %s timestamp %q", attribute, wlp.Timestamp))
+		}
+		log.Trace("getDSRMEntries: ", lapsentry.Title())
+		lapsentries = append(lapsentries, lapsentry)
+	}
+	return lapsentries, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// lapsModeEntra is the LapsEntry source of passwords read from Microsoft Entra ID
+const lapsModeEntra = "entra"
+
+const graphBaseURL = "https://graph.microsoft.com/v1.0"
+
+// IsEntraEnabled returns true if ENTRA_ENABLED is set
+func IsEntraEnabled() bool {
+	return getEnvBool("ENTRA_ENABLED", false)
+}
+
+// entraClient is a minimal Microsoft Graph client authenticated with the
+// client credentials flow of an app registration with
+// DeviceLocalCredential.Read.All permission
+type entraClient struct {
+	httpClient *http.Client
+	token      string
+	ctx        context.Context // cancels the requests of the run
+}
+
+// newEntraClient requests an access token for Microsoft Graph
+func newEntraClient(ctx context.Context) (*entraClient, error) {
+	client := &entraClient{httpClient: &http.Client{Timeout: time.Minute}, ctx: ctx}
+	tokenURL := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", url.PathEscape(os.Getenv("ENTRA_TENANT_ID")))
+	form := url.Values{
+		"client_id":     {os.Getenv("ENTRA_CLIENT_ID")},
+		"client_secret": {os.Getenv("ENTRA_CLIENT_SECRET")},
+		"scope":         {"https://graph.microsoft.com/.default"},
+		"grant_type":    {"client_credentials"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("entra token request failed with status %d: %s", resp.StatusCode, body)
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	err = json.Unmarshal(body, &token)
+	if err != nil {
+		return nil, err
+	}
+	client.token = token.AccessToken
+	registerSecret(client.token)
+	return client, nil
+}
+
+// get requests a Microsoft Graph url and decodes the json response into result
+func (c *entraClient) get(requestURL string, result interface{}) error {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	// Required by the deviceLocalCredentials endpoint
+	req.Header.Set("ocp-client-name", "laps2onepassword")
+	req.Header.Set("ocp-client-version", "1.0")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("graph request failed with status %d: %s", resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, result)
+}
+
+// entraDeviceLocalCredential is a deviceLocalCredentialInfo resource
+type entraDeviceLocalCredential struct {
+	ID                 string    `json:"id"`
+	DeviceName         string    `json:"deviceName"`
+	LastBackupDateTime time.Time `json:"lastBackupDateTime"`
+	Credentials        []struct {
+		AccountName    string    `json:"accountName"`
+		BackupDateTime time.Time `json:"backupDateTime"`
+		PasswordBase64 string    `json:"passwordBase64"`
+	} `json:"credentials"`
+}
+
+// GetEntraLapsEntries reads the local administrator credentials of all
+// devices from the deviceLocalCredentials endpoint of Microsoft Graph
+func GetEntraLapsEntries(ctx context.Context) ([]LapsEntry, error) {
+	lapsentries := []LapsEntry{}
+	client, err := newEntraClient(ctx)
+	if err != nil {
+		return lapsentries, err
+	}
+
+	devices := []entraDeviceLocalCredential{}
+	nextLink := graphBaseURL + "/directory/deviceLocalCredentials"
+	for nextLink != "" {
+		page := struct {
+			Value    []entraDeviceLocalCredential `json:"value"`
+			NextLink string                       `json:"@odata.nextLink"`
+		}{}
+		err = client.get(nextLink, &page)
+		if err != nil {
+			return lapsentries, err
+		}
+		devices = append(devices, page.Value...)
+		nextLink = page.NextLink
+	}
+	log.Debug("GetEntraLapsEntries: Got ", len(devices), " devices from entra")
+
+	for _, device := range devices {
+		// Passwords are only returned when a single device is requested
+		err = client.get(fmt.Sprintf("%s/directory/deviceLocalCredentials/%s?$select=credentials,deviceName", graphBaseURL, url.PathEscape(device.ID)), &device)
+		if err != nil {
+			return lapsentries, err
+		}
+		if len(device.Credentials) == 0 {
+			log.Warn("GetEntraLapsEntries: Skipped ", device.DeviceName, ": no credentials")
+			continue
+		}
+		latest := device.Credentials[0]
+		for _, credential := range device.Credentials[1:] {
+			if credential.BackupDateTime.After(latest.BackupDateTime) {
+				latest = credential
+			}
+		}
+		password, err := base64.StdEncoding.DecodeString(latest.PasswordBase64)
+		if err != nil {
+			log.Warn("GetEntraLapsEntries: Skipped ", device.DeviceName, ": can't decode password")
+			continue
+		}
+		registerSecret(string(password))
+		log.Trace("GetEntraLapsEntries: ", device.DeviceName)
+		lapsentries = append(lapsentries, LapsEntry{
+			name:            device.DeviceName,
+			dnshostname:     device.DeviceName,
+			account:         latest.AccountName,
+			source:          lapsModeEntra,
+			password:        string(password),
+			updated:         latest.BackupDateTime,
+			expirationstate: expirationUnknown,
+		})
+	}
+	return lapsentries, nil
+}
+
+// MergeLapsEntries adds the entries of additional which aren't already in
+// lapsentries, computers are matched by their short host name
+func MergeLapsEntries(lapsentries []LapsEntry, additional []LapsEntry) []LapsEntry {
+	known := map[string]bool{}
+	for _, lapsentry := range lapsentries {
+		known[shortHostname(lapsentry.dnshostname)] = true
+	}
+	for _, lapsentry := range additional {
+		if known[shortHostname(lapsentry.dnshostname)] {
+			log.Debug("MergeLapsEntries: Skipped ", lapsentry.dnshostname, ", already read from ldap")
+			continue
+		}
+		lapsentries = append(lapsentries, lapsentry)
+	}
+	return lapsentries
+}
+
+// shortHostname returns the lower case first label of a host name
+func shortHostname(hostname string) string {
+	return strings.ToLower(strings.SplitN(hostname, ".", 2)[0])
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// getEnvBool returns the boolean value of an environment variable,
+// def is returned if the variable is unset or not a valid boolean
+func getEnvBool(key string, def bool) bool {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// checkEnvBool logs an error and returns false if an environment variable
+// is set but doesn't contain a valid boolean
+func checkEnvBool(key string) bool {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return true
+	}
+	_, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Errorf("GetAndCheckEnvironment: %s is not a valid boolean: %s", key, value)
+		return false
+	}
+	log.Debug("GetAndCheckEnvironment: ", key, " is ", value)
+	return true
+}
+
+// getEnvList splits an environment variable by sep and returns
+// all trimmed, non empty elements
+func getEnvList(key string, sep string) []string {
+	list := []string{}
+	for _, value := range strings.Split(os.Getenv(key), sep) {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// getEnvDuration returns the duration value of an environment variable,
+// def is returned if the variable is unset or not a valid duration
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// checkEnvDuration logs an error and returns false if an environment variable
+// is set but doesn't contain a valid duration
+func checkEnvDuration(key string) bool {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return true
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Errorf("GetAndCheckEnvironment: %s is not a valid duration: %s", key, value)
+		return false
+	}
+	log.Debug("GetAndCheckEnvironment: ", key, " is ", value)
+	return true
+}
+
+// getEnv returns the value of an environment variable or def if unset or empty
+func getEnv(key string, def string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// getEnvInt returns the integer value of an environment variable,
+// def is returned if the variable is unset or not a valid integer
+func getEnvInt(key string, def int) int {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return def
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	return i
+}
+
+// checkEnvInt logs an error and returns false if an environment variable
+// is set but doesn't contain a non negative integer
+func checkEnvInt(key string) bool {
+	value, found := os.LookupEnv(key)
+	if !found || value == "" {
+		return true
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		log.Errorf("GetAndCheckEnvironment: %s is not a valid number: %s", key, value)
+		return false
+	}
+	log.Debug("GetAndCheckEnvironment: ", key, " is ", value)
+	return true
+}
+
+// loadSecretFiles sets each credential of secretEnvKeys from the file named
+// by KEY_FILE, e.g. OP_CONNECT_TOKEN_FILE=/run/secrets/op_token for docker
+// and kubernetes secrets. A trailing newline is removed, setting both KEY
+// and KEY_FILE is an error.
+func loadSecretFiles() error {
+	for _, key := range secretEnvKeys {
+		path := os.Getenv(key + "_FILE")
+		if path == "" {
+			continue
+		}
+		if os.Getenv(key) != "" {
+			return fmt.Errorf("%s and %s_FILE are both set", key, key)
+		}
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s_FILE: %v", key, err)
+		}
+		os.Setenv(key, strings.TrimRight(string(value), "\r\n"))
+		log.Debug("loadSecretFiles: Read ", key, " from ", path)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// exportFields returns the value of every exportable field of lapsEntry
+var exportFields = map[string]func(lapsEntry LapsEntry) string{
+	"hostname":    func(e LapsEntry) string { return e.Title() },
+	"name":        func(e LapsEntry) string { return e.name },
+	"username":    func(e LapsEntry) string { return e.Username() },
+	"password":    func(e LapsEntry) string { return e.password },
+	"expiration":  func(e LapsEntry) string { return expirationDate(e) },
+	"source":      func(e LapsEntry) string { return e.source },
+	"dn":          func(e LapsEntry) string { return e.dn },
+	"guid":        func(e LapsEntry) string { return e.guid },
+	"updated":     func(e LapsEntry) string { return exportTime(e.updated) },
+	"lastlogon":   func(e LapsEntry) string { return exportTime(e.lastlogon) },
+	"stale":       func(e LapsEntry) string { return strconv.FormatBool(e.stale) },
+	"description": func(e LapsEntry) string { return e.description },
+	"os":          func(e LapsEntry) string { return e.os },
+	"osversion":   func(e LapsEntry) string { return e.osversion },
+}
+
+// defaultExportFields are exported without --fields
+var defaultExportFields = []string{"hostname", "username", "expiration", "source", "dn", "guid"}
+
+// exportTime returns t as RFC3339, empty if unknown
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// GetExportFields returns the fields selected with --fields. Passwords are
+// only exported with --with-passwords, they are added to the default fields.
+func GetExportFields() ([]string, error) {
+	fields := defaultExportFields
+	if flag_fields != "" {
+		fields = []string{}
+		for _, field := range strings.Split(flag_fields, ",") {
+			field = strings.ToLower(strings.TrimSpace(field))
+			if _, found := exportFields[field]; !found {
+				return nil, fmt.Errorf("unknown export field %s", field)
+			}
+			if field == "password" && !flag_with_passwords {
+				return nil, fmt.Errorf("exporting passwords requires --with-passwords")
+			}
+			fields = append(fields, field)
+		}
+	} else if flag_with_passwords {
+		fields = append([]string{"hostname", "username", "password"}, defaultExportFields[2:]...)
+	}
+	return fields, nil
+}
+
+// ExportLapsEntries writes the selected fields of lapsentries as csv, json
+// or yaml (--format) to --out or stdout
+func ExportLapsEntries(lapsentries []LapsEntry) error {
+	fields, err := GetExportFields()
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	switch strings.ToLower(flag_format) {
+	case "csv":
+		err = exportCSV(&out, lapsentries, fields)
+	case "json":
+		err = exportJSON(&out, lapsentries, fields)
+	case "yaml":
+		err = exportYAML(&out, lapsentries, fields)
+	default:
+		err = fmt.Errorf("unknown export format %s, use csv, json or yaml", flag_format)
+	}
+	if err != nil {
+		return err
+	}
+	if flag_out == "" {
+		_, err = os.Stdout.Write(out.Bytes())
+		return err
+	}
+	err = os.WriteFile(flag_out, out.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	for _, lapsentry := range lapsentries {
+		summary.addItem(itemResult{Title: lapsentry.Title(), Action: "exported"})
+	}
+	log.Info("ExportLapsEntries: Exported ", len(lapsentries), " entries to ", flag_out)
+	return nil
+}
+
+// exportCSV writes a header line and one line per entry
+func exportCSV(w io.Writer, lapsentries []LapsEntry, fields []string) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(fields)
+	if err != nil {
+		return err
+	}
+	for _, lapsentry := range lapsentries {
+		record := []string{}
+		for _, field := range fields {
+			record = append(record, exportFields[field](lapsentry))
+		}
+		err = writer.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportJSON writes an array of objects, the keys are in the order of fields
+func exportJSON(w io.Writer, lapsentries []LapsEntry, fields []string) error {
+	var out bytes.Buffer
+	out.WriteString("[")
+	for cur_laps_idx, lapsentry := range lapsentries {
+		if cur_laps_idx > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n  {")
+		for cur_field_idx, field := range fields {
+			if cur_field_idx > 0 {
+				out.WriteString(", ")
+			}
+			key, _ := json.Marshal(field)
+			value, err := json.Marshal(exportFields[field](lapsentry))
+			if err != nil {
+				return err
+			}
+			out.Write(key)
+			out.WriteString(": ")
+			out.Write(value)
+		}
+		out.WriteString("}")
+	}
+	out.WriteString("\n]\n")
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// exportYAML writes a sequence of mappings, the keys are in the order of fields
+func exportYAML(w io.Writer, lapsentries []LapsEntry, fields []string) error {
+	doc := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, lapsentry := range lapsentries {
+		entry := &yaml.Node{Kind: yaml.MappingNode}
+		for _, field := range fields {
+			entry.Content = append(entry.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: field},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: exportFields[field](lapsentry)},
+			)
+		}
+		doc.Content = append(doc.Content, entry)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	err := encoder.Encode(doc)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atotto/clipboard"
+	log "github.com/sirupsen/logrus"
+)
+
+// flag_copy copies the password of get to the clipboard instead of printing it
+var flag_copy bool
+
+// GetClipboardClearAfter returns CLIPBOARD_CLEAR_AFTER, the time after
+// which get --copy clears the clipboard
+func GetClipboardClearAfter() time.Duration {
+	return getEnvDuration("CLIPBOARD_CLEAR_AFTER", 30*time.Second)
+}
+
+// GetLapsPassword reads the current LAPS password of hostname from ldap,
+// not from a destination. It is printed or, with --copy, copied to the
+// clipboard, which is cleared after CLIPBOARD_CLEAR_AFTER or when ctx is
+// cancelled. Every read is written to the audit log.
+func GetLapsPassword(ctx context.Context, hostname string) error {
+	if hostname == "" {
+		return errors.New("usage: get <hostname> [--copy]")
+	}
+	reason := "get command"
+	if flag_copy {
+		reason = "get --copy command"
+	}
+
+	lapsEntry, err := readLapsEntry(ctx, hostname)
+	if err == nil && lapsEntry.password == "" {
+		err = fmt.Errorf("%s has no LAPS password or it isn't readable with this account", hostname)
+	}
+	writeAudit("read", "ldap", "", hostname, reason, err)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"audit": "get", "computer": lapsEntry.dn}).Info("GetLapsPassword: Read password of ", hostname)
+
+	if !flag_copy {
+		fmt.Printf("Username:   %s\nPassword:   %s\nExpiration: %s\n", lapsEntry.Username(), lapsEntry.password, lapsEntry.ExpirationString())
+		return nil
+	}
+	err = clipboard.WriteAll(lapsEntry.password)
+	if err != nil {
+		return fmt.Errorf("can't copy to the clipboard: %v", err)
+	}
+	clearAfter := GetClipboardClearAfter()
+	fmt.Printf("Copied the password of %s (%s) to the clipboard, clearing it in %s\n", lapsEntry.Title(), lapsEntry.Username(), clearAfter)
+	select {
+	case <-time.After(clearAfter):
+	case <-ctx.Done():
+	}
+	// don't clear something copied meanwhile
+	if current, err := clipboard.ReadAll(); err == nil && current != lapsEntry.password {
+		return nil
+	}
+	err = clipboard.WriteAll("")
+	if err != nil {
+		return fmt.Errorf("can't clear the clipboard: %v", err)
+	}
+	fmt.Println("Clipboard cleared")
+	return nil
+}
+
+// readLapsEntry reads the LAPS entry of the computer hostname
+func readLapsEntry(ctx context.Context, hostname string) (LapsEntry, error) {
+	ldapCON, ldapURL, err := ConnectLdap(ctx)
+	if err != nil {
+		return LapsEntry{}, err
+	}
+	defer ldapCON.Close()
+	log.Debug("readLapsEntry: Connected to ", ldapURL)
+
+	attrs := GetLapsAttributes(GetLapsMode())
+	var decryptor LapsDecryptor
+	if getEnvBool("LAPS_DECRYPT", false) {
+		decryptor, err = NewLapsDecryptor()
+		if err != nil {
+			return LapsEntry{}, err
+		}
+	}
+	entry, err := findComputer(ldapCON, hostname, attrs.List())
+	if err != nil {
+		return LapsEntry{}, err
+	}
+	return newLapsEntry(entry, attrs, decryptor)
+}
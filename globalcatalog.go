@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// IsGlobalCatalog returns true if LDAP_GLOBAL_CATALOG is enabled
+func IsGlobalCatalog() bool {
+	return getEnvBool("LDAP_GLOBAL_CATALOG", false)
+}
+
+// globalCatalog reads the confidential LAPS attributes, which are not part
+// of the partial attribute set replicated to the global catalog, from a
+// domain controller of the domain holding the computer object
+type globalCatalog struct {
+	conns      map[string]*ldap.Conn
+	attributes []string
+	filter     string
+}
+
+// newGlobalCatalog prepares the lookup of the LAPS attributes of attrs
+func newGlobalCatalog(attrs LapsAttributes) *globalCatalog {
+	clauses := []string{}
+	for _, attr := range []string{attrs.Password, attrs.EncryptedPassword} {
+		if attr != "" {
+			clauses = append(clauses, fmt.Sprintf("(%s=*)", attr))
+		}
+	}
+	if attrs.Fallback != nil {
+		clauses = append(clauses, fmt.Sprintf("(%s=*)", attrs.Fallback.Password))
+	}
+	return &globalCatalog{
+		conns:      map[string]*ldap.Conn{},
+		attributes: attrs.LapsList(),
+		filter:     fmt.Sprintf("(|%s)", strings.Join(clauses, "")),
+	}
+}
+
+// domainOfDN converts the DC components of dn to a dns domain name
+func domainOfDN(dn string) (string, error) {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return "", err
+	}
+	labels := []string{}
+	for _, rdn := range parsed.RDNs {
+		for _, attr := range rdn.Attributes {
+			if strings.EqualFold(attr.Type, "DC") {
+				labels = append(labels, attr.Value)
+			}
+		}
+	}
+	if len(labels) == 0 {
+		return "", fmt.Errorf("no domain components in %s", dn)
+	}
+	return strings.ToLower(strings.Join(labels, ".")), nil
+}
+
+// connect returns a bound connection to domain, connections are reused
+func (gc *globalCatalog) connect(domain string) (*ldap.Conn, error) {
+	if conn, found := gc.conns[domain]; found {
+		return conn, nil
+	}
+	ldapURL := fmt.Sprintf(getEnv("LDAP_GC_DOMAIN_URL", "ldaps://%s"), domain)
+	conn, err := DialLdap(ldapURL)
+	if err != nil {
+		return nil, err
+	}
+	err = BindLdap(conn, ldapHost(ldapURL))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	log.Debug("globalCatalog: Connected to ", ldapURL)
+	gc.conns[domain] = conn
+	return conn, nil
+}
+
+// resolve adds the LAPS attributes of entry read from its domain
+func (gc *globalCatalog) resolve(entry *ldap.Entry) error {
+	domain, err := domainOfDN(entry.DN)
+	if err != nil {
+		return err
+	}
+	conn, err := gc.connect(domain)
+	if err != nil {
+		return err
+	}
+	searchReq := ldap.NewSearchRequest(entry.DN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		gc.filter, gc.attributes, nil)
+	result, err := conn.Search(searchReq)
+	if err != nil {
+		return err
+	}
+	if len(result.Entries) == 0 {
+		return errors.New("no LAPS attributes in domain " + domain)
+	}
+	entry.Attributes = append(entry.Attributes, result.Entries[0].Attributes...)
+	return nil
+}
+
+// Close closes all domain connections
+func (gc *globalCatalog) Close() {
+	for _, conn := range gc.conns {
+		conn.Close()
+	}
+}
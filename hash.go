@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// syncHashLabel labels the field holding the salted hash of the synced content
+const syncHashLabel = "Sync hash"
+
+// syncHashContent returns the content of lapsEntry written to an item,
+// a changed content changes the sync hash
+func syncHashContent(lapsEntry LapsEntry) string {
+	content := []string{
+		lapsEntry.Title(),
+		lapsEntry.Username(),
+		lapsEntry.password,
+		expirationDate(lapsEntry),
+		lapsEntry.guid,
+		lapsEntry.dn,
+		lapsEntry.source,
+		itemRulesContent(lapsEntry),
+	}
+	if getEnvBool("LDAP_SYNC_COMPUTER_INFO", false) {
+		for _, field := range computerInfoFields(lapsEntry) {
+			content = append(content, field.value)
+		}
+	}
+	if syncsHistory(lapsEntry) {
+		for _, field := range passwordHistoryFields(lapsEntry) {
+			content = append(content, field.label, field.value)
+		}
+	}
+	if IsBitLockerEnabled() {
+		for _, field := range bitlockerFields(lapsEntry) {
+			content = append(content, field.label, field.value)
+		}
+	}
+	return strings.Join(content, "\x00")
+}
+
+// computeSyncHash returns <salt>:<sha256 of salt and content> as hex
+func computeSyncHash(salt []byte, lapsEntry LapsEntry) string {
+	sum := sha256.Sum256(append(salt, []byte(syncHashContent(lapsEntry))...))
+	return hex.EncodeToString(salt) + ":" + hex.EncodeToString(sum[:])
+}
+
+// newSyncHash returns the sync hash of lapsEntry with a random salt
+func newSyncHash(lapsEntry LapsEntry) string {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return ""
+	}
+	return computeSyncHash(salt, lapsEntry)
+}
+
+// syncHashMatches returns true if hash was computed from the current
+// content of lapsEntry
+func syncHashMatches(hash string, lapsEntry LapsEntry) bool {
+	parts := strings.SplitN(hash, ":", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	return computeSyncHash(salt, lapsEntry) == hash
+}
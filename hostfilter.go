@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HostFilter decides by glob or regular expression patterns on the
+// dNSHostName if a computer is synced, e.g. for pilot rollouts
+type HostFilter struct {
+	include []hostPattern
+	exclude []hostPattern
+}
+
+// hostPattern is a case insensitive glob, or a regular expression if
+// written as /regex/
+type hostPattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// syncHostFilter is the HostFilter of the current run
+var syncHostFilter HostFilter
+
+// NewHostFilter compiles the semicolon separated patterns of SYNC_INCLUDE
+// and SYNC_EXCLUDE
+func NewHostFilter() (HostFilter, error) {
+	hostfilter := HostFilter{}
+	var err error
+	hostfilter.include, err = compileHostPatterns("SYNC_INCLUDE")
+	if err != nil {
+		return hostfilter, err
+	}
+	hostfilter.exclude, err = compileHostPatterns("SYNC_EXCLUDE")
+	if err != nil {
+		return hostfilter, err
+	}
+	return hostfilter, nil
+}
+
+// compileHostPatterns compiles all patterns of a list environment variable
+func compileHostPatterns(key string) ([]hostPattern, error) {
+	patterns := []hostPattern{}
+	for _, pattern := range getEnvList(key, ";") {
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			re, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+			if err != nil {
+				return patterns, fmt.Errorf("invalid pattern %s in %s: %v", pattern, key, err)
+			}
+			patterns = append(patterns, hostPattern{re: re})
+		} else {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return patterns, fmt.Errorf("invalid pattern %s in %s: %v", pattern, key, err)
+			}
+			patterns = append(patterns, hostPattern{glob: strings.ToLower(pattern)})
+		}
+		log.Debug("compileHostPatterns: ", key, " contains ", pattern)
+	}
+	return patterns, nil
+}
+
+// match returns true if hostname matches the pattern
+func (p hostPattern) match(hostname string) bool {
+	if p.re != nil {
+		return p.re.MatchString(hostname)
+	}
+	matched, _ := path.Match(p.glob, strings.ToLower(hostname))
+	return matched
+}
+
+// Enabled returns true if any pattern is configured
+func (f HostFilter) Enabled() bool {
+	return len(f.include) > 0 || len(f.exclude) > 0
+}
+
+// Match returns true if hostname matches any include pattern (or none are
+// configured) and no exclude pattern
+func (f HostFilter) Match(hostname string) bool {
+	included := len(f.include) == 0
+	for _, p := range f.include {
+		if p.match(hostname) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, p := range f.exclude {
+		if p.match(hostname) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchTitle returns true if the computer of an item title is synced, items
+// of filtered computers are neither missing nor orphaned
+func (f HostFilter) MatchTitle(title string) bool {
+	return f.Match(strings.TrimSuffix(title, dsrmTitleSuffix))
+}
+
+// FilterLapsEntries returns the lapsentries whose dNSHostName matches f
+func (f HostFilter) FilterLapsEntries(lapsentries []LapsEntry) []LapsEntry {
+	if !f.Enabled() {
+		return lapsentries
+	}
+	selected := []LapsEntry{}
+	for _, lapsentry := range lapsentries {
+		if f.Match(lapsentry.dnshostname) {
+			selected = append(selected, lapsentry)
+		} else {
+			log.Trace("FilterLapsEntries: Skipped filtered ", lapsentry.dnshostname)
+		}
+	}
+	log.Info("FilterLapsEntries: Selected ", len(selected), " of ", len(lapsentries), " computers by SYNC_INCLUDE and SYNC_EXCLUDE")
+	return selected
+}
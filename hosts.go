@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// syncHosts restricts the current run to these computers, empty for all
+var syncHosts []string
+
+// isPartialRun returns true if the current run doesn't read all computers,
+// orphaned items and deleted computers can't be detected then
+func isPartialRun() bool {
+	return syncState.incrementalSince > 0 || len(syncHosts) > 0 || syncState.skippedHosts > 0 || syncState.unresolved > 0
+}
+
+// hostsFilter restricts filter to the computers of syncHosts by dNSHostName or name
+func hostsFilter(filter string, attrs LapsAttributes) string {
+	hosts := ""
+	for _, host := range syncHosts {
+		hosts += fmt.Sprintf("(%s=%s)(%s=%s)", attrs.DNSHostName, ldap.EscapeFilter(host), attrs.Name, ldap.EscapeFilter(host))
+	}
+	return fmt.Sprintf("(&%s(|%s))", filter, hosts)
+}
+
+// isSyncHost returns true if lapsEntry is one of syncHosts or no hosts are selected
+func isSyncHost(lapsEntry LapsEntry) bool {
+	if len(syncHosts) == 0 {
+		return true
+	}
+	for _, host := range syncHosts {
+		if strings.EqualFold(host, lapsEntry.dnshostname) || strings.EqualFold(host, lapsEntry.name) {
+			return true
+		}
+	}
+	return false
+}
+
+// missingHosts returns the syncHosts without an entry in lapsentries
+func missingHosts(lapsentries []LapsEntry) []string {
+	missing := []string{}
+	for _, host := range syncHosts {
+		found := false
+		for _, lapsentry := range lapsentries {
+			if strings.EqualFold(host, lapsentry.dnshostname) || strings.EqualFold(host, lapsentry.name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, host)
+		}
+	}
+	return missing
+}
+
+// hostsFlag is the repeatable --host flag of sync, a value may also hold
+// several comma separated hosts
+type hostsFlag []string
+
+func (f *hostsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *hostsFlag) Set(value string) error {
+	for _, host := range strings.Split(value, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			*f = append(*f, host)
+		}
+	}
+	return nil
+}
+
+// flag_hosts are the computers given with --host
+var flag_hosts hostsFlag
+
+// readHosts returns hosts with - replaced by the hostnames read from
+// stdin, separated by newlines or spaces
+func readHosts(hosts []string, stdin io.Reader) ([]string, error) {
+	result := []string{}
+	for _, host := range hosts {
+		if host != "-" {
+			result = append(result, host)
+			continue
+		}
+		scanner := bufio.NewScanner(stdin)
+		scanner.Split(bufio.ScanWords)
+		for scanner.Scan() {
+			result = append(result, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("reading hosts from stdin: %v", err)
+		}
+		if len(result) == 0 {
+			return nil, fmt.Errorf("no hosts on stdin")
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// HostState is the sync state of one computer in the state file
+type HostState struct {
+	USNChanged int64             `json:"usnChanged,omitempty"` // of the domain controller read last
+	Hashes     map[string]string `json:"hashes"`               // sync hash of the content in each destination
+	Synced     time.Time         `json:"synced"`
+}
+
+// hostStateMutex guards syncState.Hosts against concurrent write workers
+var hostStateMutex sync.Mutex
+
+// IsSkipUnchanged returns true if SYNC_SKIP_UNCHANGED is enabled
+func IsSkipUnchanged() bool {
+	return getEnvBool("SYNC_SKIP_UNCHANGED", false)
+}
+
+// GetFullSyncInterval returns SYNC_FULL_INTERVAL, the maximum time between
+// two runs syncing all computers with SYNC_SKIP_UNCHANGED
+func GetFullSyncInterval() time.Duration {
+	return getEnvDuration("SYNC_FULL_INTERVAL", 24*time.Hour)
+}
+
+// readUSNChanged sets the uSNChanged of entry on lapsEntry
+func readUSNChanged(lapsEntry *LapsEntry, entry *ldap.Entry) {
+	lapsEntry.usn, _ = strconv.ParseInt(entry.GetAttributeValue("uSNChanged"), 10, 64)
+}
+
+// recordHostState notes that destination holds the current content of
+// lapsEntry, so the next run can skip it
+func recordHostState(destination string, lapsEntry LapsEntry) {
+	if !IsSkipUnchanged() {
+		return
+	}
+	hostStateMutex.Lock()
+	defer hostStateMutex.Unlock()
+	if syncState.Hosts == nil {
+		syncState.Hosts = map[string]HostState{}
+	}
+	key := strings.ToLower(lapsEntry.Title())
+	state := syncState.Hosts[key]
+	if state.Hashes == nil {
+		state.Hashes = map[string]string{}
+	}
+	state.USNChanged = lapsEntry.usn
+	state.Hashes[destination] = newSyncHash(lapsEntry)
+	state.Synced = time.Now()
+	syncState.Hosts[key] = state
+}
+
+// isHostUnchanged returns true if all destinations hold the current
+// content of lapsEntry according to the state file
+func isHostUnchanged(lapsEntry LapsEntry) bool {
+	hostStateMutex.Lock()
+	defer hostStateMutex.Unlock()
+	state, found := syncState.Hosts[strings.ToLower(lapsEntry.Title())]
+	if !found {
+		return false
+	}
+	for _, destination := range GetDestinations() {
+		if !syncHashMatches(state.Hashes[destination], lapsEntry) {
+			return false
+		}
+	}
+	return true
+}
+
+// SkipUnchangedHosts returns the entries which changed since they were
+// written last, without asking the destinations. Every SYNC_FULL_INTERVAL
+// all entries are returned, so orphans are found and manual edits in the
+// destinations are overwritten.
+func SkipUnchangedHosts(lapsentries []LapsEntry) []LapsEntry {
+	if !IsSkipUnchanged() {
+		return lapsentries
+	}
+	if time.Since(syncState.LastFullSync) >= GetFullSyncInterval() {
+		log.Info("SkipUnchangedHosts: Full sync due, last one at ", syncState.LastFullSync.Format(time.RFC3339))
+		return lapsentries
+	}
+	changed := []LapsEntry{}
+	for _, lapsentry := range lapsentries {
+		if isHostUnchanged(lapsentry) {
+			log.Trace("SkipUnchangedHosts: Unchanged ", lapsentry.Title(), ", skipped")
+			syncState.skippedHosts++
+			summary.addItem(itemResult{Title: lapsentry.Title(), Action: "skipped", Reason: "unchanged since the last sync"})
+			continue
+		}
+		changed = append(changed, lapsentry)
+	}
+	summary.add("unchanged", syncState.skippedHosts)
+	log.Info("SkipUnchangedHosts: Skipped ", syncState.skippedHosts, " unchanged computers, ", len(changed), " to sync")
+	return changed
+}
+
+// pruneHostStates removes the computers not synced by the full run
+// started at started, they are gone or failed
+func pruneHostStates(started time.Time) {
+	hostStateMutex.Lock()
+	defer hostStateMutex.Unlock()
+	for key, state := range syncState.Hosts {
+		if state.Synced.Before(started) {
+			delete(syncState.Hosts, key)
+		}
+	}
+}
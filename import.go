@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// lapsModeImport is the LapsEntry source of imported passwords
+const lapsModeImport = "import"
+
+// importTag is set on imported items
+const importTag = "imported"
+
+// importColumns maps the lowercase column names of LAPS-UI, KeePass and
+// our own export files to the LapsEntry attribute they hold
+var importColumns = map[string]string{
+	"hostname":                         "hostname",
+	"computername":                     "hostname",
+	"computer":                         "hostname",
+	"dnshostname":                      "hostname",
+	"title":                            "hostname", // KeePass
+	"username":                         "username",
+	"user name":                        "username",
+	"account":                          "username",
+	"password":                         "password",
+	"ms-mcs-admpwd":                    "password",
+	"expiration":                       "expiration",
+	"expirationtime":                   "expiration",
+	"ms-mcs-admpwdexpirationtime":      "expiration",
+	"mslaps-passwordexpirationtime":    "expiration",
+	"password expiration":              "expiration",
+	"dn":                               "dn",
+	"distinguishedname":                "dn",
+	"guid":                             "guid",
+	"objectguid":                       "guid",
+	"last modified":                    "updated", // KeePass
+	"updated":                          "updated",
+	"mslaps-passwordupdatetime":        "updated",
+	"ms-mcs-admpwd-passwordupdatetime": "updated",
+}
+
+// importTimeLayouts are the accepted formats of dates in import files
+var importTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02", "02.01.2006 15:04:05", "02.01.2006", "1/2/2006 3:04:05 PM", "1/2/2006"}
+
+// parseImportTime parses a date of an import file, FILETIME values of raw
+// ldap exports are accepted too
+func parseImportTime(value string) (time.Time, error) {
+	if filetime, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return getTimeFromFiletime(filetime), nil
+	}
+	for _, layout := range importTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format %q", value)
+}
+
+// readImportCSV returns the entries of a CSV file with a header line, the
+// columns are mapped by importColumns and others are ignored
+func readImportCSV(r io.Reader) ([]LapsEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 1 {
+		return nil, fmt.Errorf("no header line")
+	}
+	columns := map[string]int{}
+	for cur_idx, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if attr, found := importColumns[name]; found {
+			if _, exists := columns[attr]; !exists {
+				columns[attr] = cur_idx
+			}
+		}
+	}
+	for _, attr := range []string{"hostname", "password"} {
+		if _, found := columns[attr]; !found {
+			return nil, fmt.Errorf("no %s column", attr)
+		}
+	}
+
+	lapsentries := []LapsEntry{}
+	for line, record := range records[1:] {
+		value := func(attr string) string {
+			cur_idx, found := columns[attr]
+			if !found || cur_idx >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[cur_idx])
+		}
+		hostname := value("hostname")
+		if hostname == "" || value("password") == "" {
+			log.Warn("readImportCSV: Skipped line ", line+2, " without hostname or password")
+			continue
+		}
+		registerSecret(value("password"))
+		lapsentry := LapsEntry{
+			name:            strings.ToUpper(strings.SplitN(hostname, ".", 2)[0]),
+			dnshostname:     hostname,
+			account:         value("username"),
+			source:          lapsModeImport,
+			password:        value("password"),
+			dn:              value("dn"),
+			guid:            value("guid"),
+			expirationstate: expirationUnknown,
+		}
+		if expiration := value("expiration"); expiration != "" {
+			lapsentry.expiration, err = parseImportTime(expiration)
+			if err != nil {
+				log.Warn("readImportCSV: Line ", line+2, ": ", err)
+			} else {
+				lapsentry.expirationstate = expirationKnown
+			}
+		}
+		if updated := value("updated"); updated != "" {
+			lapsentry.updated, _ = parseImportTime(updated)
+		}
+		lapsentries = append(lapsentries, lapsentry)
+	}
+	return lapsentries, nil
+}
+
+// readImportKDBX exports a KeePass database with keepassxc-cli
+// (KEEPASSXC_CLI_PATH) as CSV, the database is unlocked with KDBX_PASSWORD
+// and the optional KDBX_KEY_FILE
+func readImportKDBX(path string) ([]LapsEntry, error) {
+	cli, err := exec.LookPath(getEnv("KEEPASSXC_CLI_PATH", "keepassxc-cli"))
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"export", "--format", "csv", "--quiet"}
+	if keyFile := os.Getenv("KDBX_KEY_FILE"); keyFile != "" {
+		args = append(args, "--key-file", keyFile)
+	}
+	if os.Getenv("KDBX_PASSWORD") == "" {
+		args = append(args, "--no-password")
+	}
+	cmd := exec.Command(cli, append(args, path)...)
+	cmd.Stdin = strings.NewReader(os.Getenv("KDBX_PASSWORD") + "\n")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("keepassxc-cli export failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return readImportCSV(&stdout)
+}
+
+// ReadImportFile returns the entries of a CSV or KeePass (.kdbx) file
+func ReadImportFile(path string) ([]LapsEntry, error) {
+	if strings.EqualFold(filepath.Ext(path), ".kdbx") {
+		return readImportKDBX(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readImportCSV(file)
+}
+
+// ImportOnePassEntries creates an archived item tagged as imported in
+// OP_ORPHAN_ARCHIVE_VAULT for every entry of the CSV or KeePass file path,
+// e.g. to keep the passwords of computers decommissioned before the first
+// sync. Entries with an item of the same title in the vault are skipped.
+func ImportOnePassEntries(ctx context.Context, path string) error {
+	lapsentries, err := ReadImportFile(path)
+	if err != nil {
+		log.Error("ImportOnePassEntries: ", path, ": ", err)
+		return err
+	}
+	log.Info("ImportOnePassEntries: Read ", len(lapsentries), " entries from ", path)
+
+	client, err := NewOnePassClient()
+	if err != nil {
+		log.Error("ImportOnePassEntries: ", err)
+		return err
+	}
+	vault, err := getVault(client, os.Getenv("OP_ORPHAN_ARCHIVE_VAULT"))
+	if err != nil {
+		log.Error("ImportOnePassEntries: ", err)
+		return err
+	}
+	existing, err := client.GetItems(vault.ID)
+	if err != nil {
+		log.Error("ImportOnePassEntries: ", err)
+		return err
+	}
+	titles := map[string]bool{}
+	for _, item := range existing {
+		titles[strings.ToLower(item.Title)] = true
+	}
+
+	jobs := []writeJob{}
+	_skipped_total := 0
+	for _, lapsentry := range lapsentries {
+		if titles[strings.ToLower(lapsentry.Title())] {
+			log.Debug("ImportOnePassEntries: Skipped ", lapsentry.Title(), ", already in ", vault.Name)
+			_skipped_total++
+			continue
+		}
+		titles[strings.ToLower(lapsentry.Title())] = true
+		if flag_dry_run {
+			printDryRun("+", lapsentry.Title(), "import into "+vault.Name)
+			continue
+		}
+		jobs = append(jobs, writeJob{title: lapsentry.Title(), kind: "created", destination: destinationOnePassword, vault: vault.ID, reason: "import of " + filepath.Base(path), write: func() error {
+			opitem, err := newOnePassItem(lapsentry, vault.ID)
+			if err != nil {
+				return err
+			}
+			setItemTag(&opitem, importTag, true)
+			_, err = client.CreateItem(&opitem, vault.ID)
+			return err
+		}})
+	}
+	if len(jobs) > 0 && !confirm(fmt.Sprintf("Import %d items into %s?", len(jobs), vault.Name)) {
+		return fmt.Errorf("aborted")
+	}
+	results := runWriteJobs(ctx, jobs)
+	err = writeErrors(results)
+	log.Infof("ImportOnePassEntries: Total imported=%d skipped=%d failed=%d interrupted=%d", len(jobs)-countFailed(results)-countInterrupted(results), _skipped_total, countFailed(results), countInterrupted(results))
+	if err != nil {
+		log.Error("ImportOnePassEntries: ", err)
+	}
+	return err
+}
+
+// countFailed returns the number of failed results, interrupted ones
+// aren't counted
+func countFailed(results []writeResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.err != nil && result.err != errInterrupted {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// getHighestCommittedUSN reads dnsHostName (dsServiceName on AD LDS) and
+// highestCommittedUSN of the connected domain controller from the RootDSE
+func getHighestCommittedUSN(ldapCON *ldap.Conn) (string, int64, error) {
+	searchReq := ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)", []string{"dnsHostName", "dsServiceName", "highestCommittedUSN"}, nil)
+	result, err := ldapCON.Search(searchReq)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(result.Entries) != 1 {
+		return "", 0, fmt.Errorf("unexpected RootDSE result with %d entries", len(result.Entries))
+	}
+	server := result.Entries[0].GetAttributeValue("dnsHostName")
+	if IsADLDS() {
+		// several AD LDS instances can run on one host
+		server = result.Entries[0].GetAttributeValue("dsServiceName")
+	}
+	usn, err := strconv.ParseInt(result.Entries[0].GetAttributeValue("highestCommittedUSN"), 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("can't read highestCommittedUSN: %v", err)
+	}
+	return server, usn, nil
+}
+
+// incrementalFilter restricts filter to objects changed since the last
+// successful run against the same domain controller. USNs are local to a
+// domain controller, so a run against another server is a full run.
+func incrementalFilter(ldapCON *ldap.Conn, filter string) (string, error) {
+	server, usn, err := getHighestCommittedUSN(ldapCON)
+	if err != nil {
+		if IsSamba() {
+			// tolerate RootDSEs without the operational attributes
+			log.Warn("incrementalFilter: Can't read watermark, full run: ", err)
+			return filter, nil
+		}
+		return filter, err
+	}
+	syncState.pendingServer = server
+	syncState.pendingUSN = usn
+
+	lastUSN, found := syncState.HighestUSN[server]
+	if !found {
+		log.Info("incrementalFilter: No watermark for ", server, ", full run")
+		return filter, nil
+	}
+	log.Info("incrementalFilter: Reading changes on ", server, " since USN ", lastUSN)
+	syncState.incrementalSince = lastUSN + 1
+	return fmt.Sprintf("(&%s(uSNChanged>=%d))", filter, lastUSN+1), nil
+}
+
+// IsIncremental returns true if LDAP_INCREMENTAL is enabled
+func IsIncremental() bool {
+	return getEnvBool("LDAP_INCREMENTAL", false)
+}
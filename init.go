@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/mattn/go-colorable"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultInitConfigFile is the config file written by init without a path
+const defaultInitConfigFile = "laps2onepassword.yaml"
+
+// initConfig is the config file written by init
+type initConfig struct {
+	Ldap struct {
+		URL          string `yaml:"url"`
+		AuthCN       string `yaml:"auth_cn"`
+		AuthPW       string `yaml:"auth_pw,omitempty"`
+		SearchBaseDN string `yaml:"search_basedn"`
+		SearchFilter string `yaml:"search_filter"`
+	} `yaml:"ldap"`
+	Laps struct {
+		Mode string `yaml:"mode"`
+	} `yaml:"laps"`
+	Op struct {
+		ConnectHost  string `yaml:"connect_host"`
+		ConnectToken string `yaml:"connect_token,omitempty"`
+		VaultTitle   string `yaml:"vault_title"`
+	} `yaml:"op"`
+}
+
+// wizard prompts for the settings of init and tests them as it goes
+type wizard struct {
+	in  *bufio.Reader
+	d   *doctor
+	eof bool // stdin is closed, nothing can be entered again
+}
+
+// ask prompts for a value, def is used for an empty answer
+func (w *wizard) ask(question string, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, err := w.in.ReadString('\n')
+	if err != nil {
+		w.eof = true
+		fmt.Println()
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def
+	}
+	return answer
+}
+
+// askSecret prompts for a value without echo if stdin is a terminal
+func (w *wizard) askSecret(question string) string {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return w.ask(question, "")
+	}
+	fmt.Printf("%s: ", question)
+	value, _ := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	return string(value)
+}
+
+// yes prompts for a yes or no answer, def is used for an empty answer
+func (w *wizard) yes(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer := strings.ToLower(w.ask(question+" ["+hint+"]", ""))
+	if w.eof {
+		return false
+	}
+	if answer == "" {
+		return def
+	}
+	return answer == "y" || answer == "yes"
+}
+
+// retry prints the result of a test and returns true if it failed and the
+// admin wants to enter the value again
+func (w *wizard) retry(c doctorCheck) bool {
+	if w.d.check(c) {
+		return false
+	}
+	return w.yes("Enter it again?", true)
+}
+
+// RunInit prompts for the ldap and 1Password Connect settings, tests each
+// as it goes and writes them to the config file path. Credentials are
+// stored in the OS credential store or left to the environment, they are
+// never written to the file.
+func RunInit(ctx context.Context, path string) error {
+	if path == "" {
+		path = defaultInitConfigFile
+	}
+	w := &wizard{in: bufio.NewReader(os.Stdin), d: &doctor{out: colorable.NewColorableStdout()}}
+	if _, err := os.Stat(path); err == nil && !flag_yes && !w.yes(fmt.Sprintf("%s exists, overwrite it?", path), false) {
+		return errors.New("aborted, nothing written")
+	}
+	config := initConfig{}
+	fmt.Println("Settings are tested as you go, press Enter to accept the [default].")
+
+	// ldap server, bind and search base
+	var ldapCON *ldap.Conn
+	for {
+		config.Ldap.URL = w.ask("LDAP URL, e.g. ldaps://dc1.domain.loc:636", getEnv("LDAP_URL", ""))
+		os.Setenv("LDAP_URL", config.Ldap.URL)
+		// only the first server is tested
+		ldapURL := ""
+		if len(GetLdapURLs()) > 0 {
+			ldapURL = GetLdapURLs()[0]
+		}
+		u, err := url.Parse(ldapURL)
+		if err == nil && (u.Hostname() == "" || (u.Scheme != "ldap" && u.Scheme != "ldaps")) {
+			err = errors.New("expected ldap://host[:port] or ldaps://host[:port]")
+		}
+		if err == nil {
+			ldapCON, err = DialLdap(ldapURL)
+		}
+		if !w.retry(doctorCheck{name: "LDAP connect " + ldapURL, err: err, detail: "tls mode " + GetLdapTLSMode()}) {
+			break
+		}
+	}
+	bound := false
+	for {
+		config.Ldap.AuthCN = w.ask("Bind DN, e.g. CN=laps2onepassword,OU=Service Accounts,DC=domain,DC=loc", getEnv("LDAP_AUTH_CN", ""))
+		os.Setenv("LDAP_AUTH_CN", config.Ldap.AuthCN)
+		os.Setenv("LDAP_AUTH_PW", w.askSecret("Bind password"))
+		if ldapCON == nil {
+			w.d.skip("LDAP bind", "no ldap server connected")
+			break
+		}
+		err := BindLdap(ldapCON, ldapHost(GetLdapURLs()[0]))
+		bound = err == nil
+		if !w.retry(doctorCheck{name: "LDAP bind", err: err, detail: config.Ldap.AuthCN}) {
+			break
+		}
+	}
+	if ldapCON != nil {
+		defer ldapCON.Close()
+	}
+
+	config.Laps.Mode = w.ask("LAPS mode, legacy (ms-Mcs-AdmPwd) or windows (msLAPS-Password)", GetLapsMode())
+	os.Setenv("LAPS_MODE", config.Laps.Mode)
+	attrs := GetLapsAttributes(GetLapsMode())
+	if bound {
+		missing, err := missingSchemaAttributes(ldapCON, attrs.LapsList())
+		if err == nil && len(missing) > 0 {
+			err = fmt.Errorf("%s not in the schema, check the LAPS mode", strings.Join(missing, ", "))
+		}
+		w.d.check(doctorCheck{name: "LAPS schema", err: err, detail: strings.Join(attrs.LapsList(), ", ")})
+	}
+	config.Ldap.SearchFilter = getEnv("LDAP_SEARCH_FILTER", fmt.Sprintf("(&(objectClass=computer)(%s=*))", attrs.Expiration))
+	os.Setenv("LDAP_SEARCH_FILTER", config.Ldap.SearchFilter)
+	for {
+		config.Ldap.SearchBaseDN = w.ask("Search base DN, e.g. OU=Computers,DC=domain,DC=loc", getEnv("LDAP_SEARCH_BASEDN", ""))
+		os.Setenv("LDAP_SEARCH_BASEDN", config.Ldap.SearchBaseDN)
+		if !bound {
+			w.d.skip("LDAP search", "no ldap server bound")
+			break
+		}
+		if !w.retry(doctorCheck{name: "LDAP search", err: checkLdapSearch(ctx, ldapCON, attrs), detail: config.Ldap.SearchFilter}) {
+			break
+		}
+	}
+
+	// 1Password Connect server, token and vault
+	healthy := false
+	for {
+		config.Op.ConnectHost = w.ask("1Password Connect URL, e.g. https://connect.domain.loc:8443", getEnv("OP_CONNECT_HOST", ""))
+		os.Setenv("OP_CONNECT_HOST", config.Op.ConnectHost)
+		err := InstallConnectHTTPClient()
+		if err == nil {
+			err = checkConnectHealth()
+		}
+		healthy = err == nil
+		if !w.retry(doctorCheck{name: "1Password Connect health", err: err, detail: config.Op.ConnectHost}) {
+			break
+		}
+	}
+	vaults := []string{}
+	for healthy {
+		os.Setenv("OP_CONNECT_TOKEN", w.askSecret("1Password Connect token"))
+		client, err := NewOnePassClient()
+		if err == nil {
+			var accessible []onepassword.Vault
+			accessible, err = client.GetVaults()
+			vaults = []string{}
+			for _, vault := range accessible {
+				vaults = append(vaults, vault.Name)
+			}
+		}
+		if err != nil {
+			err = errors.New(describeOnePassError(err))
+		}
+		if !w.retry(doctorCheck{name: "1Password token", err: err, detail: fmt.Sprintf("%d vaults accessible", len(vaults))}) {
+			break
+		}
+	}
+	for {
+		if len(vaults) > 0 {
+			fmt.Println("Accessible vaults: " + strings.Join(vaults, ", "))
+		}
+		config.Op.VaultTitle = w.ask("Vault", getEnv("OP_VAULT_TITLE", "LAPS"))
+		if len(vaults) == 0 {
+			w.d.skip("1Password vault "+config.Op.VaultTitle, "no token")
+			break
+		}
+		var err error
+		if !containsString(vaults, config.Op.VaultTitle) {
+			err = fmt.Errorf("vault %s not accessible with this token", config.Op.VaultTitle)
+		}
+		if !w.retry(doctorCheck{name: "1Password vault " + config.Op.VaultTitle, err: err, detail: "readable, write access is checked by the first sync"}) {
+			break
+		}
+	}
+
+	// credentials
+	secrets := []string{}
+	for _, key := range []string{"LDAP_AUTH_PW", "OP_CONNECT_TOKEN"} {
+		if os.Getenv(key) != "" {
+			secrets = append(secrets, key)
+		}
+	}
+	if len(secrets) > 0 && w.yes(fmt.Sprintf("Store %s in the OS credential store?", strings.Join(secrets, " and ")), true) {
+		for _, key := range secrets {
+			err := keyring.Set(GetKeyringService(), key, os.Getenv(key))
+			if !w.d.check(doctorCheck{name: "Keyring " + key, err: err, detail: "service " + GetKeyringService()}) {
+				continue
+			}
+			if key == "LDAP_AUTH_PW" {
+				config.Ldap.AuthPW = keyringPrefix
+			} else {
+				config.Op.ConnectToken = keyringPrefix
+			}
+		}
+	}
+
+	if w.eof {
+		return errors.New("input ended before all settings were entered, nothing written")
+	}
+
+	var data bytes.Buffer
+	fmt.Fprintf(&data, "# Written by laps2onepassword init on %s, see config.example.yaml for all settings\n", time.Now().Format(time.DateOnly))
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	err := encoder.Encode(config)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, data.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", path)
+	if config.Ldap.AuthPW == "" || config.Op.ConnectToken == "" {
+		fmt.Println("Set LDAP_AUTH_PW and OP_CONNECT_TOKEN in the environment, .env or LDAP_AUTH_PW_FILE and OP_CONNECT_TOKEN_FILE, credentials are not written to the config file")
+	}
+	fmt.Printf("Check everything with: laps2onepassword --config %s check-config\n", path)
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+	"github.com/google/uuid"
+)
+
+// itemField is a labeled value written into an item section
+type itemField struct {
+	label     string
+	value     string
+	fieldType string
+}
+
+// setItemTag adds tag to or removes it from item
+func setItemTag(item *onepassword.Item, tag string, present bool) {
+	tags := []string{}
+	for _, t := range item.Tags {
+		if t != tag {
+			tags = append(tags, t)
+		}
+	}
+	if present {
+		tags = append(tags, tag)
+	}
+	item.Tags = tags
+}
+
+// getItemFieldByPurpose returns the field with purpose (USERNAME, PASSWORD or
+// NOTES), a new field is added to item if missing
+func getItemFieldByPurpose(item *onepassword.Item, purpose string, label string) *onepassword.ItemField {
+	for _, field := range item.Fields {
+		if field.Purpose == purpose {
+			return field
+		}
+	}
+	field := &onepassword.ItemField{ID: uuid.New().String(), Type: "STRING", Purpose: purpose, Label: label}
+	if purpose == "NOTES" {
+		field.ID = "notesPlain"
+	}
+	item.Fields = append(item.Fields, field)
+	return field
+}
+
+// usesPurposeFields returns true if the username and password of item are
+// stored in USERNAME and PASSWORD purpose fields, which only LOGIN items have
+func usesPurposeFields(item onepassword.Item) bool {
+	return item.Category == onepassword.Login || item.Category == ""
+}
+
+// getItemCredentialField returns the field of item with purpose USERNAME,
+// PASSWORD or NOTES. Categories other than LOGIN (e.g. SERVER) keep username
+// and password in the built-in fields "username" and "password", PASSWORD
+// items only have a PASSWORD purpose field. Missing fields are added.
+func getItemCredentialField(item *onepassword.Item, purpose string, label string) *onepassword.ItemField {
+	if usesPurposeFields(*item) || purpose == "NOTES" || (purpose == "PASSWORD" && item.Category == onepassword.Password) {
+		return getItemFieldByPurpose(item, purpose, label)
+	}
+	id := strings.ToLower(purpose)
+	for _, field := range item.Fields {
+		if field.ID == id && field.Section == nil {
+			return field
+		}
+	}
+	field := &onepassword.ItemField{ID: id, Type: "STRING", Label: label}
+	if purpose == "PASSWORD" {
+		field.Type = "CONCEALED"
+	}
+	item.Fields = append(item.Fields, field)
+	return field
+}
+
+// getItemCredential returns the value of the USERNAME or PASSWORD of item,
+// see getItemCredentialField
+func getItemCredential(item onepassword.Item, purpose string) string {
+	if usesPurposeFields(item) || (purpose == "PASSWORD" && item.Category == onepassword.Password) {
+		for _, field := range item.Fields {
+			if field.Purpose == purpose {
+				return field.Value
+			}
+		}
+		return ""
+	}
+	for _, field := range item.Fields {
+		if field.ID == strings.ToLower(purpose) && field.Section == nil {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// syncSectionID identifies the item section holding laps2onepassword metadata
+const syncSectionID = "laps2onepassword"
+
+// getItemSectionValue returns the value of the field labeled label in section sectionID
+func getItemSectionValue(item onepassword.Item, sectionID string, label string) string {
+	for _, field := range item.Fields {
+		if field.Section != nil && field.Section.ID == sectionID && field.Label == label {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// getItemSection returns the section with sectionID, it is added to item if missing
+func getItemSection(item *onepassword.Item, sectionID string, sectionLabel string) *onepassword.ItemSection {
+	for _, section := range item.Sections {
+		if section.ID == sectionID {
+			return section
+		}
+	}
+	section := &onepassword.ItemSection{ID: sectionID, Label: sectionLabel}
+	item.Sections = append(item.Sections, section)
+	return section
+}
+
+// setItemSectionFields updates the fields of a section by label, missing
+// fields are appended and fields with an empty value are removed
+func setItemSectionFields(item *onepassword.Item, sectionID string, sectionLabel string, fields []itemField) {
+	section := getItemSection(item, sectionID, sectionLabel)
+	for _, field := range fields {
+		fieldType := field.fieldType
+		if fieldType == "" {
+			fieldType = "STRING"
+		}
+		found := false
+		for index, itemfield := range item.Fields {
+			if itemfield.Section == nil || itemfield.Section.ID != sectionID || itemfield.Label != field.label {
+				continue
+			}
+			found = true
+			if field.value == "" {
+				item.Fields = append(item.Fields[:index], item.Fields[index+1:]...)
+			} else {
+				itemfield.Value = field.value
+				itemfield.Type = fieldType
+			}
+			break
+		}
+		if !found && field.value != "" {
+			item.Fields = append(item.Fields, &onepassword.ItemField{
+				ID:      uuid.New().String(),
+				Section: &onepassword.ItemSection{ID: section.ID},
+				Type:    fieldType,
+				Label:   field.label,
+				Value:   field.value,
+			})
+		}
+	}
+}
+
+// replaceItemSectionFields removes all fields of a section and adds fields
+func replaceItemSectionFields(item *onepassword.Item, sectionID string, sectionLabel string, fields []itemField) {
+	kept := []*onepassword.ItemField{}
+	for _, itemfield := range item.Fields {
+		if itemfield.Section == nil || itemfield.Section.ID != sectionID {
+			kept = append(kept, itemfield)
+		}
+	}
+	item.Fields = kept
+	setItemSectionFields(item, sectionID, sectionLabel, fields)
+}
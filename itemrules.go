@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+)
+
+// ItemRule selects computers by being a domain controller (dc), by their DN
+// (dn:<regex>) or by their hostname (host:<regex>), value is the optional
+// part after =>
+type ItemRule struct {
+	field   string // dc, dn or host
+	pattern *regexp.Regexp
+	value   string
+}
+
+// parseItemRules parses the semicolon separated rules in key, each rule is
+// dc, dn:<regex> or host:<regex> with case insensitive regular expressions,
+// followed by =><value> if withValue is set
+func parseItemRules(key string, withValue bool) ([]ItemRule, error) {
+	rules := []ItemRule{}
+	for _, text := range getEnvList(key, ";") {
+		rule := ItemRule{}
+		selector := text
+		if withValue {
+			parts := strings.SplitN(text, "=>", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+				return rules, fmt.Errorf("invalid rule %s in %s, expected <selector>=><value>", text, key)
+			}
+			selector = parts[0]
+			rule.value = strings.TrimSpace(parts[1])
+		}
+		fieldPattern := strings.SplitN(strings.TrimSpace(selector), ":", 2)
+		rule.field = strings.ToLower(fieldPattern[0])
+		switch {
+		case rule.field == "dc" && len(fieldPattern) == 1:
+		case (rule.field == "dn" || rule.field == "host") && len(fieldPattern) == 2:
+			pattern, err := regexp.Compile("(?i)" + fieldPattern[1])
+			if err != nil {
+				return rules, fmt.Errorf("invalid pattern in rule %s in %s: %v", text, key, err)
+			}
+			rule.pattern = pattern
+		default:
+			return rules, fmt.Errorf("invalid rule %s in %s, expected dc, dn:<pattern> or host:<pattern>", text, key)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Match returns true if lapsEntry is selected by the rule
+func (r ItemRule) Match(lapsEntry LapsEntry) bool {
+	switch r.field {
+	case "dc":
+		return lapsEntry.dc
+	case "dn":
+		return r.pattern.MatchString(lapsEntry.dn)
+	default:
+		return r.pattern.MatchString(lapsEntry.dnshostname)
+	}
+}
+
+// GetFavoriteRules returns the OP_FAVORITES rules of items marked as favorite
+func GetFavoriteRules() ([]ItemRule, error) {
+	return parseItemRules("OP_FAVORITES", false)
+}
+
+// GetIconURLRules returns the OP_ICON_URLS rules, the value is the url
+// template used as primary url, 1Password shows the icon of its website
+func GetIconURLRules() ([]ItemRule, error) {
+	return parseItemRules("OP_ICON_URLS", true)
+}
+
+// itemRulesNeedDC returns true if a rule selects domain controllers, which
+// requires reading userAccountControl
+func itemRulesNeedDC() bool {
+	favorites, _ := GetFavoriteRules()
+	icons, _ := GetIconURLRules()
+	safes, _ := GetCyberArkSafeRules()
+	for _, rule := range append(append(favorites, icons...), safes...) {
+		if rule.field == "dc" {
+			return true
+		}
+	}
+	return false
+}
+
+// isFavorite returns true if an OP_FAVORITES rule matches lapsEntry
+func isFavorite(lapsEntry LapsEntry) bool {
+	rules, _ := GetFavoriteRules()
+	for _, rule := range rules {
+		if rule.Match(lapsEntry) {
+			return true
+		}
+	}
+	return false
+}
+
+// iconURL returns the rendered url of the first OP_ICON_URLS rule matching
+// lapsEntry, empty if none matches
+func iconURL(lapsEntry LapsEntry) (string, error) {
+	rules, _ := GetIconURLRules()
+	for _, rule := range rules {
+		if rule.Match(lapsEntry) {
+			urls, err := renderTemplates("OP_ICON_URLS", []string{rule.value}, lapsEntry)
+			if err != nil || len(urls) == 0 {
+				return "", err
+			}
+			return urls[0], nil
+		}
+	}
+	return "", nil
+}
+
+// itemRulesContent returns the favorite and icon url of lapsEntry for the sync hash
+func itemRulesContent(lapsEntry LapsEntry) string {
+	url, _ := iconURL(lapsEntry)
+	return strconv.FormatBool(isFavorite(lapsEntry)) + url
+}
+
+// setItemFavoriteAndIcon marks item as favorite and sets its primary url by
+// the OP_FAVORITES and OP_ICON_URLS rules. Favorites set by users are kept.
+func setItemFavoriteAndIcon(item *onepassword.Item, lapsEntry LapsEntry) error {
+	if isFavorite(lapsEntry) {
+		item.Favorite = true
+	}
+	url, err := iconURL(lapsEntry)
+	if err != nil {
+		return fmt.Errorf("OP_ICON_URLS: %v", err)
+	}
+	if url == "" {
+		return nil
+	}
+	urls := []onepassword.ItemURL{{URL: url, Primary: true}}
+	for _, itemurl := range item.URLs {
+		if itemurl.URL != url {
+			urls = append(urls, onepassword.ItemURL{URL: itemurl.URL})
+		}
+	}
+	item.URLs = urls
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// keyringPrefix marks a credential setting read from the OS credential store,
+// e.g. LDAP_AUTH_PW=keyring: or OP_CONNECT_TOKEN=keyring:op-token
+const keyringPrefix = "keyring:"
+
+// GetKeyringService returns KEYRING_SERVICE, the service name of the
+// credentials in the OS credential store
+func GetKeyringService() string {
+	return getEnv("KEYRING_SERVICE", "laps2onepassword")
+}
+
+// keyringUser returns the account name of the credential key with the
+// setting value, the name after keyring: or the key itself
+func keyringUser(key string, value string) string {
+	if user := strings.TrimPrefix(value, keyringPrefix); user != "" {
+		return user
+	}
+	return key
+}
+
+// loadKeyringSecrets replaces each credential of secretEnvKeys set to
+// keyring:[name] with the secret stored in the Windows Credential Manager,
+// the macOS Keychain or the Secret Service (gnome-keyring, KWallet)
+func loadKeyringSecrets() error {
+	for _, key := range secretEnvKeys {
+		value := os.Getenv(key)
+		if !strings.HasPrefix(value, keyringPrefix) {
+			continue
+		}
+		user := keyringUser(key, value)
+		secret, err := keyring.Get(GetKeyringService(), user)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return fmt.Errorf("%s: %s not found in the keyring of service %s, store it with keyring-set %s", key, user, GetKeyringService(), key)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		os.Setenv(key, secret)
+	}
+	return nil
+}
+
+// SetKeyringSecret prompts for the value of the credential key and stores
+// it in the OS credential store
+func SetKeyringSecret(key string) error {
+	if !containsString(secretEnvKeys, key) {
+		return fmt.Errorf("usage: keyring-set <setting>, one of %s", strings.Join(secretEnvKeys, ", "))
+	}
+	user := keyringUser(key, os.Getenv(key))
+	fmt.Printf("%s: ", key)
+	value, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return errors.New("empty value, nothing stored")
+	}
+	err = keyring.Set(GetKeyringService(), user, string(value))
+	if err != nil {
+		return err
+	}
+	setting := keyringPrefix
+	if user != key {
+		setting += user
+	}
+	fmt.Printf("Stored %s in the keyring of service %s, set %s=%s in .env\n", user, GetKeyringService(), key, setting)
+	return nil
+}
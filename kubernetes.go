@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exitFailures is the exit code of a daemon stopped after
+// MAX_CONSECUTIVE_FAILURES failed runs
+const exitFailures = 9
+
+// runHealth is the state reported by the probe endpoints
+var runHealth = struct {
+	sync.Mutex
+	ready    bool // the last run succeeded
+	failures int  // consecutive failed runs
+}{}
+
+// IsKubernetesMode returns whether --kubernetes or KUBERNETES_MODE is set:
+// the settings are only read from the environment and mounted secrets (no
+// .env), logs are written as JSON to stdout only and the daemon serves
+// probes on PROBE_LISTEN
+func IsKubernetesMode() bool {
+	return flag_kubernetes || getEnvBool("KUBERNETES_MODE", false)
+}
+
+// initKubernetesLogger writes JSON logs to stdout, the level is taken from
+// LOG_LEVEL unless --loglevel is given
+func initKubernetesLogger() {
+	log.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339})
+	log.SetOutput(os.Stdout)
+	if level, err := log.ParseLevel(os.Getenv("LOG_LEVEL")); err == nil && !isFlagSet("loglevel") {
+		log.SetLevel(level)
+	}
+}
+
+// isFlagSet returns whether the command line flag name was given
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// GetMaxConsecutiveFailures returns MAX_CONSECUTIVE_FAILURES, the number of
+// failed runs in a row after which the daemon exits (0 = never)
+func GetMaxConsecutiveFailures() int {
+	return getEnvInt("MAX_CONSECUTIVE_FAILURES", 0)
+}
+
+// isFailedRun returns whether code counts as a failed run, verify drift
+// and skipped runs don't
+func isFailedRun(code int) bool {
+	switch code {
+	case exitOK, exitDrift, exitLocked, exitInterrupted:
+		return false
+	}
+	return true
+}
+
+// recordRunResult updates the probe state with the exit code of a run and
+// returns the number of consecutive failed runs
+func recordRunResult(code int) int {
+	runHealth.Lock()
+	defer runHealth.Unlock()
+	if isFailedRun(code) {
+		runHealth.failures++
+		runHealth.ready = false
+	} else {
+		runHealth.failures = 0
+		runHealth.ready = true
+	}
+	return runHealth.failures
+}
+
+// handleReady answers the readiness probe, 200 once a run succeeded and
+// 503 before and after a failed run
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	runHealth.Lock()
+	ready, failures := runHealth.ready, runHealth.failures
+	runHealth.Unlock()
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not ready, %d failed runs\n", failures)
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
+
+// startProbes serves the liveness probe /healthz and the readiness probe
+// /readyz on PROBE_LISTEN (default :8081) until ctx is cancelled
+func startProbes(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", handleReady)
+	server := &http.Server{
+		Addr:              getEnv("PROBE_LISTEN", ":8081"),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Info("startProbes: Listening on ", server.Addr, " for /healthz and /readyz")
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("startProbes: ", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+}
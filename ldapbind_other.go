@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "errors"
+
+// newDefaultGSSAPIClient has no default credentials outside of windows
+func newDefaultGSSAPIClient() (closableGSSAPIClient, error) {
+	return nil, errors.New("kerberos bind requires LDAP_KRB5_KEYTAB, LDAP_KRB5_CCACHE or KRB5CCNAME")
+}
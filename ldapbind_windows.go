@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"github.com/go-ldap/ldap/v3/gssapi"
+	log "github.com/sirupsen/logrus"
+)
+
+// newDefaultGSSAPIClient uses SSPI with the credentials of the current process
+func newDefaultGSSAPIClient() (closableGSSAPIClient, error) {
+	log.Debug("newGSSAPIClient: Using SSPI with current user credentials")
+	return gssapi.NewSSPIClient()
+}
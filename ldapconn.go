@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/go-ldap/ldap/v3/gssapi"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Supported LDAP_TLS_MODE values
+const (
+	ldapTLSModeAuto     = "auto"     // ldaps for ldaps:// urls, plain otherwise (no simple bind with password)
+	ldapTLSModeLdaps    = "ldaps"    // require a ldaps:// url
+	ldapTLSModeStartTLS = "starttls" // require a ldap:// url upgraded with StartTLS
+	ldapTLSModeNone     = "none"     // plain ldap, explicitly unprotected
+)
+
+// tlsVersions maps LDAP_TLS_MIN_VERSION values to tls constants
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// GetLdapTLSMode returns the configured LDAP_TLS_MODE, defaults to auto
+func GetLdapTLSMode() string {
+	mode := strings.ToLower(os.Getenv("LDAP_TLS_MODE"))
+	if mode == "" {
+		return ldapTLSModeAuto
+	}
+	return mode
+}
+
+// NewLdapTLSConfig builds the tls configuration for host from
+// LDAP_TLS_CA_FILE, LDAP_TLS_INSECURE_SKIP_VERIFY and LDAP_TLS_MIN_VERSION
+func NewLdapTLSConfig(host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: getEnvBool("LDAP_TLS_INSECURE_SKIP_VERIFY", false),
+	}
+	if tlsConfig.InsecureSkipVerify {
+		log.Warn("NewLdapTLSConfig: Certificate validation is disabled")
+	}
+
+	minVersion := os.Getenv("LDAP_TLS_MIN_VERSION")
+	if minVersion != "" {
+		version, found := tlsVersions[minVersion]
+		if !found {
+			return nil, fmt.Errorf("invalid LDAP_TLS_MIN_VERSION %s", minVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	caFile := os.Getenv("LDAP_TLS_CA_FILE")
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+		log.Debug("NewLdapTLSConfig: Using CA bundle ", caFile)
+	}
+	return tlsConfig, nil
+}
+
+// ldapHost returns the host name part of ldapURL
+func ldapHost(ldapURL string) string {
+	u, err := url.Parse(ldapURL)
+	if err != nil {
+		return ldapURL
+	}
+	return u.Hostname()
+}
+
+// DialLdap connects to ldapURL and secures the connection as
+// requested by LDAP_TLS_MODE
+func DialLdap(ldapURL string) (*ldap.Conn, error) {
+	u, err := url.Parse(ldapURL)
+	if err != nil {
+		return nil, err
+	}
+	scheme := strings.ToLower(u.Scheme)
+	mode := GetLdapTLSMode()
+
+	switch {
+	case mode == ldapTLSModeLdaps && scheme != "ldaps":
+		return nil, fmt.Errorf("LDAP_TLS_MODE ldaps requires a ldaps:// url, got %s", ldapURL)
+	case mode == ldapTLSModeStartTLS && scheme != "ldap":
+		return nil, fmt.Errorf("LDAP_TLS_MODE starttls requires a ldap:// url, got %s", ldapURL)
+	case mode == ldapTLSModeNone && scheme != "ldap":
+		return nil, fmt.Errorf("LDAP_TLS_MODE none requires a ldap:// url, got %s", ldapURL)
+	}
+
+	tlsConfig, err := NewLdapTLSConfig(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: getEnvDuration("LDAP_DIAL_TIMEOUT", ldap.DefaultTimeout)}
+	ldapCON, err := ldap.DialURL(ldapURL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	if timeout := getEnvDuration("LDAP_READ_TIMEOUT", 0); timeout > 0 {
+		ldapCON.SetTimeout(timeout)
+	}
+
+	if mode == ldapTLSModeStartTLS {
+		err = ldapCON.StartTLS(tlsConfig)
+		if err != nil {
+			ldapCON.Close()
+			return nil, err
+		}
+		log.Debug("DialLdap: StartTLS successful")
+	} else if scheme == "ldap" {
+		log.Warn("DialLdap: Connection to ", u.Host, " is not encrypted")
+	}
+	return ldapCON, nil
+}
+
+// Supported LDAP_AUTH_METHOD values
+const (
+	ldapAuthSimple   = "simple"
+	ldapAuthKerberos = "kerberos"
+	ldapAuthNTLM     = "ntlm"
+)
+
+// GetLdapAuthMethod returns the configured LDAP_AUTH_METHOD, defaults to simple
+func GetLdapAuthMethod() string {
+	method := strings.ToLower(os.Getenv("LDAP_AUTH_METHOD"))
+	if method == "" {
+		return ldapAuthSimple
+	}
+	return method
+}
+
+// BindLdap authenticates ldapCON to host with the configured LDAP_AUTH_METHOD
+func BindLdap(ldapCON *ldap.Conn, host string) error {
+	switch GetLdapAuthMethod() {
+	case ldapAuthKerberos:
+		client, err := newGSSAPIClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		if IsChannelBinding() {
+			client, err = newChannelBindingGSSAPIClient(client, ldapCON)
+			if err != nil {
+				return err
+			}
+		}
+		spn := os.Getenv("LDAP_KRB5_SPN")
+		if spn == "" {
+			spn = "ldap/" + host
+		}
+		log.Debug("BindLdap: Kerberos bind with service principal ", spn)
+		return ldapCON.GSSAPIBind(client, spn, "")
+	case ldapAuthNTLM:
+		if IsChannelBinding() {
+			return errors.New("channel binding is not supported for NTLM binds, use LDAP_AUTH_METHOD kerberos")
+		}
+		domain := os.Getenv("LDAP_NTLM_DOMAIN")
+		username := os.Getenv("LDAP_NTLM_USERNAME")
+		hash := os.Getenv("LDAP_NTLM_HASH")
+		if hash != "" {
+			log.Debug("BindLdap: NTLM bind with hash as ", domain, "\\", username)
+			return ldapCON.NTLMBindWithHash(domain, username, hash)
+		}
+		log.Debug("BindLdap: NTLM bind with password as ", domain, "\\", username)
+		return ldapCON.NTLMBind(domain, username, os.Getenv("LDAP_AUTH_PW"))
+	default:
+		// the password would be sent in clear text
+		if _, encrypted := ldapCON.TLSConnectionState(); !encrypted && os.Getenv("LDAP_AUTH_PW") != "" && GetLdapTLSMode() != ldapTLSModeNone {
+			return errors.New("simple bind over an unencrypted connection refused, use ldaps://, LDAP_TLS_MODE starttls or allow it with LDAP_TLS_MODE none")
+		}
+		return ldapCON.Bind(os.Getenv("LDAP_AUTH_CN"), os.Getenv("LDAP_AUTH_PW"))
+	}
+}
+
+// closableGSSAPIClient is a GSSAPI client holding credentials that must be released
+type closableGSSAPIClient interface {
+	ldap.GSSAPIClient
+	Close() error
+}
+
+// newGSSAPIClient creates a kerberos client from LDAP_KRB5_KEYTAB or
+// LDAP_KRB5_CCACHE (KRB5CCNAME), falling back to the platform default
+func newGSSAPIClient() (closableGSSAPIClient, error) {
+	krb5conf := os.Getenv("LDAP_KRB5_CONF")
+	if krb5conf == "" {
+		krb5conf = "/etc/krb5.conf"
+	}
+
+	keytab := os.Getenv("LDAP_KRB5_KEYTAB")
+	if keytab != "" {
+		log.Debug("newGSSAPIClient: Using keytab ", keytab)
+		return gssapi.NewClientWithKeytab(os.Getenv("LDAP_KRB5_USERNAME"), os.Getenv("LDAP_KRB5_REALM"), keytab, krb5conf)
+	}
+
+	ccache := os.Getenv("LDAP_KRB5_CCACHE")
+	if ccache == "" {
+		ccache = strings.TrimPrefix(os.Getenv("KRB5CCNAME"), "FILE:")
+	}
+	if ccache != "" {
+		log.Debug("newGSSAPIClient: Using credential cache ", ccache)
+		return gssapi.NewClientFromCCache(ccache, krb5conf)
+	}
+	return newDefaultGSSAPIClient()
+}
+
+// GetLdapURLs returns the comma separated list of LDAP_URL
+func GetLdapURLs() []string {
+	return getEnvList("LDAP_URL", ",")
+}
+
+// ConnectLdap dials and binds to the servers of LDAP_URL in order. If all
+// servers fail it retries with exponential backoff (LDAP_RETRY_BACKOFF)
+// until LDAP_CONNECT_TIMEOUT is exceeded or ctx is cancelled. Returns the
+// bound connection and the url of the server which accepted it.
+func ConnectLdap(ctx context.Context) (*ldap.Conn, string, error) {
+	ldapURLs := GetLdapURLs()
+	if len(ldapURLs) == 0 {
+		return nil, "", errors.New("LDAP_URL is empty")
+	}
+	backoff := getEnvDuration("LDAP_RETRY_BACKOFF", time.Second)
+	deadline := time.Now().Add(getEnvDuration("LDAP_CONNECT_TIMEOUT", time.Minute))
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		for _, ldapURL := range ldapURLs {
+			if ctx.Err() != nil {
+				return nil, "", ctx.Err()
+			}
+			ldapCON, err := DialLdap(ldapURL)
+			if err == nil {
+				err = BindLdap(ldapCON, ldapHost(ldapURL))
+				if err == nil {
+					return ldapCON, ldapURL, nil
+				}
+				ldapCON.Close()
+			}
+			log.Warnf("ConnectLdap: Attempt %d on %s failed: %v", attempt, ldapURL, err)
+			lastErr = err
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, "", fmt.Errorf("no ldap server available after %d attempts, last error: %v", attempt, lastErr)
+		}
+		log.Debug("ConnectLdap: Retrying in ", backoff)
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// NewLdapContext returns a context which is cancelled after LDAP_DEADLINE
+// (0 = no deadline) to bound the whole ldap phase of a run
+func NewLdapContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if deadline := getEnvDuration("LDAP_DEADLINE", 0); deadline > 0 {
+		return context.WithTimeout(parent, deadline)
+	}
+	return context.WithCancel(parent)
+}
+
+// searchLdap runs searchReq like ldap.Conn.Search, but abandons the
+// search when ctx is cancelled
+func searchLdap(ctx context.Context, ldapCON *ldap.Conn, searchReq *ldap.SearchRequest) (result *ldap.SearchResult, err error) {
+	ctx, span := tracer.Start(ctx, "ldap.search", trace.WithAttributes(
+		attribute.String("ldap.base_dn", searchReq.BaseDN),
+		attribute.String("ldap.filter", searchReq.Filter),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("ldap.entries", len(result.Entries)))
+		endSpan(span, err)
+	}()
+	result = &ldap.SearchResult{}
+	response := ldapCON.SearchAsync(ctx, searchReq, 0)
+	for response.Next() {
+		if entry := response.Entry(); entry != nil {
+			result.Entries = append(result.Entries, entry)
+		}
+		if referral := response.Referral(); referral != "" {
+			result.Referrals = append(result.Referrals, referral)
+		}
+	}
+	if ctx.Err() != nil {
+		return result, fmt.Errorf("ldap search of %s aborted: %v", searchReq.BaseDN, ctx.Err())
+	}
+	if err = response.Err(); err != nil {
+		return result, err
+	}
+	result.Controls = response.Controls()
+	return result, nil
+}
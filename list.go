@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ListSecrets prints the secrets of all destinations with their last write,
+// without passwords
+func ListSecrets(ctx context.Context) error {
+	out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(out, "DESTINATION\tTITLE\tGUID\tUPDATED")
+	for _, destination := range GetDestinations() {
+		store, err := NewSecretStore(destination)
+		if err != nil {
+			return err
+		}
+		secrets, err := store.List(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %v", destination, err)
+		}
+		log.Debug("ListSecrets: Got ", len(secrets), " secrets from ", destination)
+		for _, secret := range secrets {
+			updated := "-"
+			if !secret.Updated.IsZero() {
+				updated = secret.Updated.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", destination, secret.Title, secret.GUID, updated)
+		}
+	}
+	return out.Flush()
+}
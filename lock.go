@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errLocked is returned while another instance holds the lock file
+var errLocked = errors.New("another instance is running")
+
+// runLock is the lock file held by this instance
+type runLock struct {
+	path string
+	done chan struct{}
+}
+
+// GetLockFile returns LOCK_FILE, default laps2onepassword.lock in the
+// working directory
+func GetLockFile() string {
+	return getEnv("LOCK_FILE", "laps2onepassword.lock")
+}
+
+// GetLockStaleAfter returns LOCK_STALE_AFTER, the age of a lock file left by
+// a crashed instance after which it is taken over
+func GetLockStaleAfter() time.Duration {
+	return getEnvDuration("LOCK_STALE_AFTER", time.Hour)
+}
+
+// tryLock creates the lock file, a stale one is removed first
+func tryLock(path string) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			host, _ := os.Hostname()
+			fmt.Fprintf(file, "pid=%d host=%s started=%s\n", os.Getpid(), host, time.Now().Format(time.RFC3339))
+			return file.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue // released meanwhile
+		}
+		if age := time.Since(info.ModTime()); age < GetLockStaleAfter() {
+			holder, _ := os.ReadFile(path)
+			return fmt.Errorf("%w (%s, %s)", errLocked, strings.TrimSpace(string(holder)), path)
+		}
+		log.Warn("tryLock: Taking over stale lock ", path, " last refreshed ", info.ModTime().Format(time.RFC3339))
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w (%s)", errLocked, path)
+}
+
+// AcquireLock creates LOCK_FILE so overlapping runs can't create duplicate
+// items. If another instance holds it, it waits up to LOCK_WAIT (default
+// 0, fail at once) for the lock. The lock file is refreshed until Release,
+// so long running daemons don't become stale.
+func AcquireLock(ctx context.Context) (*runLock, error) {
+	path := GetLockFile()
+	deadline := time.Now().Add(getEnvDuration("LOCK_WAIT", 0))
+	for {
+		err := tryLock(path)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLocked) || time.Now().After(deadline) {
+			return nil, err
+		}
+		log.Info("AcquireLock: Waiting for ", path, ": ", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+	log.Debug("AcquireLock: Locked ", path)
+
+	lock := &runLock{path: path, done: make(chan struct{})}
+	refresh := GetLockStaleAfter() / 3
+	if refresh > time.Minute {
+		refresh = time.Minute
+	}
+	if refresh < time.Second {
+		refresh = time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-lock.done:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				if err := os.Chtimes(path, now, now); err != nil {
+					log.Warn("AcquireLock: Can't refresh ", path, ": ", err)
+				}
+			}
+		}
+	}()
+	return lock, nil
+}
+
+// Release removes the lock file
+func (l *runLock) Release() {
+	close(l.done)
+	err := os.Remove(l.path)
+	if err != nil {
+		log.Warn("Release: Can't remove ", l.path, ": ", err)
+	}
+}
+
+// withLock runs fn while holding the lock file and returns its exit code,
+// exitLocked if another instance didn't release the lock within LOCK_WAIT
+func withLock(ctx context.Context, fn func() int) int {
+	lock, err := AcquireLock(ctx)
+	if errors.Is(err, errLocked) {
+		log.Warn("withLock: Skipping run, ", err)
+		return exitLocked
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return exitInterrupted
+		}
+		log.Error("withLock: ", err)
+		return exitError
+	}
+	defer lock.Release()
+	return fn()
+}
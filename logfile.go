@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/mattn/go-colorable"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// logFile is the rotating log file of LOG_FILE or --logfile, nil without
+var logFile *lumberjack.Logger
+
+// newLogFile returns filename rotated at LOG_MAX_SIZE megabytes, keeping
+// LOG_MAX_BACKUPS old files for LOG_MAX_AGE days
+func newLogFile(filename string) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   filename,
+		MaxSize:    getEnvInt("LOG_MAX_SIZE", 50), // megabytes
+		MaxBackups: getEnvInt("LOG_MAX_BACKUPS", 3),
+		MaxAge:     getEnvInt("LOG_MAX_AGE", 90), // days
+		Compress:   getEnvBool("LOG_COMPRESS", false),
+		LocalTime:  true,
+	}
+}
+
+// logFileHook writes every entry to a file as well, without colors
+type logFileHook struct {
+	writer    io.Writer
+	formatter log.Formatter
+}
+
+func (h *logFileHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *logFileHook) Fire(entry *log.Entry) error {
+	line, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	_, err = h.writer.Write(line)
+	return err
+}
+
+// logsToConsole returns true if log entries are written to the console
+func logsToConsole() bool {
+	return logFile == nil || (flag_logfile == "" && getEnvBool("LOG_CONSOLE", true))
+}
+
+// InitLogFile writes the log to LOG_FILE in addition to the console, only
+// to LOG_FILE with LOG_CONSOLE=false. The file is rotated by size and every
+// LOG_ROTATE_INTERVAL, e.g. 24h for daily files. --logfile takes precedence
+// and never writes to the console.
+func InitLogFile() {
+	filename := os.Getenv("LOG_FILE")
+	if flag_logfile != "" {
+		// reopen with the LOG_* settings of .env
+		filename = flag_logfile
+		previous := logFile
+		logFile = newLogFile(filename)
+		log.SetOutput(logFile)
+		previous.Close()
+	} else if filename != "" {
+		logFile = newLogFile(filename)
+		formatter := &log.TextFormatter{
+			DisableColors:   true,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+		}
+		if getEnvBool("LOG_CONSOLE", true) {
+			log.AddHook(&logFileHook{writer: logFile, formatter: formatter})
+		} else {
+			log.SetFormatter(formatter)
+			log.SetOutput(logFile)
+		}
+	} else {
+		return
+	}
+	if interval := getEnvDuration("LOG_ROTATE_INTERVAL", 0); interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				err := logFile.Rotate()
+				if err != nil {
+					log.Error("InitLogFile: Can't rotate ", filename, ": ", err)
+				}
+			}
+		}()
+	}
+	log.Debug("InitLogFile: Logging to ", filename)
+}
+
+// setConsoleLogOutput sends the console log entries to stderr, e.g. to keep
+// stdout clean for an export
+func setConsoleLogOutput() {
+	if logsToConsole() {
+		if !IsKubernetesMode() {
+			log.SetFormatter(consoleFormatter(os.Stderr))
+		}
+		log.SetOutput(colorable.NewColorableStderr())
+	}
+}
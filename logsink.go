@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// systemLogHook writes the entries of LOG_SYSTEM_LEVEL and above to the
+// Windows Event Log on windows and to syslog elsewhere
+type systemLogHook struct {
+	levels []log.Level
+	write  func(level log.Level, message string) error
+}
+
+func (h *systemLogHook) Levels() []log.Level {
+	return h.levels
+}
+
+func (h *systemLogHook) Fire(entry *log.Entry) error {
+	message := entry.Message
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		message += fmt.Sprintf(" %s=%v", key, entry.Data[key])
+	}
+	return h.write(entry.Level, message)
+}
+
+// IsSystemLogEnabled returns true if LOG_SYSTEM is set
+func IsSystemLogEnabled() bool {
+	return getEnvBool("LOG_SYSTEM", false)
+}
+
+// GetSystemLogLevel returns LOG_SYSTEM_LEVEL, default warn
+func GetSystemLogLevel() (log.Level, error) {
+	return log.ParseLevel(getEnv("LOG_SYSTEM_LEVEL", "warn"))
+}
+
+// InitSystemLog adds the systemLogHook with LOG_SYSTEM, so failed syncs show
+// up in the monitoring of the Event Log or syslog
+func InitSystemLog() error {
+	if !IsSystemLogEnabled() {
+		return nil
+	}
+	level, err := GetSystemLogLevel()
+	if err != nil {
+		return err
+	}
+	write, err := openSystemLog()
+	if err != nil {
+		return err
+	}
+	levels := []log.Level{}
+	for _, l := range log.AllLevels {
+		if l <= level {
+			levels = append(levels, l)
+		}
+	}
+	log.AddHook(&systemLogHook{levels: levels, write: write})
+	log.Debug("InitSystemLog: Writing ", level, " and above to the system log")
+	return nil
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"log/syslog"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// openSystemLog connects to the local syslog or LOG_SYSLOG_ADDR, e.g.
+// udp://syslog.domain.loc:514, with the LOG_SYSLOG_TAG tag
+func openSystemLog() (func(level log.Level, message string) error, error) {
+	network, raddr := "", ""
+	if addr := getEnv("LOG_SYSLOG_ADDR", ""); addr != "" {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+	writer, err := syslog.Dial(network, raddr, syslog.LOG_WARNING|syslog.LOG_DAEMON, getEnv("LOG_SYSLOG_TAG", "laps2onepassword"))
+	if err != nil {
+		return nil, err
+	}
+	return func(level log.Level, message string) error {
+		switch level {
+		case log.PanicLevel, log.FatalLevel:
+			return writer.Crit(message)
+		case log.ErrorLevel:
+			return writer.Err(message)
+		case log.WarnLevel:
+			return writer.Warning(message)
+		case log.InfoLevel:
+			return writer.Info(message)
+		default:
+			return writer.Debug(message)
+		}
+	}, nil
+}
@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Event ids of the entries, by level
+const (
+	eventIDInfo    = 1
+	eventIDWarning = 2
+	eventIDError   = 3
+)
+
+// openSystemLog opens the Application Event Log with the LOG_EVENTLOG_SOURCE
+// source. The source is registered with EventCreate.exe as message file if
+// it doesn't exist yet, which requires administrator rights once.
+func openSystemLog() (func(level log.Level, message string) error, error) {
+	source := getEnv("LOG_EVENTLOG_SOURCE", "laps2onepassword")
+	err := eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		log.Debug("openSystemLog: Event source ", source, " not registered: ", err)
+	}
+	writer, err := eventlog.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return func(level log.Level, message string) error {
+		switch level {
+		case log.PanicLevel, log.FatalLevel, log.ErrorLevel:
+			return writer.Error(eventIDError, message)
+		case log.WarnLevel:
+			return writer.Warning(eventIDWarning, message)
+		default:
+			return writer.Info(eventIDInfo, message)
+		}
+	}, nil
+}
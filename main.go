@@ -4,13 +4,18 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"math"
+	"net/url"
 	"os"
-	"strconv"
+	"os/exec"
+	"sort"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/1Password/connect-sdk-go/connect"
@@ -20,28 +25,134 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/mattn/go-colorable"
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/natefinch/lumberjack.v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Commandline flags
 var flag_loglevel string
 var flag_logfile string
+var flag_yes bool
+var flag_dry_run bool
+var flag_force bool
+var flag_format string
+var flag_fields string
+var flag_with_passwords bool
+var flag_out string
+var flag_daemon bool
+var flag_kubernetes bool
+var flag_config string
+var flag_profile string
+var flag_version bool
+
+// version of laps2onepassword, set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// runID identifies this sync run in item notes and logs
+var runID = uuid.New().String()
 
 // LapsEntry represents LAPS information read from active directory
 type LapsEntry struct {
-	name        string
-	dnshostname string
-	password    string
-	expiration  time.Time
+	name            string
+	dnshostname     string
+	account         string // managed local account, only provided by Windows LAPS
+	source          string // LAPS_MODE the password was read from
+	password        string
+	expiration      time.Time // only valid with expirationstate expirationKnown
+	expirationstate int
+	updated         time.Time          // last password update, only provided by Windows LAPS
+	history         []lapsHistoryEntry // previous passwords, only read with LAPS_SYNC_HISTORY
+	historyFailed   bool               // history unreadable, the stored one is kept
+	lastlogon       time.Time          // most recent of lastLogonTimestamp and pwdLastSet
+	stale           bool               // no activity within LDAP_STALE_DAYS
+	dn              string
+	guid            string            // objectGUID, primary key for matching items
+	problems        []string          // malformed attributes, see ValidateLapsEntries
+	attributes      map[string]string // additional attributes of OP_ITEM_TEMPLATE
+	bitlocker       []bitlockerKey    // BitLocker recovery keys, only read with BITLOCKER_ENABLED
+	dc              bool              // domain controller, only read for OP_FAVORITES/OP_ICON_URLS dc rules
+	// Computer info, only read with LDAP_SYNC_COMPUTER_INFO
+	description string
+	os          string
+	osversion   string
+	whencreated time.Time
+	usn         int64 // uSNChanged, only read with SYNC_SKIP_UNCHANGED
+}
+
+// Supported LDAP_STALE_ACTION values
+const (
+	staleActionExclude = "exclude" // don't sync stale computers
+	staleActionTag     = "tag"     // sync stale computers and tag their items
+)
+
+// staleTag is set on items of stale computers with LDAP_STALE_ACTION=tag
+const staleTag = "stale"
+
+// Expiration states of a LapsEntry
+const (
+	expirationKnown   = iota
+	expirationUnknown // FILETIME 0 or not parseable
+	expirationNever   // FILETIME 0x7FFFFFFFFFFFFFFF
+)
+
+// filetimeNever is the FILETIME value Active Directory uses for "never"
+const filetimeNever = math.MaxInt64
+
+// ExpirationString renders the expiration of a LapsEntry for logs and items
+func (e LapsEntry) ExpirationString() string {
+	switch e.expirationstate {
+	case expirationNever:
+		return "never"
+	case expirationUnknown:
+		return "unknown"
+	default:
+		return e.expiration.Format(time.RFC3339)
+	}
+}
+
+// Title returns the 1Password item title of a LapsEntry
+func (e LapsEntry) Title() string {
+	if e.source == lapsModeDSRM {
+		return e.dnshostname + dsrmTitleSuffix
+	}
+	return e.dnshostname
+}
+
+// Username returns the managed account name, as reported by Windows LAPS,
+// or LAPS_USERNAME
+func (e LapsEntry) Username() string {
+	if e.account != "" {
+		return e.account
+	}
+	return os.Getenv("LAPS_USERNAME")
 }
 
-// init configures logging before main
+// Supported LAPS_MODE values
+const (
+	lapsModeLegacy  = "legacy"  // Microsoft LAPS (ms-Mcs-AdmPwd)
+	lapsModeWindows = "windows" // Windows LAPS (msLAPS-Password)
+)
+
+// init registers the flags and the log redaction
 func init() {
 
 	flag.StringVar(&flag_loglevel, "loglevel", "info", "set loglevel [trace,debug,info,warn,error,fatal,panic]")
 	flag.StringVar(&flag_logfile, "logfile", "", "write log to specified file (disables stdout)")
-	flag.Parse()
-	InitLogger()
+	flag.BoolVar(&flag_quiet, "quiet", false, "only log errors and the summary of each run")
+	flag.BoolVar(&flag_no_color, "no-color", false, "disable colors, like NO_COLOR")
+	flag.BoolVar(&flag_yes, "yes", false, "answer confirmation prompts with yes")
+	flag.BoolVar(&flag_dry_run, "dry-run", false, "read everything and print the changes without writing to 1Password")
+	flag.BoolVar(&flag_force, "force", false, "update, archive and delete items without the laps2onepassword ownership marker")
+	flag.BoolVar(&flag_daemon, "daemon", false, "keep running and sync every SYNC_INTERVAL")
+	flag.BoolVar(&flag_version, "version", false, "print the version and build info and exit")
+	flag.StringVar(&flag_config, "config", "", "read settings from a YAML or TOML file, overridden by the environment and .env")
+	flag.StringVar(&flag_profile, "profile", "", "use the settings of this profile of the config file, sets CONFIG_PROFILE")
+	flag.BoolVar(&flag_kubernetes, "kubernetes", false, "read the settings from the environment only, log JSON to stdout and serve probes")
+	flag.StringVar(&flag_format, "format", "csv", "export format [csv,json,yaml]")
+	flag.StringVar(&flag_fields, "fields", "", "comma separated fields to export (default hostname,username,expiration,source,dn,guid)")
+	flag.BoolVar(&flag_with_passwords, "with-passwords", false, "include passwords in the export")
+	flag.StringVar(&flag_out, "out", "", "write the export to file instead of stdout")
+	log.AddHook(redactHook{})
 }
 
 func InitLogger() {
@@ -68,12 +179,12 @@ func InitLogger() {
 		log.SetLevel(log.InfoLevel)
 	}
 
+	if flag_quiet {
+		log.SetLevel(log.ErrorLevel)
+	}
+
 	if flag_logfile == "" {
-		log.SetFormatter(&log.TextFormatter{
-			ForceColors:     true, // Seems like automatic color detection doesn't work on windows terminals
-			FullTimestamp:   true,
-			TimestampFormat: time.RFC3339,
-		})
+		log.SetFormatter(consoleFormatter(os.Stdout))
 		log.SetOutput(colorable.NewColorableStdout())
 	} else {
 		log.SetFormatter(&log.TextFormatter{
@@ -81,13 +192,11 @@ func InitLogger() {
 			FullTimestamp:   true,
 			TimestampFormat: time.RFC3339,
 		})
-		log.SetOutput(&lumberjack.Logger{
-			Filename:   flag_logfile,
-			MaxSize:    50, // megabytes
-			MaxBackups: 3,
-			MaxAge:     90,    //days
-			Compress:   false, // disabled by default
-		})
+		logFile = newLogFile(flag_logfile)
+		log.SetOutput(logFile)
+	}
+	if IsKubernetesMode() {
+		initKubernetesLogger()
 	}
 	log.Debug("InitLogger: Loglevel set to ", strings.ToLower(log.GetLevel().String()))
 }
@@ -95,339 +204,1930 @@ func InitLogger() {
 // GetAndCheckEnvironment checks all required environment variables
 func GetAndCheckEnvironment() error {
 	errorcount := 0
-	err := godotenv.Load()
+	// kubernetes mode only reads the environment and mounted secrets
+	var err error
+	if !IsKubernetesMode() {
+		err = godotenv.Load()
+		if err != nil {
+			return err
+		}
+	}
+	// the environment and .env override the config file
+	if path := GetConfigFile(); path != "" {
+		err = LoadConfigFile(path, GetConfigProfile())
+		if err != nil {
+			return err
+		}
+	} else if GetConfigProfile() != "" {
+		return fmt.Errorf("profile %s requires a config file (--config or CONFIG_FILE)", GetConfigProfile())
+	}
+	err = loadSecretFiles()
 	if err != nil {
 		return err
 	}
+	err = loadKeyringSecrets()
+	if err != nil {
+		return err
+	}
+	registerSecretEnv()
 
-	op_connect_host, op_connect_host_found := os.LookupEnv("OP_CONNECT_HOST")
-	op_connect_token, op_connect_token_found := os.LookupEnv("OP_CONNECT_TOKEN")
-	op_vault_title, op_vault_title_found := os.LookupEnv("OP_VAULT_TITLE")
-
-	// op_connect_host
-	if !op_connect_host_found {
-		log.Error("GetAndCheckEnvironment: OP_CONNECT_HOST not set")
-		errorcount++
-	} else if op_connect_host == "" {
-		log.Error("GetAndCheckEnvironment: OP_CONNECT_HOST is empty")
+	// log_file, log_console, log_max_size, log_max_backups, log_max_age, log_compress, log_rotate_interval
+	for _, key := range []string{"LOG_MAX_SIZE", "LOG_MAX_BACKUPS", "LOG_MAX_AGE"} {
+		if !checkEnvInt(key) {
+			errorcount++
+		}
+	}
+	for _, key := range []string{"LOG_CONSOLE", "LOG_COMPRESS"} {
+		if !checkEnvBool(key) {
+			errorcount++
+		}
+	}
+	if !checkEnvDuration("LOG_ROTATE_INTERVAL") {
 		errorcount++
-	} else {
-		log.Debug("GetAndCheckEnvironment: OP_CONNECT_HOST is ", op_connect_host)
+	}
+	// kubernetes mode logs to stdout only
+	if !IsKubernetesMode() {
+		InitLogFile()
 	}
 
-	// op_connect_token
-	if !op_connect_token_found {
-		log.Error("GetAndCheckEnvironment: OP_CONNECT_TOKEN not set")
+	// log_system, log_system_level, log_syslog_addr, log_syslog_tag, log_eventlog_source
+	if !checkEnvBool("LOG_SYSTEM") {
 		errorcount++
-	} else if op_connect_token == "" {
-		log.Error("GetAndCheckEnvironment: OP_CONNECT_TOKEN is empty")
+	} else if IsKubernetesMode() {
+		log.Debug("GetAndCheckEnvironment: LOG_SYSTEM ignored in kubernetes mode")
+	} else if err := InitSystemLog(); err != nil {
+		log.Error("GetAndCheckEnvironment: LOG_SYSTEM ", err)
 		errorcount++
-	} else {
-		log.Debug("GetAndCheckEnvironment: OP_CONNECT_TOKEN begins with ", op_connect_token[0:9], "...")
 	}
 
-	// op_vault_title
-	if !op_vault_title_found {
-		log.Error("GetAndCheckEnvironment: OP_VAULT_TITLE not set")
+	// kubernetes_mode, log_level, probe_listen, max_consecutive_failures
+	if !checkEnvBool("KUBERNETES_MODE") || !checkEnvInt("MAX_CONSECUTIVE_FAILURES") {
 		errorcount++
-	} else if op_vault_title == "" {
-		log.Error("GetAndCheckEnvironment: OP_VAULT_TITLE is empty")
-		errorcount++
-	} else {
-		log.Debug("GetAndCheckEnvironment: OP_VAULT_TITLE is ", op_vault_title)
 	}
-
-	if errorcount == 0 {
-		return nil
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		if _, err := log.ParseLevel(level); err != nil {
+			log.Error("GetAndCheckEnvironment: LOG_LEVEL ", err)
+			errorcount++
+		}
 	}
-	return errors.New("GetAndCheckEnvironment: Missing required environment variables, see previous errors")
-}
 
-// getTimeFromFiletime is a helper function and converts
-// windows FILETIME structure (64-bit value representing the number
-// of 100-nanosecond intervals since January 1, 1601 (UTC)) to golang time.Time
-func getTimeFromFiletime(input int64) time.Time {
-	maxd := time.Duration(math.MaxInt64).Truncate(100 * time.Nanosecond)
-	maxdUnits := int64(maxd / 100) // number of 100-ns units
+	op_connect_host, op_connect_host_found := os.LookupEnv("OP_CONNECT_HOST")
+	op_connect_token, op_connect_token_found := os.LookupEnv("OP_CONNECT_TOKEN")
+	op_vault_title, op_vault_title_found := os.LookupEnv("OP_VAULT_TITLE")
 
-	t := time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)
-	for input > maxdUnits {
-		t = t.Add(maxd)
-		input -= maxdUnits
-	}
-	if input != 0 {
-		t = t.Add(time.Duration(input * 100))
+	// destination
+	for _, destination := range GetDestinations() {
+		if _, err := NewSecretStore(destination); err != nil {
+			log.Error("GetAndCheckEnvironment: DESTINATION ", err)
+			errorcount++
+		} else {
+			log.Debug("GetAndCheckEnvironment: DESTINATION includes ", destination)
+		}
 	}
-	return t
-}
 
-// GetLapsEntries connects to an active directory server
-// and retrieves all computer objects configured with LAPS
-func GetLapsEntries() ([]LapsEntry, error) {
-	lapsentries := []LapsEntry{}
+	// 1Password settings are only required when writing to 1Password
+	if usesOnePassword() {
+		// op_backend
+		switch GetOnePassBackend() {
+		case onePassBackendConnect:
+			// op_connect_host
+			if !op_connect_host_found {
+				log.Error("GetAndCheckEnvironment: OP_CONNECT_HOST not set")
+				errorcount++
+			} else if op_connect_host == "" {
+				log.Error("GetAndCheckEnvironment: OP_CONNECT_HOST is empty")
+				errorcount++
+			} else {
+				log.Debug("GetAndCheckEnvironment: OP_CONNECT_HOST is ", op_connect_host)
+			}
 
-	ldapURL := os.Getenv("LDAP_URL")
-	ldapCON, err := ldap.DialURL(ldapURL)
-	if err != nil {
-		return lapsentries, err
-	}
-	defer ldapCON.Close()
+			// op_connect_token
+			if !op_connect_token_found {
+				log.Error("GetAndCheckEnvironment: OP_CONNECT_TOKEN not set")
+				errorcount++
+			} else if op_connect_token == "" {
+				log.Error("GetAndCheckEnvironment: OP_CONNECT_TOKEN is empty")
+				errorcount++
+			} else {
+				log.Debug("GetAndCheckEnvironment: OP_CONNECT_TOKEN begins with ", op_connect_token[0:9], "...")
+			}
+		case onePassBackendSDK:
+			// op_service_account_token
+			if os.Getenv("OP_SERVICE_ACCOUNT_TOKEN") == "" {
+				log.Error("GetAndCheckEnvironment: OP_SERVICE_ACCOUNT_TOKEN not set")
+				errorcount++
+			} else {
+				log.Debug("GetAndCheckEnvironment: OP_BACKEND is sdk with a service account")
+			}
+		case onePassBackendCLI:
+			// op_cli_path
+			path, err := exec.LookPath(getEnv("OP_CLI_PATH", "op"))
+			if err != nil {
+				log.Error("GetAndCheckEnvironment: OP_CLI_PATH ", err)
+				errorcount++
+			} else {
+				log.Debug("GetAndCheckEnvironment: OP_BACKEND is cli with ", path)
+			}
+		default:
+			log.Error("GetAndCheckEnvironment: OP_BACKEND must be connect, sdk or cli")
+			errorcount++
+		}
 
-	err = ldapCON.Bind(os.Getenv("LDAP_AUTH_CN"), os.Getenv("LDAP_AUTH_PW"))
-	if err != nil {
-		return lapsentries, err
+		// op_vault_id, op_vault_title
+		if op_vault_id := os.Getenv("OP_VAULT_ID"); op_vault_id != "" {
+			log.Debug("GetAndCheckEnvironment: OP_VAULT_ID is ", op_vault_id)
+		} else if !op_vault_title_found {
+			log.Error("GetAndCheckEnvironment: OP_VAULT_TITLE or OP_VAULT_ID not set")
+			errorcount++
+		} else if op_vault_title == "" {
+			log.Error("GetAndCheckEnvironment: OP_VAULT_TITLE is empty")
+			errorcount++
+		} else {
+			log.Debug("GetAndCheckEnvironment: OP_VAULT_TITLE is ", op_vault_title)
+		}
 	}
 
-	searchReq := ldap.NewSearchRequest(
-		os.Getenv("LDAP_SEARCH_BASEDN"), //BaseDN
-		ldap.ScopeWholeSubtree,          //Scope
-		0,                               //DerefAliases
-		0,                               //SizeLimit
-		0,                               //TimeLimit
-		false,                           //TypesOnly
-		os.Getenv("LDAP_SEARCH_FILTER"), //Filter
-		[]string{"name", "ms-Mcs-AdmPwd", "ms-Mcs-AdmPwdExpirationTime", "dNSHostName"}, //Attributes
-		[]ldap.Control{}, //Control
-	)
+	// vault_addr, vault_token, vault_role_id, vault_secret_id, vault_path_template
+	if usesDestination(destinationVault) {
+		if os.Getenv("VAULT_ADDR") == "" {
+			log.Error("GetAndCheckEnvironment: VAULT_ADDR not set")
+			errorcount++
+		}
+		if os.Getenv("VAULT_TOKEN") == "" && (os.Getenv("VAULT_ROLE_ID") == "" || os.Getenv("VAULT_SECRET_ID") == "") {
+			log.Error("GetAndCheckEnvironment: VAULT_TOKEN or VAULT_ROLE_ID and VAULT_SECRET_ID not set")
+			errorcount++
+		}
+		if _, err := template.New("VAULT_PATH_TEMPLATE").Parse(getEnv("VAULT_PATH_TEMPLATE", defaultVaultPathTemplate)); err != nil {
+			log.Error("GetAndCheckEnvironment: VAULT_PATH_TEMPLATE ", err)
+			errorcount++
+		}
+		if !checkEnvInt("VAULT_KV_MAX_VERSIONS") {
+			errorcount++
+		}
+	}
 
-	result, err := ldapCON.Search(searchReq)
-	if err != nil {
-		return lapsentries, err
-	} else {
-		log.Debug("GetLapsEntries: Got ", len(result.Entries), " entries from ldap")
-		for index, entry := range result.Entries {
-			log.Trace("GetLapsEntries: [", index, "] ", entry.GetAttributeValue("dNSHostName"))
-			s := entry.GetAttributeValue("ms-Mcs-AdmPwdExpirationTime")
-			expirationtime, err := strconv.ParseInt(s, 10, 64)
-			if err != nil {
-				log.Warn("GetLapsEntries: Can't convert ms-Mcs-AdmPwdExpirationTime from", s)
-				expirationtime = 0
+	// bw_organization_id, bw_collection_id
+	if usesDestination(destinationBitwarden) {
+		for _, key := range []string{"BW_ORGANIZATION_ID", "BW_COLLECTION_ID"} {
+			if os.Getenv(key) == "" {
+				log.Error("GetAndCheckEnvironment: ", key, " not set")
+				errorcount++
 			}
-			lapsentries = append(lapsentries, LapsEntry{
-				name:        entry.GetAttributeValue("name"),
-				dnshostname: entry.GetAttributeValue("dNSHostName"),
-				password:    entry.GetAttributeValue("ms-Mcs-AdmPwd"),
-				expiration:  getTimeFromFiletime(expirationtime),
-			})
 		}
 	}
-	return lapsentries, err
-}
 
-// GetOnePassEntries connects to an 1Password Connect-Server
-// and retrieves all items from a special vault
-func GetOnePassEntries() ([]onepassword.Item, error) {
-	opEmptyItems := []onepassword.Item{}
-	opListItems := []onepassword.Item{}
-	opFullItems := []onepassword.Item{}
-
-	client, err := connect.NewClientFromEnvironment()
-	if err != nil {
-		return opEmptyItems, err
+	// aws_sm_tags, aws_sm_recovery_window_days
+	if usesDestination(destinationAWS) {
+		if _, err := awsSecretTags(LapsEntry{}); err != nil {
+			log.Error("GetAndCheckEnvironment: ", err)
+			errorcount++
+		}
+		if days := getEnvInt("AWS_SM_RECOVERY_WINDOW_DAYS", 30); !checkEnvInt("AWS_SM_RECOVERY_WINDOW_DAYS") || days < 7 || days > 30 {
+			log.Error("GetAndCheckEnvironment: AWS_SM_RECOVERY_WINDOW_DAYS must be between 7 and 30")
+			errorcount++
+		}
 	}
 
-	vaults, err := client.GetVaultsByTitle(os.Getenv("OP_VAULT_TITLE"))
-	if err != nil {
-		return opEmptyItems, err
+	// cyberark_url, cyberark_username, cyberark_password, cyberark_platform_id, cyberark_safe, cyberark_safe_routes
+	if usesDestination(destinationCyberArk) {
+		for _, key := range []string{"CYBERARK_URL", "CYBERARK_USERNAME", "CYBERARK_PASSWORD", "CYBERARK_PLATFORM_ID", "CYBERARK_SAFE"} {
+			if os.Getenv(key) == "" {
+				log.Error("GetAndCheckEnvironment: ", key, " not set")
+				errorcount++
+			}
+		}
+		switch strings.ToLower(getEnv("CYBERARK_AUTH_TYPE", "cyberark")) {
+		case "cyberark", "ldap", "radius":
+		default:
+			log.Error("GetAndCheckEnvironment: CYBERARK_AUTH_TYPE must be cyberark, ldap or radius")
+			errorcount++
+		}
+		if _, err := GetCyberArkSafeRules(); err != nil {
+			log.Error("GetAndCheckEnvironment: ", err)
+			errorcount++
+		}
 	}
-	if len(vaults) == 0 {
-		return opEmptyItems, fmt.Errorf("vault %s not found", os.Getenv("OP_VAULT_TITLE"))
-	} else if len(vaults) > 1 {
-		return opEmptyItems, fmt.Errorf("fault %s found more than once", os.Getenv("OP_VAULT_TITLE"))
+
+	// pass_git_push
+	if usesDestination(destinationPass) && !checkEnvBool("PASS_GIT_PUSH") {
+		errorcount++
 	}
-	vault := vaults[0]
-	log.Debug("GetOnePassEntries: Found vault ", vault.Name)
 
-	opListItems, err = client.GetItems(vault.ID)
-	if err != nil {
-		return opEmptyItems, err
+	// sync_interval, sync_jitter, sync_run_max
+	for _, key := range []string{"SYNC_INTERVAL", "SYNC_JITTER", "SYNC_RUN_MAX"} {
+		if !checkEnvDuration(key) {
+			errorcount++
+		}
+	}
+	if GetSyncInterval() <= 0 {
+		log.Error("GetAndCheckEnvironment: SYNC_INTERVAL must be positive")
+		errorcount++
 	}
 
-	log.Debug("GetOnePassEntries: Got ", len(opListItems), " list entries from onepass")
+	// webhook_listen, webhook_token, webhook_tls_cert, webhook_tls_key
+	if isWebhookEnabled() {
+		if os.Getenv("WEBHOOK_TOKEN") == "" {
+			log.Error("GetAndCheckEnvironment: WEBHOOK_LISTEN requires WEBHOOK_TOKEN")
+			errorcount++
+		}
+		if (os.Getenv("WEBHOOK_TLS_CERT") == "") != (os.Getenv("WEBHOOK_TLS_KEY") == "") {
+			log.Error("GetAndCheckEnvironment: WEBHOOK_TLS_CERT and WEBHOOK_TLS_KEY must be set together")
+			errorcount++
+		}
+	}
 
-	for index, opListItem := range opListItems {
-		opFullItem, err := client.GetItem(opListItem.ID, opListItem.Vault.ID)
-		if err != nil {
-			return opEmptyItems, err
+	// notify_on, notify_smtp_host, notify_smtp_port, notify_smtp_from, notify_smtp_to
+	switch GetNotifyOn() {
+	case notifyOnAlways, notifyOnChanges, notifyOnFailure:
+	default:
+		log.Error("GetAndCheckEnvironment: NOTIFY_ON must be always, changes or failure")
+		errorcount++
+	}
+	if os.Getenv("NOTIFY_SMTP_HOST") != "" {
+		if os.Getenv("NOTIFY_SMTP_FROM") == "" || len(getEnvList("NOTIFY_SMTP_TO", ",")) == 0 {
+			log.Error("GetAndCheckEnvironment: NOTIFY_SMTP_HOST requires NOTIFY_SMTP_FROM and NOTIFY_SMTP_TO")
+			errorcount++
+		}
+		if !checkEnvInt("NOTIFY_SMTP_PORT") {
+			errorcount++
 		}
-		log.Trace("GetOnePassEntries: [", index, "] ", opFullItem.Title)
-		opFullItems = append(opFullItems, *opFullItem)
 	}
+	InitNotifications()
 
-	return opFullItems, nil
-}
+	// progress_interval
+	if !checkEnvDuration("PROGRESS_INTERVAL") {
+		errorcount++
+	}
 
-// CompareLapsToOnepass compares all entries from LAPS with all entries
-// from 1Passwort, if a item from LAPS not found it will be created
-func CompareLapsToOnepass(lapsentries []LapsEntry, onepassentries []onepassword.Item) error {
-	_created_total := 0
-	_updated_total := 0
-	var cur_laps_idx = 0
-	var cur_op_idx = 0
-	for cur_laps_idx = range lapsentries { // use index because it's faster (no copy)
-		lapsentry_found := false
-		cur_op_idx = 0
-		for cur_op_idx = range onepassentries {
-			if lapsentries[cur_laps_idx].dnshostname == onepassentries[cur_op_idx].Title {
-				lapsentry_found = true
-				break // break out of the inner loop if a match is found
-			}
-		}
-		if lapsentry_found {
-			log.Trace("CompareLapsToOnepass: Found lapsentry ", lapsentries[cur_laps_idx].dnshostname, " in onepassentries")
-			if lapsentries[cur_laps_idx].password != onepassentries[cur_op_idx].GetValue("password") {
-				log.Info("CompareLapsToOnepass: Update required ", lapsentries[cur_laps_idx].dnshostname)
-				err := UpdateOnPassEntry(onepassentries[cur_op_idx], lapsentries[cur_laps_idx])
-				if err != nil {
-					log.Error("CompareLapsToOnepass: Aborted due to previous error")
-					return err // Errors should not occur, therefore return from here and no more api calls.
-				}
-				_updated_total++
-			}
-		} else {
-			log.Trace("CompareLapsToOnepass: Not found lapsentry ", lapsentries[cur_laps_idx].dnshostname, " in onepassentries")
-			err := CreateOnPassEntryFromLapsEntry(lapsentries[cur_laps_idx])
-			if err != nil {
-				log.Error("CompareLapsToOnepass: Aborted due to previous error")
-				return err // Errors should not occur, therefore return from here and no more api calls.
-			}
-			_created_total++
+	// clipboard_clear_after
+	if !checkEnvDuration("CLIPBOARD_CLEAR_AFTER") {
+		errorcount++
+	}
+
+	// lock_wait, lock_stale_after
+	if !checkEnvDuration("LOCK_WAIT") || !checkEnvDuration("LOCK_STALE_AFTER") {
+		errorcount++
+	}
+	if GetLockStaleAfter() <= 0 {
+		log.Error("GetAndCheckEnvironment: LOCK_STALE_AFTER must be positive")
+		errorcount++
+	}
+
+	// run_deadline, op_list_deadline, op_write_timeout
+	for _, key := range []string{"RUN_DEADLINE", "OP_LIST_DEADLINE", "OP_WRITE_TIMEOUT"} {
+		if !checkEnvDuration(key) {
+			errorcount++
 		}
 	}
-	log.Infof("CompareLapsToOnepass: Total created=%d updated=%d", _created_total, _updated_total)
-	return nil
-}
 
-// CreateOnPassEntryFromLapsEntry creates a new item in 1Passwort
-func CreateOnPassEntryFromLapsEntry(lapsEntry LapsEntry) error {
-	log.Info("CreateOnPassEntryFromLapsEntry: ", lapsEntry.dnshostname)
-	client, err := connect.NewClientFromEnvironment()
-	if err != nil {
-		log.Error("CreateOnPassEntryFromLapsEntry: ", err)
-		return err
+	// op_orphan_action, op_orphan_grace_period, op_orphan_archive_vault
+	switch GetOrphanAction() {
+	case orphanActionNone, orphanActionTag, orphanActionDelete:
+		log.Debug("GetAndCheckEnvironment: OP_ORPHAN_ACTION is ", GetOrphanAction())
+	case orphanActionArchive:
+		if os.Getenv("OP_ORPHAN_ARCHIVE_VAULT") == "" && usesOnePassword() {
+			log.Error("GetAndCheckEnvironment: OP_ORPHAN_ACTION archive requires OP_ORPHAN_ARCHIVE_VAULT")
+			errorcount++
+		}
+	default:
+		log.Error("GetAndCheckEnvironment: OP_ORPHAN_ACTION must be none, tag, archive or delete")
+		errorcount++
 	}
-	vaults, err := client.GetVaultsByTitle(os.Getenv("OP_VAULT_TITLE"))
-	if err != nil {
-		log.Error("CreateOnPassEntryFromLapsEntry: ", err)
-		return err
+	if !checkEnvDuration("OP_ORPHAN_GRACE_PERIOD") {
+		errorcount++
 	}
-	if len(vaults) == 0 {
-		log.Errorf("CreateOnPassEntryFromLapsEntry: Vault %s not found", os.Getenv("OP_VAULT_TITLE"))
-		return err
-	} else if len(vaults) > 1 {
-		log.Errorf("CreateOnPassEntryFromLapsEntry: Vault %s found more than once", os.Getenv("OP_VAULT_TITLE"))
-		return err
+	// orphan tags, also of deleted computers, only exist in 1Password
+	for _, destination := range GetDestinations() {
+		if destination == destinationOnePassword {
+			continue
+		}
+		if GetOrphanAction() == orphanActionTag {
+			log.Error("GetAndCheckEnvironment: OP_ORPHAN_ACTION tag is only supported for DESTINATION 1password, not ", destination, ", use archive or delete")
+			errorcount++
+		}
+		if getEnvBool("LDAP_DETECT_DELETED", false) {
+			log.Error("GetAndCheckEnvironment: LDAP_DETECT_DELETED is only supported for DESTINATION 1password, not ", destination, ", orphaned secrets are archived by OP_ORPHAN_ACTION on full runs")
+			errorcount++
+		}
 	}
-	vault := vaults[0]
 
-	opitem := onepassword.Item{
-		ID:       uuid.New().String(),
-		Category: "LOGIN",
-		Title:    lapsEntry.dnshostname,
-		Vault: onepassword.ItemVault{
-			ID: vault.ID,
-		},
-		Fields: []*onepassword.ItemField{
-			{
-				ID:      uuid.New().String(),
-				Type:    "STRING",
-				Purpose: "USERNAME",
-				Label:   "Username",
-				Value:   os.Getenv("LAPS_USERNAME"),
-			}, {
-				ID:      uuid.New().String(),
-				Type:    "STRING",
-				Purpose: "PASSWORD",
-				Label:   "Password",
-				Value:   lapsEntry.password,
-			}, {
-				ID:      "notesPlain",
-				Type:    "STRING",
-				Purpose: "NOTES",
-				Label:   "notesPlain",
-				Value:   fmt.Sprintf("Created by laps2onepassword on %s", time.Now().String()),
-			},
-		},
+	// op_item_template
+	if _, err := LoadItemTemplate(); err != nil {
+		log.Error("GetAndCheckEnvironment: OP_ITEM_TEMPLATE ", err)
+		errorcount++
 	}
 
-	opCreatedItem, err := client.CreateItem(&opitem, vault.ID)
-	if err != nil {
-		log.Error("CreateOnPassEntryFromLapsEntry: ", err)
-		return err
+	// op_item_tags
+	if _, err := itemTags(LapsEntry{}); err != nil {
+		log.Error("GetAndCheckEnvironment: OP_ITEM_TAGS ", err)
+		errorcount++
 	}
-	log.Infof("CreateOnPassEntryFromLapsEntry: %s successfully", opCreatedItem.Title)
 
-	return nil
-}
+	// op_item_urls
+	if _, err := itemURLs(LapsEntry{}); err != nil {
+		log.Error("GetAndCheckEnvironment: OP_ITEM_URLS ", err)
+		errorcount++
+	}
 
-func UpdateOnPassEntry(onepassentry onepassword.Item, lapsEntry LapsEntry) error {
-	log.Info("UpdateOnPassEntry: ", lapsEntry.dnshostname)
-	client, err := connect.NewClientFromEnvironment()
-	if err != nil {
-		log.Error("UpdateOnPassEntry: ", err)
-		return err
+	// op_connect_tls_min_version, op_connect_insecure_skip_verify, op_connect_proxy, op_connect_*timeout
+	if v := os.Getenv("OP_CONNECT_TLS_MIN_VERSION"); v != "" {
+		if _, found := tlsVersions[v]; !found {
+			log.Error("GetAndCheckEnvironment: OP_CONNECT_TLS_MIN_VERSION must be 1.0, 1.1, 1.2 or 1.3")
+			errorcount++
+		}
+	}
+	if !checkEnvBool("OP_CONNECT_INSECURE_SKIP_VERIFY") {
+		errorcount++
+	}
+	if v := os.Getenv("OP_CONNECT_PROXY"); v != "" {
+		if _, err := url.Parse(v); err != nil {
+			log.Error("GetAndCheckEnvironment: OP_CONNECT_PROXY is not a valid url")
+			errorcount++
+		}
+	}
+	for _, key := range []string{"OP_CONNECT_DIAL_TIMEOUT", "OP_CONNECT_TIMEOUT"} {
+		if !checkEnvDuration(key) {
+			errorcount++
+		}
 	}
 
-	if onepassentry.Fields[1].Purpose == "PASSWORD" {
-		onepassentry.Fields[1].Value = lapsEntry.password
-	} else {
-		log.Panicf("UpdateOnPassEntry: Fields[1] purpose is not PASSWORD on %s", onepassentry.Title)
+	// op_retry_max, op_retry_base_delay, op_retry_max_delay
+	if !checkEnvInt("OP_RETRY_MAX") {
+		errorcount++
+	}
+	for _, key := range []string{"OP_RETRY_BASE_DELAY", "OP_RETRY_MAX_DELAY"} {
+		if !checkEnvDuration(key) {
+			errorcount++
+		}
 	}
 
-	if onepassentry.Fields[2].Purpose == "NOTES" {
-		onepassentry.Fields[2].Value = fmt.Sprintf("Updated by laps2onepassword on %s", time.Now().String())
-	} else {
-		log.Panicf("UpdateOnPassEntry: Fields[2] purpose is not NOTES on %s", onepassentry.Title)
+	// op_item_notes
+	if _, err := template.New("OP_ITEM_NOTES").Parse(GetItemNotes()); err != nil {
+		log.Error("GetAndCheckEnvironment: OP_ITEM_NOTES ", err)
+		errorcount++
 	}
 
-	client.UpdateItem(&onepassentry, onepassentry.Vault.ID)
-	if err != nil {
-		log.Error("UpdateOnPassEntry: ", err)
-		return err
+	// op_previous_passwords
+	if !checkEnvInt("OP_PREVIOUS_PASSWORDS") {
+		errorcount++
 	}
 
-	log.Infof("UpdateOnPassEntry: %s successfully", onepassentry.Title)
-	return nil
+	// op_conflict_policy, op_conflict_tolerance
+	switch GetConflictPolicy() {
+	case conflictPolicyOverwrite, conflictPolicySkip, conflictPolicyDuplicate:
+		log.Debug("GetAndCheckEnvironment: OP_CONFLICT_POLICY is ", GetConflictPolicy())
+	default:
+		log.Error("GetAndCheckEnvironment: OP_CONFLICT_POLICY must be overwrite, skip or duplicate")
+		errorcount++
+	}
+	if !checkEnvDuration("OP_CONFLICT_TOLERANCE") {
+		errorcount++
+	}
 
-}
+	// op_preflight
+	if !checkEnvBool("OP_PREFLIGHT") {
+		errorcount++
+	}
 
-// main start of this programm
-func main() {
+	// op_item_category
+	if v := os.Getenv("OP_ITEM_CATEGORY"); v != "" && !isItemCategory(v) {
+		log.Error("GetAndCheckEnvironment: OP_ITEM_CATEGORY is not a 1Password item category: ", v)
+		errorcount++
+	}
 
-	log.Debug("Main: Start programm")
+	// op_favorites, op_icon_urls
+	if _, err := GetFavoriteRules(); err != nil {
+		log.Error("GetAndCheckEnvironment: ", err)
+		errorcount++
+	}
+	if _, err := GetIconURLRules(); err != nil {
+		log.Error("GetAndCheckEnvironment: ", err)
+		errorcount++
+	}
 
-	// Get and check environment
-	// Set logging options
-	err := GetAndCheckEnvironment()
-	if err != nil {
-		log.Panic(err)
+	// op_load_items, op_read_workers
+	switch strings.ToLower(getEnv("OP_LOAD_ITEMS", "all")) {
+	case "all", "managed":
+	default:
+		log.Error("GetAndCheckEnvironment: OP_LOAD_ITEMS must be all or managed")
+		errorcount++
+	}
+	if !checkEnvInt("OP_READ_WORKERS") {
+		errorcount++
 	}
 
-	// Get entries from ldap
-	lapsentries, err := GetLapsEntries()
-	if err != nil {
-		log.Panic(err)
+	// op_managed_only
+	if !checkEnvBool("OP_MANAGED_ONLY") {
+		errorcount++
 	}
 
-	if len(lapsentries) < 1 {
-		log.Panic("No entries returned from ldap")
+	// op_write_workers, op_write_retries
+	for _, key := range []string{"OP_WRITE_WORKERS", "OP_WRITE_RETRIES"} {
+		if !checkEnvInt(key) {
+			errorcount++
+		}
+	}
+	if !checkEnvDuration("OP_WRITE_RETRY_DELAY") {
+		errorcount++
 	}
 
-	// Get entries from onepass
-	onepassentries, err := GetOnePassEntries()
-	if err != nil {
-		log.Panic(err)
+	// op_vault_autocreate
+	if !checkEnvBool("OP_VAULT_AUTOCREATE") {
+		errorcount++
 	}
-	if len(onepassentries) < 1 {
-		log.Warn("No entries returned from onepass")
+
+	// op_vault_routes
+	if _, err := GetVaultRoutes(); err != nil {
+		log.Error("GetAndCheckEnvironment: OP_VAULT_ROUTES ", err)
+		errorcount++
 	}
 
-	// CompareLapsToOnepass
-	err = CompareLapsToOnepass(lapsentries, onepassentries)
-	if err != nil {
-		log.Error("Main: Aborted due to previous error")
-		os.Exit(1)
+	// ldap_include_dn, ldap_exclude_dn
+	if _, err := NewDNFilter(); err != nil {
+		log.Error("GetAndCheckEnvironment: ", err)
+		errorcount++
+	}
+
+	// sync_include, sync_exclude
+	if _, err := NewHostFilter(); err != nil {
+		log.Error("GetAndCheckEnvironment: ", err)
+		errorcount++
+	}
+
+	// ldap_site_dn_pattern
+	if strings.Count(getEnv("LDAP_SITE_DN_PATTERN", "OU=%s,"), "%s") != 1 {
+		log.Error("GetAndCheckEnvironment: LDAP_SITE_DN_PATTERN must contain exactly one site placeholder")
+		errorcount++
+	}
+
+	// ldap_incremental
+	if !checkEnvBool("LDAP_INCREMENTAL") {
+		errorcount++
+	}
+
+	// ldap_search_size_limit, ldap_search_time_limit, ldap_search_deref_aliases
+	if !checkEnvInt("LDAP_SEARCH_SIZE_LIMIT") {
+		errorcount++
+	}
+	if !checkEnvInt("LDAP_SEARCH_TIME_LIMIT") {
+		errorcount++
+	}
+	if _, found := derefAliases[GetDerefAliasesName()]; !found {
+		log.Error("GetAndCheckEnvironment: LDAP_SEARCH_DEREF_ALIASES must be never, searching, finding or always")
+		errorcount++
+	}
+
+	// ldap_global_catalog
+	if !checkEnvBool("LDAP_GLOBAL_CATALOG") {
+		errorcount++
+	}
+
+	// ldap_detect_deleted
+	if !checkEnvBool("LDAP_DETECT_DELETED") {
+		errorcount++
+	}
+
+	// ldap_member_of_nested
+	if !checkEnvBool("LDAP_MEMBER_OF_NESTED") {
+		errorcount++
+	}
+
+	// ldap_exclude_disabled
+	if !checkEnvBool("LDAP_EXCLUDE_DISABLED") {
+		errorcount++
+	}
+
+	// ldap_sync_computer_info
+	if !checkEnvBool("LDAP_SYNC_COMPUTER_INFO") {
+		errorcount++
+	}
+
+	// ldap_stale_days, ldap_stale_action
+	if !checkEnvInt("LDAP_STALE_DAYS") {
+		errorcount++
+	}
+	switch GetStaleAction() {
+	case staleActionExclude, staleActionTag:
+		log.Debug("GetAndCheckEnvironment: LDAP_STALE_ACTION is ", GetStaleAction())
+	default:
+		log.Error("GetAndCheckEnvironment: LDAP_STALE_ACTION must be exclude or tag")
+		errorcount++
+	}
+
+	// laps_mode
+	switch GetLapsMode() {
+	case lapsModeLegacy, lapsModeWindows:
+		log.Debug("GetAndCheckEnvironment: LAPS_MODE is ", GetLapsMode())
+	default:
+		log.Error("GetAndCheckEnvironment: LAPS_MODE must be legacy or windows")
+		errorcount++
+	}
+
+	// ldap_retry_backoff, ldap_connect_timeout
+	if !checkEnvDuration("LDAP_RETRY_BACKOFF") {
+		errorcount++
+	}
+	if !checkEnvDuration("LDAP_CONNECT_TIMEOUT") {
+		errorcount++
+	}
+
+	// ldap_server_type
+	switch GetLdapServerType() {
+	case ldapServerAD, ldapServerSamba, ldapServerADLDS:
+		log.Debug("GetAndCheckEnvironment: LDAP_SERVER_TYPE is ", GetLdapServerType())
+	default:
+		log.Error("GetAndCheckEnvironment: LDAP_SERVER_TYPE must be ad, samba or adlds")
+		errorcount++
+	}
+	if IsADLDS() && getEnvBool("LDAP_GLOBAL_CATALOG", false) {
+		log.Error("GetAndCheckEnvironment: LDAP_GLOBAL_CATALOG is not available on AD LDS")
+		errorcount++
+	}
+	if IsADLDS() && GetLdapAuthMethod() == ldapAuthSimple && GetLdapTLSMode() == ldapTLSModeNone {
+		log.Warn("GetAndCheckEnvironment: AD LDS rejects proxy binds without TLS unless RequireSecureProxyBind is 0")
+	}
+
+	// ldap_channel_binding
+	if !checkEnvBool("LDAP_CHANNEL_BINDING") {
+		errorcount++
+	} else if IsChannelBinding() && GetLdapTLSMode() == ldapTLSModeNone {
+		log.Error("GetAndCheckEnvironment: LDAP_CHANNEL_BINDING requires LDAP_TLS_MODE auto, ldaps or starttls")
+		errorcount++
+	} else if IsChannelBinding() && GetLdapAuthMethod() == ldapAuthNTLM {
+		log.Error("GetAndCheckEnvironment: LDAP_CHANNEL_BINDING is not supported for NTLM binds, use LDAP_AUTH_METHOD kerberos")
+		errorcount++
+	}
+
+	// ldap_dial_timeout, ldap_read_timeout, ldap_deadline
+	if !checkEnvDuration("LDAP_DIAL_TIMEOUT") {
+		errorcount++
+	}
+	if !checkEnvDuration("LDAP_READ_TIMEOUT") {
+		errorcount++
+	}
+	if !checkEnvDuration("LDAP_DEADLINE") {
+		errorcount++
+	}
+
+	// bitlocker_enabled
+	if !checkEnvBool("BITLOCKER_ENABLED") {
+		errorcount++
+	}
+
+	// dsrm_enabled
+	if !checkEnvBool("DSRM_ENABLED") {
+		errorcount++
+	}
+
+	// entra_enabled
+	if !checkEnvBool("ENTRA_ENABLED") {
+		errorcount++
+	} else if IsEntraEnabled() {
+		for _, key := range []string{"ENTRA_TENANT_ID", "ENTRA_CLIENT_ID", "ENTRA_CLIENT_SECRET"} {
+			if os.Getenv(key) == "" {
+				log.Error("GetAndCheckEnvironment: ", key, " is required with ENTRA_ENABLED")
+				errorcount++
+			}
+		}
+	}
+
+	// ldap_tls_mode
+	switch GetLdapTLSMode() {
+	case ldapTLSModeAuto, ldapTLSModeLdaps, ldapTLSModeStartTLS, ldapTLSModeNone:
+		log.Debug("GetAndCheckEnvironment: LDAP_TLS_MODE is ", GetLdapTLSMode())
+	default:
+		log.Error("GetAndCheckEnvironment: LDAP_TLS_MODE must be auto, ldaps, starttls or none")
+		errorcount++
+	}
+	if GetLdapTLSMode() == ldapTLSModeAuto && GetLdapAuthMethod() == ldapAuthSimple && os.Getenv("LDAP_AUTH_PW") != "" {
+		for _, ldapURL := range GetLdapURLs() {
+			if strings.HasPrefix(strings.ToLower(ldapURL), "ldap://") {
+				log.Error("GetAndCheckEnvironment: Simple bind to ", ldapURL, " would send LDAP_AUTH_PW unencrypted, use ldaps://, LDAP_TLS_MODE starttls or allow it with LDAP_TLS_MODE none")
+				errorcount++
+				break
+			}
+		}
+	}
+	if !checkEnvBool("LDAP_TLS_INSECURE_SKIP_VERIFY") {
+		errorcount++
+	}
+	if v := os.Getenv("LDAP_TLS_MIN_VERSION"); v != "" {
+		if _, found := tlsVersions[v]; !found {
+			log.Error("GetAndCheckEnvironment: LDAP_TLS_MIN_VERSION must be 1.0, 1.1, 1.2 or 1.3")
+			errorcount++
+		}
+	}
+
+	// ldap_auth_method
+	switch GetLdapAuthMethod() {
+	case ldapAuthSimple:
+		log.Debug("GetAndCheckEnvironment: LDAP_AUTH_METHOD is ", GetLdapAuthMethod())
+	case ldapAuthKerberos:
+		log.Debug("GetAndCheckEnvironment: LDAP_AUTH_METHOD is ", GetLdapAuthMethod())
+		if os.Getenv("LDAP_KRB5_KEYTAB") != "" && (os.Getenv("LDAP_KRB5_USERNAME") == "" || os.Getenv("LDAP_KRB5_REALM") == "") {
+			log.Error("GetAndCheckEnvironment: LDAP_KRB5_KEYTAB requires LDAP_KRB5_USERNAME and LDAP_KRB5_REALM")
+			errorcount++
+		}
+	case ldapAuthNTLM:
+		log.Debug("GetAndCheckEnvironment: LDAP_AUTH_METHOD is ", GetLdapAuthMethod())
+		if os.Getenv("LDAP_NTLM_USERNAME") == "" {
+			log.Error("GetAndCheckEnvironment: LDAP_NTLM_USERNAME is empty")
+			errorcount++
+		}
+		if os.Getenv("LDAP_AUTH_PW") == "" && os.Getenv("LDAP_NTLM_HASH") == "" {
+			log.Error("GetAndCheckEnvironment: NTLM bind requires LDAP_AUTH_PW or LDAP_NTLM_HASH")
+			errorcount++
+		}
+	default:
+		log.Error("GetAndCheckEnvironment: LDAP_AUTH_METHOD must be simple, kerberos or ntlm")
+		errorcount++
+	}
+
+	// laps_fallback
+	if !checkEnvBool("LAPS_FALLBACK") {
+		errorcount++
+	}
+
+	// laps_sync_history
+	if !checkEnvBool("LAPS_SYNC_HISTORY") {
+		errorcount++
+	} else if getEnvBool("LAPS_SYNC_HISTORY", false) && GetLapsMode() != lapsModeWindows && !getEnvBool("LAPS_FALLBACK", false) {
+		log.Error("GetAndCheckEnvironment: LAPS_SYNC_HISTORY requires LAPS_MODE=windows or LAPS_FALLBACK")
+		errorcount++
+	} else if getEnvBool("LAPS_SYNC_HISTORY", false) && !getEnvBool("LAPS_DECRYPT", false) && getEnv("LDAP_ATTR_PASSWORD_HISTORY", "msLAPS-EncryptedPasswordHistory") == "msLAPS-EncryptedPasswordHistory" {
+		// the history of Windows LAPS is always encrypted
+		log.Error("GetAndCheckEnvironment: LAPS_SYNC_HISTORY with msLAPS-EncryptedPasswordHistory requires LAPS_DECRYPT")
+		errorcount++
+	}
+
+	// laps_decrypt
+	if !checkEnvBool("LAPS_DECRYPT") {
+		errorcount++
+	} else if getEnvBool("LAPS_DECRYPT", false) && GetLapsMode() != lapsModeWindows && !getEnvBool("LAPS_FALLBACK", false) {
+		log.Error("GetAndCheckEnvironment: LAPS_DECRYPT requires LAPS_MODE=windows or LAPS_FALLBACK")
+		errorcount++
+	}
+	if command := os.Getenv("LAPS_DECRYPT_COMMAND"); command != "" {
+		if _, err := splitCommand(command); err != nil {
+			log.Error("GetAndCheckEnvironment: Invalid LAPS_DECRYPT_COMMAND: ", err)
+			errorcount++
+		}
+	}
+
+	if errorcount == 0 {
+		return nil
+	}
+	return errors.New("GetAndCheckEnvironment: Missing required environment variables, see previous errors")
+}
+
+// GetLapsMode returns the configured LAPS_MODE, defaults to legacy
+func GetLapsMode() string {
+	mode := strings.ToLower(os.Getenv("LAPS_MODE"))
+	if mode == "" {
+		return lapsModeLegacy
+	}
+	return mode
+}
+
+// derefAliases maps LDAP_SEARCH_DEREF_ALIASES values to ldap constants
+var derefAliases = map[string]int{
+	"never":     ldap.NeverDerefAliases,
+	"searching": ldap.DerefInSearching,
+	"finding":   ldap.DerefFindingBaseObj,
+	"always":    ldap.DerefAlways,
+}
+
+// GetDerefAliasesName returns the configured LDAP_SEARCH_DEREF_ALIASES, defaults to never
+func GetDerefAliasesName() string {
+	return strings.ToLower(getEnv("LDAP_SEARCH_DEREF_ALIASES", "never"))
+}
+
+// GetDerefAliases returns the ldap constant of LDAP_SEARCH_DEREF_ALIASES
+func GetDerefAliases() int {
+	return derefAliases[GetDerefAliasesName()]
+}
+
+// GetStaleAction returns the configured LDAP_STALE_ACTION, defaults to exclude
+func GetStaleAction() string {
+	action := strings.ToLower(os.Getenv("LDAP_STALE_ACTION"))
+	if action == "" {
+		return staleActionExclude
+	}
+	return action
+}
+
+// getTimeFromFiletime is a helper function and converts
+// windows FILETIME structure (64-bit value representing the number
+// of 100-nanosecond intervals since January 1, 1601 (UTC)) to golang time.Time
+func getTimeFromFiletime(input int64) time.Time {
+	maxd := time.Duration(math.MaxInt64).Truncate(100 * time.Nanosecond)
+	maxdUnits := int64(maxd / 100) // number of 100-ns units
+
+	t := time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)
+	for input > maxdUnits {
+		t = t.Add(maxd)
+		input -= maxdUnits
+	}
+	if input != 0 {
+		t = t.Add(time.Duration(input * 100))
+	}
+	return t
+}
+
+// errNoLapsPassword is returned by readLapsPassword if a computer has no
+// password in the requested LAPS attributes
+var errNoLapsPassword = errors.New("no LAPS password")
+
+// readLapsPassword reads password, expiration and history of the LAPS
+// implementation described by attrs into lapsentry
+func readLapsPassword(entry *ldap.Entry, attrs LapsAttributes, decryptor LapsDecryptor, lapsentry *LapsEntry) error {
+	if attrs.Mode == lapsModeWindows {
+		var wlp windowsLapsPassword
+		var err error
+		var encrypted []byte
+		if attrs.EncryptedPassword != "" {
+			encrypted = entry.GetRawAttributeValue(attrs.EncryptedPassword)
+		}
+		if decryptor != nil && len(encrypted) > 0 {
+			wlp, err = decryptWindowsLapsPassword(decryptor, encrypted)
+			if err != nil {
+				return fmt.Errorf("can't decrypt %s: %v", attrs.EncryptedPassword, err)
+			}
+		} else if entry.GetAttributeValue(attrs.Password) == "" {
+			return errNoLapsPassword
+		} else {
+			wlp, err = parseWindowsLapsPassword(entry.GetAttributeValue(attrs.Password))
+			if err != nil {
+				return fmt.Errorf("can't parse %s: %v", attrs.Password, err)
+			}
+		}
+		lapsentry.account = wlp.Account
+		lapsentry.password = wlp.Password
+		registerSecret(wlp.Password)
+		lapsentry.updated, err = wlp.UpdateTime()
+		if err != nil {
+			lapsentry.problems = append(lapsentry.problems, fmt.Sprintf("malformed %s timestamp %q", attrs.Password, wlp.Timestamp))
+		}
+		if attrs.PasswordHistory != "" {
+			lapsentry.history, err = parseWindowsLapsHistory(entry.GetRawAttributeValues(attrs.PasswordHistory), decryptor)
+			if err != nil {
+				// a partial history would replace the stored one
+				log.Warn("readLapsPassword: Can't read ", attrs.PasswordHistory, " of ", entry.DN, ", the stored history is kept: ", err)
+				lapsentry.history = nil
+				lapsentry.historyFailed = true
+			}
+		}
+	} else {
+		lapsentry.password = entry.GetAttributeValue(attrs.Password)
+		if lapsentry.password == "" {
+			return errNoLapsPassword
+		}
+		registerSecret(lapsentry.password)
+	}
+	lapsentry.source = attrs.Mode
+
+	s := entry.GetAttributeValue(attrs.Expiration)
+	var err error
+	lapsentry.expirationstate, lapsentry.expiration, err = parseFiletime(s)
+	if err != nil && s != "" {
+		lapsentry.problems = append(lapsentry.problems, fmt.Sprintf("malformed %s %q", attrs.Expiration, s))
+	}
+	log.Trace("readLapsPassword: ", lapsentry.dnshostname, " expires ", lapsentry.ExpirationString())
+	return nil
+}
+
+// newLapsEntry converts a ldap search result entry to a LapsEntry
+func newLapsEntry(entry *ldap.Entry, attrs LapsAttributes, decryptor LapsDecryptor) (LapsEntry, error) {
+	hostname, source := getHostname(entry, attrs)
+	if hostname == "" {
+		return LapsEntry{}, errors.New("no dNSHostName, name or sAMAccountName")
+	} else if source != attrs.DNSHostName {
+		log.Info("newLapsEntry: ", entry.DN, " has no ", attrs.DNSHostName, ", using ", source, " ", hostname)
+	}
+	lapsentry := LapsEntry{
+		name:        entry.GetAttributeValue(attrs.Name),
+		dnshostname: hostname,
+		dn:          entry.DN,
+		guid:        formatObjectGUID(entry.GetRawAttributeValue(attrs.ObjectGUID)),
+	}
+	if len(attrs.Extra) > 0 {
+		lapsentry.attributes = map[string]string{}
+		for _, attribute := range attrs.Extra {
+			lapsentry.attributes[attribute] = entry.GetAttributeValue(attribute)
+		}
+	}
+	err := readLapsPassword(entry, attrs, decryptor, &lapsentry)
+	if errors.Is(err, errNoLapsPassword) && attrs.Fallback != nil {
+		log.Debug("newLapsEntry: ", entry.DN, " has no ", attrs.Mode, " LAPS password, trying ", attrs.Fallback.Mode)
+		err = readLapsPassword(entry, *attrs.Fallback, decryptor, &lapsentry)
+	}
+	if err != nil {
+		return lapsentry, err
+	}
+
+	if attrs.OperatingSystem != "" {
+		lapsentry.description = entry.GetAttributeValue(attrs.Description)
+		lapsentry.os = entry.GetAttributeValue(attrs.OperatingSystem)
+		lapsentry.osversion = entry.GetAttributeValue(attrs.OperatingSystemVersion)
+		lapsentry.whencreated, err = parseGeneralizedTime(entry.GetAttributeValue(attrs.WhenCreated))
+		if err != nil {
+			log.Warn("newLapsEntry: Can't convert ", attrs.WhenCreated, " of ", entry.DN)
+		}
+	}
+
+	if attrs.UserAccountControl != "" {
+		lapsentry.dc = hasUACFlag(entry.GetAttributeValue(attrs.UserAccountControl), uacServerTrustAccount)
+	}
+	if staleDays := getEnvInt("LDAP_STALE_DAYS", 0); staleDays > 0 {
+		lapsentry.lastlogon = getLastActivity(entry.GetAttributeValue(attrs.LastLogonTimestamp), entry.GetAttributeValue(attrs.PwdLastSet))
+		lapsentry.stale = time.Since(lapsentry.lastlogon) > time.Duration(staleDays)*24*time.Hour
+		if lapsentry.lastlogon.IsZero() && IsSamba() {
+			// Samba doesn't maintain lastLogonTimestamp for every account,
+			// computers without any activity attribute are not stale
+			lapsentry.stale = false
+		}
+	}
+	return lapsentry, nil
+}
+
+// GetLapsEntries connects to an active directory server
+// and retrieves all computer objects configured with LAPS.
+// With LDAP_DETECT_DELETED the dNSHostNames of computers deleted
+// since the last run are returned as well.
+func GetLapsEntries(ctx context.Context) ([]LapsEntry, []string, error) {
+	lapsentries := []LapsEntry{}
+
+	// LDAP_DEADLINE includes connecting
+	ctx, cancel := NewLdapContext(ctx)
+	defer cancel()
+
+	ldapCON, ldapURL, err := ConnectLdap(ctx)
+	if err != nil {
+		return lapsentries, nil, err
+	}
+	defer ldapCON.Close()
+	log.Info("GetLapsEntries: Connected to ", ldapURL)
+
+	attrs := GetLapsAttributes(GetLapsMode())
+	var decryptor LapsDecryptor
+	if getEnvBool("LAPS_DECRYPT", false) {
+		decryptor, err = NewLapsDecryptor()
+		if err != nil {
+			return lapsentries, nil, err
+		}
+	}
+
+	dnfilter, err := NewDNFilter()
+	if err != nil {
+		return lapsentries, nil, err
+	}
+
+	sitefilter := NewSiteFilter()
+
+	attributes := attrs.List()
+	var gc *globalCatalog
+	if IsGlobalCatalog() {
+		gc = newGlobalCatalog(attrs)
+		defer gc.Close()
+		attributes = attrs.GlobalCatalogList()
+	}
+
+	// added after the global catalog list, which replaces attributes
+	if sitefilter.Enabled() {
+		attributes = append(attributes, "serverReferenceBL")
+	}
+	if IsSkipUnchanged() {
+		attributes = append(attributes, "uSNChanged")
+	}
+
+	filter := memberOfFilter(os.Getenv("LDAP_SEARCH_FILTER"))
+	if len(syncHosts) > 0 {
+		filter = hostsFilter(filter, attrs)
+	} else if IsIncremental() {
+		filter, err = incrementalFilter(ldapCON, filter)
+		if err != nil {
+			return lapsentries, nil, err
+		}
+	}
+
+	seen := map[string]bool{}
+	found := map[string]string{}
+	disabled := 0
+	stale := 0
+	for _, baseDN := range GetSearchBaseDNs() {
+		searchReq := ldap.NewSearchRequest(
+			baseDN,                                 //BaseDN
+			ldap.ScopeWholeSubtree,                 //Scope
+			GetDerefAliases(),                      //DerefAliases
+			getEnvInt("LDAP_SEARCH_SIZE_LIMIT", 0), //SizeLimit
+			getEnvInt("LDAP_SEARCH_TIME_LIMIT", 0), //TimeLimit
+			false,                                  //TypesOnly
+			filter,                                 //Filter
+			attributes,                             //Attributes
+			[]ldap.Control{},                       //Control
+		)
+
+		result, err := searchLdap(ctx, ldapCON, searchReq)
+		if err != nil {
+			return lapsentries, nil, err
+		}
+		log.Debug("GetLapsEntries: Got ", len(result.Entries), " entries from ldap for ", baseDN)
+		for index, entry := range result.Entries {
+			hostname, _ := getHostname(entry, attrs)
+			log.Trace("GetLapsEntries: [", index, "] ", hostname)
+			dn := strings.ToLower(entry.DN)
+			if seen[dn] {
+				log.Trace("GetLapsEntries: Skipped duplicate ", entry.DN)
+				continue
+			}
+			seen[dn] = true
+			if !dnfilter.Match(entry.DN) {
+				log.Trace("GetLapsEntries: Skipped filtered ", entry.DN)
+				continue
+			}
+			if !sitefilter.Match(entry) {
+				log.Trace("GetLapsEntries: Skipped computer of other site ", entry.DN)
+				continue
+			}
+			found[strings.ToLower(entry.GetAttributeValue(attrs.Name))] = hostname
+			if getEnvBool("LDAP_EXCLUDE_DISABLED", false) && isAccountDisabled(entry.GetAttributeValue(attrs.UserAccountControl)) {
+				log.Trace("GetLapsEntries: Skipped disabled ", entry.DN)
+				disabled++
+				continue
+			}
+			if gc != nil {
+				err = gc.resolve(entry)
+				if err != nil {
+					// the run is partial, the items of the domain must not be orphaned
+					log.Error("GetLapsEntries: Skipped ", entry.DN, ", can't read it from its domain: ", err)
+					summary.addError(fmt.Sprintf("%s: %v", entry.DN, err))
+					syncState.unresolved++
+					continue
+				}
+			}
+			lapsentry, err := newLapsEntry(entry, attrs, decryptor)
+			if err != nil {
+				quarantineEntry(entry.DN, hostname, lapsentry.source, err.Error())
+				continue
+			}
+			readUSNChanged(&lapsentry, entry)
+			if lapsentry.stale {
+				stale++
+				if GetStaleAction() == staleActionExclude {
+					log.Trace("GetLapsEntries: Skipped stale ", entry.DN, " last activity ", lapsentry.lastlogon)
+					continue
+				}
+			}
+			lapsentries = append(lapsentries, lapsentry)
+		}
+	}
+	if disabled > 0 {
+		log.Info("GetLapsEntries: Ignored ", disabled, " disabled computers")
+	}
+	if syncState.unresolved > 0 {
+		summary.add("failed", syncState.unresolved)
+		log.Error("GetLapsEntries: Skipped ", syncState.unresolved, " computers of unreachable domains, orphans are not handled")
+	}
+	if stale > 0 {
+		log.Info("GetLapsEntries: Found ", stale, " stale computers, action ", GetStaleAction())
+	}
+	log.Debug("GetLapsEntries: Got ", len(lapsentries), " entries in total")
+
+	if IsBitLockerEnabled() {
+		keys, err := getBitLockerKeys(ctx, ldapCON)
+		if err != nil {
+			return lapsentries, nil, err
+		}
+		for cur_laps_idx := range lapsentries {
+			lapsentries[cur_laps_idx].bitlocker = keys[normalizeDN(lapsentries[cur_laps_idx].dn)]
+		}
+	}
+
+	if IsDSRMEnabled() {
+		dsrmentries, err := getDSRMEntries(ctx, ldapCON, decryptor)
+		if err != nil {
+			return lapsentries, nil, err
+		}
+		lapsentries = append(lapsentries, dsrmentries...)
+	}
+
+	deleted := []string{}
+	if IsDetectDeleted() && len(syncHosts) == 0 {
+		deleted, err = detectDeletedComputers(ldapCON, found)
+		if err != nil {
+			return lapsentries, deleted, err
+		}
+	}
+	return lapsentries, deleted, nil
+}
+
+// GetOnePassEntries connects to an 1Password Connect-Server
+// and retrieves all items from the destination vaults. Items are listed
+// as summaries first, with OP_LOAD_ITEMS=managed only the summaries carrying
+// the managedTag are fetched in full, by OP_READ_WORKERS concurrent requests.
+// OP_MANAGED_ONLY drops all items without managedTag or ownership marker.
+func GetOnePassEntries(ctx context.Context) (items []onepassword.Item, err error) {
+	ctx, span := tracer.Start(ctx, "op.list", trace.WithAttributes(attribute.StringSlice("vaults", GetVaultTitles())))
+	defer func() {
+		span.SetAttributes(attribute.Int("op.items", len(items)))
+		endSpan(span, err)
+	}()
+	opEmptyItems := []onepassword.Item{}
+	opListItems := []onepassword.Item{}
+
+	client, err := NewOnePassClient()
+	if err != nil {
+		return opEmptyItems, err
+	}
+	ctx, cancel := NewOnePassListContext(ctx)
+	defer cancel()
+
+	managedOnly := strings.ToLower(getEnv("OP_LOAD_ITEMS", "all")) == "managed"
+	for _, title := range GetVaultTitles() {
+		var vault onepassword.Vault
+		err = callWithContext(ctx, func() (err error) {
+			vault, err = getVault(client, title)
+			return err
+		})
+		if err != nil {
+			return opEmptyItems, err
+		}
+		log.Debug("GetOnePassEntries: Found vault ", vault.Name)
+
+		var vaultListItems []onepassword.Item
+		err = callWithContext(ctx, func() (err error) {
+			vaultListItems, err = client.GetItems(vault.ID)
+			return err
+		})
+		if err != nil {
+			return opEmptyItems, err
+		}
+		log.Debug("GetOnePassEntries: Got ", len(vaultListItems), " list entries from onepass vault ", vault.Name)
+
+		for _, opListItem := range vaultListItems {
+			if managedOnly && !containsString(opListItem.Tags, managedTag) {
+				continue
+			}
+			opListItems = append(opListItems, opListItem)
+		}
+	}
+	if managedOnly {
+		log.Debug("GetOnePassEntries: Loading ", len(opListItems), " items tagged ", managedTag)
+	}
+	opFullItems, err := getFullOnePassEntries(ctx, client, opListItems)
+	if err != nil || !getEnvBool("OP_MANAGED_ONLY", false) {
+		return opFullItems, err
+	}
+
+	// ignore items of users, even with the title of a computer
+	opManagedItems := []onepassword.Item{}
+	for _, opFullItem := range opFullItems {
+		if containsString(opFullItem.Tags, managedTag) || isManagedItem(opFullItem) {
+			opManagedItems = append(opManagedItems, opFullItem)
+		}
+	}
+	log.Info("GetOnePassEntries: Ignored ", len(opFullItems)-len(opManagedItems), " items not managed by laps2onepassword")
+	return opManagedItems, nil
+}
+
+// getFullOnePassEntries fetches the full items of the summaries opListItems
+// with OP_READ_WORKERS concurrent requests
+func getFullOnePassEntries(ctx context.Context, client connect.Client, opListItems []onepassword.Item) ([]onepassword.Item, error) {
+	opFullItems := make([]onepassword.Item, len(opListItems))
+	errs := make([]error, len(opListItems))
+	workers := getEnvInt("OP_READ_WORKERS", 1)
+	if workers < 1 {
+		workers = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				var opFullItem *onepassword.Item
+				err := callWithContext(ctx, func() (err error) {
+					opFullItem, err = client.GetItem(opListItems[index].ID, opListItems[index].Vault.ID)
+					return err
+				})
+				if err != nil {
+					errs[index] = err
+					continue
+				}
+				log.Trace("GetOnePassEntries: [", index, "] ", opFullItem.Title)
+				opFullItems[index] = *opFullItem
+			}
+		}()
+	}
+	for index := range opListItems {
+		select {
+		case indexes <- index:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return []onepassword.Item{}, fmt.Errorf("reading 1Password items aborted: %w", ctx.Err())
+	}
+	for _, err := range errs {
+		if err != nil {
+			return []onepassword.Item{}, err
+		}
+	}
+	return opFullItems, nil
+}
+
+// CompareLapsToOnepass compares all entries from LAPS with all entries
+// from 1Passwort, if a item from LAPS not found it will be created.
+// Writes run concurrently with OP_WRITE_WORKERS, a failed item doesn't stop
+// the others and all failures are returned together.
+func CompareLapsToOnepass(ctx context.Context, lapsentries []LapsEntry, onepassentries []onepassword.Item) error {
+	_created_total := 0
+	_updated_total := 0
+	_unchanged_total := 0
+	_conflict_total := 0
+	jobs := []writeJob{}
+	var cur_laps_idx = 0
+	for cur_laps_idx = range lapsentries { // use index because it's faster (no copy)
+		lapsentry := lapsentries[cur_laps_idx]
+		cur_op_idx, lapsentry_found := findOnePassEntry(lapsentry, onepassentries)
+		if lapsentry_found {
+			log.Trace("CompareLapsToOnepass: Found lapsentry ", lapsentry.dnshostname, " in onepassentries")
+			if NeedsUpdate(onepassentries[cur_op_idx], lapsentry) {
+				log.Info("CompareLapsToOnepass: Update required ", lapsentry.dnshostname)
+				onepassentry := onepassentries[cur_op_idx]
+				if isManuallyEdited(onepassentry, lapsentry) {
+					switch GetConflictPolicy() {
+					case conflictPolicySkip:
+						log.Warn("CompareLapsToOnepass: ", onepassentry.Title, " was edited manually, skipped")
+						summary.addItem(itemResult{Title: onepassentry.Title, Destination: destinationOnePassword, Vault: onepassentry.Vault.ID, Action: "skipped", Reason: "item edited manually"})
+						_conflict_total++
+						continue
+					case conflictPolicyDuplicate:
+						log.Warn("CompareLapsToOnepass: ", onepassentry.Title, " was edited manually, creating a new item")
+						jobs = append(jobs, writeJob{title: lapsentry.Title(), kind: "created", entry: &lapsentry, destination: destinationOnePassword, vault: getVaultIDFor(lapsentry), reason: "item edited manually, duplicated", write: func() error {
+							err := detachOnePassEntry(onepassentry)
+							if err != nil {
+								return err
+							}
+							return CreateOnPassEntryFromLapsEntry(lapsentry)
+						}})
+						continue
+					}
+					log.Warn("CompareLapsToOnepass: ", onepassentry.Title, " was edited manually, overwriting")
+				}
+				jobs = append(jobs, writeJob{title: lapsentry.Title(), kind: "updated", entry: &lapsentry, destination: destinationOnePassword, vault: onepassentry.Vault.ID, reason: "laps entry changed", write: func() error {
+					return UpdateOnPassEntry(onepassentry, lapsentry)
+				}})
+			} else {
+				log.Trace("CompareLapsToOnepass: Unchanged ", lapsentry.dnshostname, ", skipped")
+				recordHostState(destinationOnePassword, lapsentry)
+				summary.addItem(itemResult{Title: onepassentries[cur_op_idx].Title, Destination: destinationOnePassword, Vault: onepassentries[cur_op_idx].Vault.ID, Action: "unchanged"})
+				_unchanged_total++
+			}
+		} else {
+			log.Trace("CompareLapsToOnepass: Not found lapsentry ", lapsentry.dnshostname, " in onepassentries")
+			jobs = append(jobs, writeJob{title: lapsentry.Title(), kind: "created", entry: &lapsentry, destination: destinationOnePassword, vault: getVaultIDFor(lapsentry), reason: "new computer", write: func() error {
+				return CreateOnPassEntryFromLapsEntry(lapsentry)
+			}})
+		}
+	}
+	results := runWriteJobs(ctx, jobs)
+	for _, result := range results {
+		if result.err != nil {
+			continue
+		}
+		switch result.job.kind {
+		case "created":
+			_created_total++
+		case "updated":
+			_updated_total++
+		}
+	}
+	summary.add("unchanged", _unchanged_total)
+	summary.addResults(results)
+	log.Infof("CompareLapsToOnepass: Total created=%d updated=%d unchanged=%d conflicts=%d failed=%d interrupted=%d", _created_total, _updated_total, _unchanged_total, _conflict_total, countFailed(results), countInterrupted(results))
+	err := writeErrors(results)
+	if err != nil {
+		log.Error("CompareLapsToOnepass: ", err)
+	}
+	return err
+}
+
+// TagOrphanedOnePassEntries tags the items of deleted computers as orphaned
+func TagOrphanedOnePassEntries(hostnames []string, onepassentries []onepassword.Item) error {
+	client, err := NewOnePassClient()
+	if err != nil {
+		log.Error("TagOrphanedOnePassEntries: ", err)
+		return err
+	}
+	_tagged_total := 0
+	for _, hostname := range hostnames {
+		for cur_op_idx := range onepassentries {
+			onepassentry := onepassentries[cur_op_idx]
+			if onepassentry.Title != hostname {
+				continue
+			}
+			if !isManagedItem(onepassentry) && !flag_force {
+				log.Warn("TagOrphanedOnePassEntries: Skipped ", hostname, ", not managed by laps2onepassword")
+				continue
+			}
+			if flag_dry_run {
+				printDryRun("~", hostname, "tag "+orphanedTag)
+				_tagged_total++
+				continue
+			}
+			setItemTag(&onepassentry, orphanedTag, true)
+			markItemSynced(&onepassentry)
+			_, err = client.UpdateItem(&onepassentry, onepassentry.Vault.ID)
+			writeAudit("tagged", destinationOnePassword, onepassentry.Vault.ID, hostname, "computer deleted", err)
+			summary.addItem(newItemResult(hostname, destinationOnePassword, onepassentry.Vault.ID, "tagged", "computer deleted", err))
+			if err != nil {
+				log.Error("TagOrphanedOnePassEntries: ", err)
+				return err
+			}
+			log.Info("TagOrphanedOnePassEntries: Tagged ", hostname, " as ", orphanedTag)
+			_tagged_total++
+		}
+	}
+	log.Infof("TagOrphanedOnePassEntries: Total tagged=%d", _tagged_total)
+	return nil
+}
+
+// CreateOnPassEntryFromLapsEntry creates a new item in 1Passwort
+func CreateOnPassEntryFromLapsEntry(lapsEntry LapsEntry) error {
+	log.Info("CreateOnPassEntryFromLapsEntry: ", lapsEntry.dnshostname)
+	if flag_dry_run {
+		printDryRun("+", lapsEntry.Title(), "from "+lapsEntry.source+" LAPS")
+		return nil
+	}
+	client, err := NewOnePassClient()
+	if err != nil {
+		log.Error("CreateOnPassEntryFromLapsEntry: ", err)
+		return err
+	}
+	vault, err := getVault(client, GetVaultTitleFor(lapsEntry))
+	if err != nil {
+		log.Error("CreateOnPassEntryFromLapsEntry: ", err)
+		return err
+	}
+	opitem, err := newOnePassItem(lapsEntry, vault.ID)
+	if err != nil {
+		log.Error("CreateOnPassEntryFromLapsEntry: ", err)
+		return err
+	}
+
+	opCreatedItem, err := client.CreateItem(&opitem, vault.ID)
+	if err != nil {
+		log.Error("CreateOnPassEntryFromLapsEntry: ", err)
+		return err
+	}
+	log.Infof("CreateOnPassEntryFromLapsEntry: %s successfully", opCreatedItem.Title)
+
+	return nil
+}
+
+// newOnePassItem returns the new item of lapsEntry in vaultID
+func newOnePassItem(lapsEntry LapsEntry, vaultID string) (onepassword.Item, error) {
+	opitem := onepassword.Item{
+		ID:       uuid.New().String(),
+		Category: GetItemCategory(),
+		Title:    lapsEntry.Title(),
+		Vault: onepassword.ItemVault{
+			ID: vaultID,
+		},
+	}
+	getItemCredentialField(&opitem, "USERNAME", "Username").Value = lapsEntry.Username()
+	getItemCredentialField(&opitem, "PASSWORD", "Password").Value = lapsEntry.password
+	getItemCredentialField(&opitem, "NOTES", "notesPlain")
+	if lapsEntry.stale {
+		opitem.Tags = append(opitem.Tags, staleTag)
+	}
+	err := setItemNotes(&opitem, lapsEntry, "Created")
+	if err != nil {
+		return opitem, err
+	}
+	setItemSectionFields(&opitem, syncSectionID, "laps2onepassword", syncFields(lapsEntry))
+	if getEnvBool("LDAP_SYNC_COMPUTER_INFO", false) {
+		setItemSectionFields(&opitem, computerInfoSectionID, "Computer info", computerInfoFields(lapsEntry))
+	}
+	if syncsHistory(lapsEntry) {
+		replaceItemSectionFields(&opitem, passwordHistorySectionID, "Password history", passwordHistoryFields(lapsEntry))
+	}
+	if IsBitLockerEnabled() {
+		replaceItemSectionFields(&opitem, bitlockerSectionID, "BitLocker", bitlockerFields(lapsEntry))
+	}
+
+	err = setItemTags(&opitem, lapsEntry)
+	if err != nil {
+		return opitem, err
+	}
+	err = setItemFavoriteAndIcon(&opitem, lapsEntry)
+	if err != nil {
+		return opitem, err
+	}
+	err = setItemURLs(&opitem, lapsEntry)
+	if err != nil {
+		return opitem, err
+	}
+	if itemTemplate != nil {
+		err = itemTemplate.apply(&opitem, lapsEntry)
+		if err != nil {
+			return opitem, err
+		}
+	}
+
+	return opitem, nil
+}
+
+// findOnePassEntry returns the index of the item of lapsEntry in its vault, matched by
+// objectGUID so renamed computers keep their item, and by title for items
+// created before the objectGUID was stored
+func findOnePassEntry(lapsEntry LapsEntry, onepassentries []onepassword.Item) (int, bool) {
+	vaultID := getVaultIDFor(lapsEntry)
+	if lapsEntry.guid != "" {
+		for cur_op_idx := range onepassentries {
+			if onepassentries[cur_op_idx].Vault.ID != vaultID {
+				continue
+			}
+			if getItemSectionValue(onepassentries[cur_op_idx], syncSectionID, "objectGUID") == lapsEntry.guid {
+				return cur_op_idx, true
+			}
+		}
+	}
+	for cur_op_idx := range onepassentries {
+		if onepassentries[cur_op_idx].Vault.ID == vaultID && onepassentries[cur_op_idx].Title == lapsEntry.Title() {
+			return cur_op_idx, true
+		}
+	}
+	return 0, false
+}
+
+// syncFields returns the laps2onepassword metadata of lapsEntry as item fields
+func syncFields(lapsEntry LapsEntry) []itemField {
+	return append([]itemField{
+		{label: "objectGUID", value: lapsEntry.guid},
+		{label: "distinguishedName", value: lapsEntry.dn},
+		{label: "Password expires", value: expirationDate(lapsEntry), fieldType: "DATE"},
+		{label: syncHashLabel, value: newSyncHash(lapsEntry), fieldType: "CONCEALED"},
+		lastSyncedField(),
+	}, ownershipFields(lapsEntry)...)
+}
+
+// expirationDate returns the expiration of lapsEntry as DATE field value,
+// empty if it never expires or is unknown
+func expirationDate(lapsEntry LapsEntry) string {
+	if lapsEntry.expirationstate != expirationKnown {
+		return ""
+	}
+	return lapsEntry.expiration.Local().Format("2006-01-02")
+}
+
+// NeedsUpdate returns true if the synced content of lapsEntry changed since
+// the last write (sync hash) or the password or username of onepassentry
+// differs from lapsEntry
+func NeedsUpdate(onepassentry onepassword.Item, lapsEntry LapsEntry) bool {
+	return len(changedFields(onepassentry, lapsEntry)) > 0
+}
+
+// UpdateOnPassEntry fetches the current version of onepassentry and writes
+// password, username and notes of lapsEntry into it
+func UpdateOnPassEntry(onepassentry onepassword.Item, lapsEntry LapsEntry) error {
+	log.Info("UpdateOnPassEntry: ", lapsEntry.dnshostname)
+	err := checkManagedItem(onepassentry)
+	if err != nil {
+		log.Error("UpdateOnPassEntry: ", err)
+		return err
+	}
+	if flag_dry_run {
+		printDryRun("~", onepassentry.Title, changedFields(onepassentry, lapsEntry)...)
+		return nil
+	}
+	client, err := NewOnePassClient()
+	if err != nil {
+		log.Error("UpdateOnPassEntry: ", err)
+		return err
+	}
+
+	opitem, err := client.GetItem(onepassentry.ID, onepassentry.Vault.ID)
+	if err != nil {
+		log.Error("UpdateOnPassEntry: ", err)
+		return err
+	}
+
+	getItemCredentialField(opitem, "USERNAME", "Username").Value = lapsEntry.Username()
+	passwordField := getItemCredentialField(opitem, "PASSWORD", "Password")
+	if passwordField.Value != "" && passwordField.Value != lapsEntry.password && GetPreviousPasswordsLimit() > 0 {
+		addPreviousPassword(opitem, passwordField.Value, time.Now())
+	}
+	passwordField.Value = lapsEntry.password
+	err = setItemNotes(opitem, lapsEntry, "Updated")
+	if err != nil {
+		log.Error("UpdateOnPassEntry: ", err)
+		return err
+	}
+
+	opitem.Title = lapsEntry.Title()
+	setItemTag(opitem, staleTag, lapsEntry.stale)
+	setItemTag(opitem, orphanedTag, false)
+	setItemSectionFields(opitem, syncSectionID, "laps2onepassword", syncFields(lapsEntry))
+	if getEnvBool("LDAP_SYNC_COMPUTER_INFO", false) {
+		setItemSectionFields(opitem, computerInfoSectionID, "Computer info", computerInfoFields(lapsEntry))
+	}
+	if syncsHistory(lapsEntry) {
+		replaceItemSectionFields(opitem, passwordHistorySectionID, "Password history", passwordHistoryFields(lapsEntry))
+	}
+	if IsBitLockerEnabled() {
+		replaceItemSectionFields(opitem, bitlockerSectionID, "BitLocker", bitlockerFields(lapsEntry))
+	}
+
+	err = setItemTags(opitem, lapsEntry)
+	if err != nil {
+		log.Error("UpdateOnPassEntry: ", err)
+		return err
+	}
+	err = setItemFavoriteAndIcon(opitem, lapsEntry)
+	if err != nil {
+		log.Error("UpdateOnPassEntry: ", err)
+		return err
+	}
+	err = setItemURLs(opitem, lapsEntry)
+	if err != nil {
+		log.Error("UpdateOnPassEntry: ", err)
+		return err
+	}
+	if itemTemplate != nil {
+		err = itemTemplate.apply(opitem, lapsEntry)
+		if err != nil {
+			log.Error("UpdateOnPassEntry: ", err)
+			return err
+		}
+	}
+
+	_, err = client.UpdateItem(opitem, opitem.Vault.ID)
+	if err != nil {
+		log.Error("UpdateOnPassEntry: ", err)
+		return err
+	}
+
+	log.Infof("UpdateOnPassEntry: %s successfully", opitem.Title)
+	return nil
+}
+
+// computerInfoSectionID identifies the item section holding computer info
+const computerInfoSectionID = "computerinfo"
+
+// computerInfoFields returns the computer info of lapsEntry as item fields
+func computerInfoFields(lapsEntry LapsEntry) []itemField {
+	whencreated := ""
+	if !lapsEntry.whencreated.IsZero() {
+		whencreated = lapsEntry.whencreated.Format(time.RFC3339)
+	}
+	return []itemField{
+		{label: "Description", value: lapsEntry.description},
+		{label: "Operating system", value: lapsEntry.os},
+		{label: "Operating system version", value: lapsEntry.osversion},
+		{label: "Distinguished name", value: ""}, // moved to syncFields, removed from older items
+		{label: "Created", value: whencreated},
+	}
+}
+
+// passwordHistorySectionID identifies the item section holding previous passwords
+const passwordHistorySectionID = "passwordhistory"
+
+// syncsHistory returns true if the password history of lapsEntry is
+// written, not if it couldn't be read
+func syncsHistory(lapsEntry LapsEntry) bool {
+	return getEnvBool("LAPS_SYNC_HISTORY", false) && !lapsEntry.historyFailed
+}
+
+// passwordHistoryFields returns the password history of lapsEntry as
+// concealed item fields labeled with the time the password was set
+func passwordHistoryFields(lapsEntry LapsEntry) []itemField {
+	fields := []itemField{}
+	for _, h := range lapsEntry.history {
+		fields = append(fields, itemField{
+			label:     h.updated.Format(time.RFC3339),
+			value:     h.password,
+			fieldType: "CONCEALED",
+		})
+	}
+	return fields
+}
+
+// previousPasswordsSectionID identifies the item section holding passwords
+// replaced by updates
+const previousPasswordsSectionID = "previouspasswords"
+
+// GetPreviousPasswordsLimit returns the number of replaced passwords kept in
+// the "Previous passwords" section (OP_PREVIOUS_PASSWORDS), 0 disables it
+func GetPreviousPasswordsLimit() int {
+	return getEnvInt("OP_PREVIOUS_PASSWORDS", 0)
+}
+
+// addPreviousPassword adds password, replaced at rotated, as first field of
+// the "Previous passwords" section of item, only the newest
+// GetPreviousPasswordsLimit passwords are kept
+func addPreviousPassword(item *onepassword.Item, password string, rotated time.Time) {
+	fields := []itemField{{label: rotated.UTC().Format(time.RFC3339), value: password, fieldType: "CONCEALED"}}
+	for _, field := range item.Fields {
+		if field.Section != nil && field.Section.ID == previousPasswordsSectionID && field.Label != fields[0].label {
+			fields = append(fields, itemField{label: field.Label, value: field.Value, fieldType: "CONCEALED"})
+		}
+	}
+	// labels are UTC RFC3339 timestamps, which sort chronologically
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].label > fields[j].label })
+	if len(fields) > GetPreviousPasswordsLimit() {
+		fields = fields[:GetPreviousPasswordsLimit()]
+	}
+	replaceItemSectionFields(item, previousPasswordsSectionID, "Previous passwords", fields)
+}
+
+// main start of this programm
+func main() {
+
+	flag.Parse()
+	InitLogger()
+
+	log.Debug("Main: Start programm")
+
+	if flag_version {
+		fmt.Println(versionString())
+		os.Exit(exitOK)
+	}
+
+	// Commands
+	flag.Usage = usage
+	command, args, err := parseCommandLine()
+	if isHelp(err) {
+		os.Exit(exitOK)
+	}
+	if err != nil {
+		log.Error("Main: ", err)
+		os.Exit(exitConfig)
+	}
+	arg := ""
+	if len(args) > 0 {
+		arg = args[0]
+	}
+	switch command {
+	case "version":
+		fmt.Println(versionString())
+		os.Exit(exitOK)
+	case "init":
+		// there are no settings yet
+		path := arg
+		if path == "" {
+			path = GetConfigFile()
+		}
+		err = RunInit(context.Background(), path)
+		if err != nil {
+			log.Error("Main: ", err)
+			os.Exit(exitConfig)
+		}
+		os.Exit(exitOK)
+	case "uninstall-schedule":
+		// also with settings broken meanwhile
+		godotenv.Load()
+		err = UninstallSchedule()
+		if err != nil {
+			log.Error("Main: ", err)
+			os.Exit(exitError)
+		}
+		os.Exit(exitOK)
+	case "keyring-set":
+		// before the settings are checked, they may refer to it already
+		godotenv.Load()
+		err = SetKeyringSecret(arg)
+		if err != nil {
+			log.Error("Main: ", err)
+			os.Exit(exitConfig)
+		}
+		os.Exit(exitOK)
+	}
+
+	// Get and check environment
+	// Set logging options
+	err = GetAndCheckEnvironment()
+	if command == "check-config" || command == "doctor" {
+		os.Exit(RunDoctor(context.Background(), err))
+	}
+	if err != nil {
+		log.Error("Main: ", err)
+		os.Exit(exitConfig)
+	}
+	err = InstallConnectHTTPClient()
+	if err != nil {
+		log.Error("Main: ", err)
+		os.Exit(exitConfig)
+	}
+	err = InitTracing()
+	if err != nil {
+		log.Error("Main: ", err)
+		os.Exit(exitConfig)
+	}
+	err = InitSentry()
+	if err != nil {
+		log.Error("Main: ", err)
+		os.Exit(exitConfig)
+	}
+	defer reportPanic()
+
+	// SIGINT and SIGTERM stop after the items in progress
+	ctx, stop := NewSignalContext()
+	defer stop()
+
+	switch command {
+	case "sync":
+	case "export":
+		_, err = GetExportFields()
+		if err != nil {
+			log.Error("Main: ", err)
+			os.Exit(exitConfig)
+		}
+		// keep stdout clean for the export
+		if flag_out == "" {
+			setConsoleLogOutput()
+		}
+	case "verify":
+		if !usesOnePassword() {
+			log.Error("Main: verify requires 1password in DESTINATION")
+			os.Exit(exitConfig)
+		}
+	case "get":
+		err = GetLapsPassword(ctx, arg)
+		if err != nil {
+			log.Error("Main: ", err)
+			os.Exit(exitLdap)
+		}
+		os.Exit(exitOK)
+	case "rotate":
+		err = RotateLapsPassword(ctx, arg)
+		if err != nil {
+			log.Error("Main: ", err)
+			os.Exit(exitLdap)
+		}
+		os.Exit(exitOK)
+	case "import":
+		if arg == "" || os.Getenv("OP_ORPHAN_ARCHIVE_VAULT") == "" || !usesOnePassword() {
+			log.Error("Main: import requires a file, 1password in DESTINATION and OP_ORPHAN_ARCHIVE_VAULT")
+			os.Exit(exitConfig)
+		}
+		ctx, cancel := NewRunContext(ctx)
+		defer cancel()
+		os.Exit(withLock(ctx, func() int {
+			logRunStart("import")
+			ctx, span := startRunSpan(ctx, "import")
+			code := commandExitCode(ctx, ImportOnePassEntries(ctx, arg))
+			endRunSpan(span, code)
+			reportRun("import", code)
+			return code
+		}))
+	case "dedupe":
+		ctx, cancel := NewRunContext(ctx)
+		defer cancel()
+		os.Exit(withLock(ctx, func() int {
+			logRunStart("dedupe")
+			ctx, span := startRunSpan(ctx, "dedupe")
+			code := commandExitCode(ctx, DedupeOnePassEntries(ctx))
+			endRunSpan(span, code)
+			reportRun("dedupe", code)
+			return code
+		}))
+	case "install-schedule":
+		err = InstallSchedule(flag_every)
+		if err != nil {
+			log.Error("Main: ", err)
+			os.Exit(exitError)
+		}
+		os.Exit(exitOK)
+	case "list":
+		setConsoleLogOutput()
+		err = ListSecrets(ctx)
+		if err != nil {
+			log.Error("Main: ", err)
+			os.Exit(exitDestination)
+		}
+		os.Exit(exitOK)
+	}
+
+	err = checkOutput(command)
+	if err != nil {
+		log.Error("Main: ", err)
+		os.Exit(exitConfig)
+	}
+	if flag_daemon {
+		if command != "sync" {
+			log.Error("Main: --daemon only supports sync")
+			os.Exit(exitConfig)
+		}
+		if len(flag_hosts) > 0 {
+			log.Error("Main: --host can't be used with --daemon, use WEBHOOK_LISTEN")
+			os.Exit(exitConfig)
+		}
+		os.Exit(withLock(ctx, func() int { return RunDaemon(ctx, command) }))
+	}
+	if command == "sync" {
+		hosts, err := readHosts(flag_hosts, os.Stdin)
+		if err != nil {
+			log.Error("Main: ", err)
+			os.Exit(exitConfig)
+		}
+		os.Exit(withLock(ctx, func() int { return runSync(ctx, command, hosts) }))
+	}
+	os.Exit(runSync(ctx, command, nil))
+}
+
+// runSync reads the LAPS entries of hosts (all if empty) and runs command
+// (sync, verify or export) with them, returns the exit code. When ctx is
+// cancelled the items in progress are finished, the totals written so far
+// are logged and exitInterrupted is returned without saving the state,
+// exitDeadline if the run was stopped by RUN_DEADLINE.
+func runSync(ctx context.Context, command string, hosts []string) (code int) {
+	ctx, cancel := NewRunContext(ctx)
+	defer cancel()
+	ctx, span := startRunSpan(ctx, command)
+	span.SetAttributes(attribute.StringSlice("hosts", hosts))
+	defer func() {
+		endRunSpan(span, code)
+		reportRun(command, code)
+	}()
+	summary = newRunSummary()
+	if IsJSONOutput() {
+		// stdout is reserved for the result
+		setConsoleLogOutput()
+		defer func() {
+			writeRunResult(command, code)
+		}()
+	}
+	logRunStart(command)
+	if command != "export" && command != "verify" {
+		defer func() {
+			summary.Log(code)
+			NotifyRun(code)
+		}()
+	}
+
+	// each run starts from the saved state
+	syncState = &SyncState{HighestUSN: map[string]int64{}}
+	quarantine = []QuarantinedEntry{}
+	syncHosts = hosts
+
+	// Check access to onepass before reading ldap
+	if usesOnePassword() && command != "export" {
+		err := CheckOnePassAccess()
+		if err != nil {
+			log.Error("runSync: 1Password pre-flight check failed: ", err)
+			return exitDestination
+		}
+	}
+
+	// verify and export always read all computers and don't touch the state
+	if UsesSyncState() && command != "verify" && command != "export" {
+		err := LoadSyncState()
+		if err != nil {
+			log.Error("runSync: ", err)
+			return exitError
+		}
+	}
+
+	// Get entries from ldap
+	lapsentries, deleted, err := GetLapsEntries(ctx)
+	if ctx.Err() != nil {
+		log.Warn("runSync: Interrupted while reading ldap, nothing written")
+		return stoppedCode(ctx)
+	}
+	if err != nil {
+		log.Error("runSync: ", err)
+		return exitLdap
+	}
+
+	// Get entries from entra
+	if IsEntraEnabled() {
+		entraentries, err := GetEntraLapsEntries(ctx)
+		if ctx.Err() != nil {
+			log.Warn("runSync: Interrupted while reading entra, nothing written")
+			return stoppedCode(ctx)
+		}
+		if err != nil {
+			log.Error("runSync: ", err)
+			return exitLdap
+		}
+		lapsentries = MergeLapsEntries(lapsentries, entraentries)
+	}
+
+	// Restrict the run to the computers of SYNC_INCLUDE and SYNC_EXCLUDE
+	syncHostFilter, err = NewHostFilter()
+	if err != nil {
+		log.Error("runSync: ", err)
+		return exitConfig
+	}
+	lapsentries = syncHostFilter.FilterLapsEntries(lapsentries)
+
+	// Restrict a targeted run to its computers
+	if len(hosts) > 0 {
+		selected := []LapsEntry{}
+		for _, lapsentry := range lapsentries {
+			if isSyncHost(lapsentry) {
+				selected = append(selected, lapsentry)
+			}
+		}
+		lapsentries = selected
+		if len(lapsentries) < 1 {
+			log.Error("runSync: ", strings.Join(hosts, ", "), " not found")
+			return exitLdap
+		}
+		if missing := missingHosts(lapsentries); len(missing) > 0 {
+			log.Warn("runSync: ", strings.Join(missing, ", "), " not found, syncing the others")
+		}
+	}
+
+	// Quarantine invalid entries
+	summary.read = len(lapsentries)
+	lapsentries = ValidateLapsEntries(lapsentries)
+	summary.quarantined = len(quarantine)
+	err = WriteQuarantineReport()
+	if err != nil {
+		log.Error("runSync: Can't write quarantine report: ", err)
+	}
+
+	if len(lapsentries) < 1 {
+		if !IsIncremental() {
+			log.Error("runSync: No entries returned from ldap")
+			return exitLdap
+		}
+		log.Info("runSync: No changed entries returned from ldap")
+	}
+
+	// Export without writing
+	if command == "export" {
+		err = ExportLapsEntries(lapsentries)
+		if err != nil {
+			log.Error("runSync: ", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	// Verify onepass against ldap without writing
+	if command == "verify" {
+		onepassentries, err := GetOnePassEntries(ctx)
+		if err != nil {
+			log.Error("runSync: ", err)
+			return exitDestination
+		}
+		if VerifyOnePassEntries(lapsentries, onepassentries) > 0 {
+			return exitDrift
+		}
+		return exitOK
+	}
+
+	// Write the changed entries to all destinations
+	lapsentries = SkipUnchangedHosts(lapsentries)
+	failed := []string{}
+	if len(lapsentries) > 0 || len(deleted) > 0 || !isPartialRun() {
+		failed = SyncDestinations(ctx, lapsentries, deleted)
+	}
+	if ctx.Err() != nil {
+		log.Warn("runSync: Interrupted, partial run of ", len(lapsentries), " entries, see the totals above. The watermarks are not saved, the next run syncs the rest")
+		if err := SaveHostStates(); err != nil {
+			log.Error("runSync: ", err)
+		}
+		return stoppedCode(ctx)
+	}
+	if len(failed) > 0 {
+		log.Error("runSync: Aborted due to previous error in ", strings.Join(failed, ", "))
+		if err := SaveHostStates(); err != nil {
+			log.Error("runSync: ", err)
+		}
+		if len(failed) < len(GetDestinations()) || summary.written() > 0 {
+			return exitPartial
+		}
+		return exitDestination
+	}
+	if flag_dry_run {
+		log.Info("runSync: Dry run, nothing written to ", strings.Join(GetDestinations(), ", "))
+		return exitOK
+	}
+	if syncState.unresolved > 0 {
+		// the watermarks would skip the unresolved computers in the next run
+		if err := SaveHostStates(); err != nil {
+			log.Error("runSync: ", err)
+		}
+		return exitPartial
+	}
+	if UsesSyncState() && len(hosts) == 0 {
+		err = SaveSyncState()
+		if err != nil {
+			log.Error("runSync: ", err)
+			return exitError
+		}
 	}
-	log.Debug("Main: Successfully exit")
-	os.Exit(0)
+	log.Debug("runSync: Successfully synced")
+	return exitOK
 }
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Supported NOTIFY_ON values
+const (
+	notifyOnAlways  = "always"
+	notifyOnChanges = "changes" // runs with writes or failures
+	notifyOnFailure = "failure"
+)
+
+// notifyMaxErrors is the number of error messages sent with a notification
+const notifyMaxErrors = 20
+
+// runNotification is the content of a notification, the json body of
+// NOTIFY_WEBHOOK_URL. It never contains passwords, the errors are redacted.
+type runNotification struct {
+	Host        string   `json:"host"`
+	RunID       string   `json:"runId"`
+	Status      string   `json:"status"`
+	ExitCode    int      `json:"exitCode"`
+	Read        int      `json:"read"`
+	Quarantined int      `json:"quarantined"`
+	Created     int      `json:"created"`
+	Updated     int      `json:"updated"`
+	Unchanged   int      `json:"unchanged"`
+	Orphaned    int      `json:"orphaned"`
+	Failed      int      `json:"failed"`
+	Duration    string   `json:"duration"`
+	Errors      []string `json:"errors,omitempty"`
+}
+
+// GetNotifyOn returns NOTIFY_ON, default failure
+func GetNotifyOn() string {
+	return strings.ToLower(getEnv("NOTIFY_ON", notifyOnFailure))
+}
+
+// isNotifyEnabled returns true if any notification channel is configured
+func isNotifyEnabled() bool {
+	for _, key := range []string{"NOTIFY_SMTP_HOST", "NOTIFY_SLACK_WEBHOOK_URL", "NOTIFY_TEAMS_WEBHOOK_URL", "NOTIFY_WEBHOOK_URL"} {
+		if os.Getenv(key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// summaryErrorHook collects the error messages of the run for notifications
+type summaryErrorHook struct{}
+
+func (summaryErrorHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel}
+}
+
+func (summaryErrorHook) Fire(entry *log.Entry) error {
+	summary.addError(entry.Message)
+	return nil
+}
+
+// InitNotifications collects the errors of every run if notifications or
+// sentry are configured or for --output json
+func InitNotifications() {
+	if isNotifyEnabled() || IsSentryEnabled() || IsJSONOutput() {
+		log.AddHook(summaryErrorHook{})
+	}
+}
+
+// newRunNotification returns the notification of the summary of a run
+// finished with code
+func newRunNotification(s *RunSummary, code int) runNotification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	host, _ := os.Hostname()
+	status := "success"
+	switch code {
+	case exitOK:
+	case exitDrift:
+		status = "drift"
+	case exitPartial:
+		status = "partial failure"
+	case exitInterrupted:
+		status = "interrupted"
+	case exitDeadline:
+		status = "deadline exceeded"
+	default:
+		status = "failed"
+	}
+	return runNotification{
+		Host:        host,
+		RunID:       runID,
+		Status:      status,
+		ExitCode:    code,
+		Read:        s.read,
+		Quarantined: s.quarantined,
+		Created:     s.totals["created"],
+		Updated:     s.totals["updated"],
+		Unchanged:   s.totals["unchanged"],
+		Orphaned:    s.totals["orphaned"],
+		Failed:      s.totals["failed"],
+		Duration:    time.Since(s.started).Round(time.Second).String(),
+		Errors:      append([]string{}, s.errors...),
+	}
+}
+
+// Subject returns the one line summary of n
+func (n runNotification) Subject() string {
+	return fmt.Sprintf("laps2onepassword on %s: sync %s", n.Host, n.Status)
+}
+
+// Text returns n as plain text
+func (n runNotification) Text() string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s (exit code %d, run %s)\n\n", n.Subject(), n.ExitCode, n.RunID)
+	fmt.Fprintf(&text, "Computers read: %d, quarantined: %d\n", n.Read, n.Quarantined)
+	fmt.Fprintf(&text, "Created: %d, updated: %d, unchanged: %d, orphaned: %d, failed: %d\n", n.Created, n.Updated, n.Unchanged, n.Orphaned, n.Failed)
+	fmt.Fprintf(&text, "Duration: %s\n", n.Duration)
+	if len(n.Errors) > 0 {
+		text.WriteString("\nErrors:\n")
+		for _, e := range n.Errors {
+			fmt.Fprintf(&text, "- %s\n", e)
+		}
+	}
+	return text.String()
+}
+
+// NotifyRun sends the summary of a run finished with code to all
+// configured channels as selected by NOTIFY_ON. Failing channels are
+// logged and don't change the exit code.
+func NotifyRun(code int) {
+	if !isNotifyEnabled() || flag_dry_run {
+		return
+	}
+	switch GetNotifyOn() {
+	case notifyOnFailure:
+		if code == exitOK {
+			return
+		}
+	case notifyOnChanges:
+		if code == exitOK && summary.written() == 0 {
+			return
+		}
+	}
+	notification := newRunNotification(summary, code)
+	if os.Getenv("NOTIFY_SMTP_HOST") != "" {
+		if err := sendMailNotification(notification); err != nil {
+			log.Warn("NotifyRun: Can't send mail: ", err)
+		}
+	}
+	if hook := os.Getenv("NOTIFY_SLACK_WEBHOOK_URL"); hook != "" {
+		if err := postNotification(hook, map[string]string{"text": notification.Text()}); err != nil {
+			log.Warn("NotifyRun: Can't notify slack: ", err)
+		}
+	}
+	if hook := os.Getenv("NOTIFY_TEAMS_WEBHOOK_URL"); hook != "" {
+		if err := postNotification(hook, map[string]string{"title": notification.Subject(), "text": strings.ReplaceAll(notification.Text(), "\n", "\n\n")}); err != nil {
+			log.Warn("NotifyRun: Can't notify teams: ", err)
+		}
+	}
+	if hook := os.Getenv("NOTIFY_WEBHOOK_URL"); hook != "" {
+		if err := postNotification(hook, notification); err != nil {
+			log.Warn("NotifyRun: Can't notify webhook: ", err)
+		}
+	}
+}
+
+// postNotification posts body as json to url
+func postNotification(url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: newRetryTransport(nil), Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, message)
+	}
+	return nil
+}
+
+// sendMailNotification mails n from NOTIFY_SMTP_FROM to NOTIFY_SMTP_TO via
+// NOTIFY_SMTP_HOST, with STARTTLS if offered and authenticated with
+// NOTIFY_SMTP_USERNAME and NOTIFY_SMTP_PASSWORD if set
+func sendMailNotification(n runNotification) error {
+	host := os.Getenv("NOTIFY_SMTP_HOST")
+	addr := net.JoinHostPort(host, getEnv("NOTIFY_SMTP_PORT", "587"))
+	to := getEnvList("NOTIFY_SMTP_TO", ",")
+	var auth smtp.Auth
+	if username := os.Getenv("NOTIFY_SMTP_USERNAME"); username != "" {
+		auth = smtp.PlainAuth("", username, os.Getenv("NOTIFY_SMTP_PASSWORD"), host)
+	}
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", os.Getenv("NOTIFY_SMTP_FROM"))
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", n.Subject())
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(n.Text(), "\n", "\r\n"))
+	return smtp.SendMail(addr, auth, os.Getenv("NOTIFY_SMTP_FROM"), to, message.Bytes())
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/1Password/connect-sdk-go/connect"
+)
+
+// 1Password backends selected by OP_BACKEND
+const (
+	onePassBackendConnect = "connect" // 1Password Connect server
+	onePassBackendSDK     = "sdk"     // 1Password Go SDK with a service account
+	onePassBackendCLI     = "cli"     // 1Password CLI (op) with its own session
+)
+
+// GetOnePassBackend returns the 1Password backend in OP_BACKEND, sdk if only
+// OP_SERVICE_ACCOUNT_TOKEN is set, connect otherwise
+func GetOnePassBackend() string {
+	backend := strings.ToLower(getEnv("OP_BACKEND", ""))
+	if backend == "" {
+		if getEnv("OP_SERVICE_ACCOUNT_TOKEN", "") != "" && getEnv("OP_CONNECT_HOST", "") == "" {
+			return onePassBackendSDK
+		}
+		return onePassBackendConnect
+	}
+	return backend
+}
+
+// NewOnePassClient returns a client of the 1Password backend in OP_BACKEND,
+// all backends implement the operations of the Connect SDK client interface
+// so the sync doesn't depend on the backend
+func NewOnePassClient() (connect.Client, error) {
+	switch GetOnePassBackend() {
+	case onePassBackendConnect:
+		return newConnectClient()
+	case onePassBackendSDK:
+		return newServiceAccountClient()
+	case onePassBackendCLI:
+		return newCliClient()
+	default:
+		return nil, fmt.Errorf("unknown OP_BACKEND %s", GetOnePassBackend())
+	}
+}
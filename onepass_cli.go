@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/1Password/connect-sdk-go/connect"
+	"github.com/1Password/connect-sdk-go/onepassword"
+	log "github.com/sirupsen/logrus"
+)
+
+// cliClient implements connect.Client by running the 1Password CLI (op),
+// which uses its own session: desktop app integration (biometric unlock),
+// op signin or a service account in OP_SERVICE_ACCOUNT_TOKEN
+type cliClient struct {
+	path    string
+	account string
+}
+
+// newCliClient returns a client running OP_CLI_PATH (default op) for the
+// account in OP_CLI_ACCOUNT
+func newCliClient() (connect.Client, error) {
+	path, err := exec.LookPath(getEnv("OP_CLI_PATH", "op"))
+	if err != nil {
+		return nil, err
+	}
+	return &cliClient{path: path, account: getEnv("OP_CLI_ACCOUNT", "")}, nil
+}
+
+// cliVault is a vault as printed by op vault list/get
+type cliVault struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Items     int       `json:"items"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// cliItem is an item as printed by op item list/get, which matches the
+// Connect item except for the timestamps
+type cliItem struct {
+	onepassword.Item
+	CliCreatedAt    time.Time `json:"created_at"`
+	CliUpdatedAt    time.Time `json:"updated_at"`
+	CliLastEditedBy string    `json:"last_edited_by"`
+}
+
+// toItem returns the Connect item of cliItem
+func (i cliItem) toItem() onepassword.Item {
+	item := i.Item
+	item.CreatedAt = i.CliCreatedAt
+	item.UpdatedAt = i.CliUpdatedAt
+	item.LastEditedBy = i.CliLastEditedBy
+	return item
+}
+
+// run executes op with args and the optional stdin and decodes its JSON output into result
+func (c *cliClient) run(stdin []byte, result interface{}, args ...string) error {
+	args = append(args, "--format", "json")
+	if c.account != "" {
+		args = append(args, "--account", c.account)
+	}
+	cmd := exec.Command(c.path, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	log.Trace("cliClient: op ", args[0], " ", args[1])
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("op %s %s failed: %v %s", args[0], args[1], err, strings.TrimSpace(stderr.String()))
+	}
+	if result == nil || stdout.Len() == 0 {
+		return nil
+	}
+	return json.Unmarshal(stdout.Bytes(), result)
+}
+
+// itemTemplate returns item as JSON item template for op item create/edit
+func (c *cliClient) itemTemplate(item *onepassword.Item) ([]byte, error) {
+	template := *item
+	template.Vault = onepassword.ItemVault{}
+	return json.Marshal(template)
+}
+
+func (c *cliClient) GetVaults() ([]onepassword.Vault, error) {
+	cliVaults := []cliVault{}
+	err := c.run(nil, &cliVaults, "vault", "list")
+	if err != nil {
+		return nil, err
+	}
+	vaults := []onepassword.Vault{}
+	for _, cliVault := range cliVaults {
+		vaults = append(vaults, onepassword.Vault{
+			ID:        cliVault.ID,
+			Name:      cliVault.Name,
+			Items:     cliVault.Items,
+			CreatedAt: cliVault.CreatedAt,
+			UpdatedAt: cliVault.UpdatedAt,
+		})
+	}
+	return vaults, nil
+}
+
+func (c *cliClient) GetVault(uuid string) (*onepassword.Vault, error) {
+	cliVault := cliVault{}
+	err := c.run(nil, &cliVault, "vault", "get", uuid)
+	if err != nil {
+		return nil, err
+	}
+	return &onepassword.Vault{
+		ID:        cliVault.ID,
+		Name:      cliVault.Name,
+		Items:     cliVault.Items,
+		CreatedAt: cliVault.CreatedAt,
+		UpdatedAt: cliVault.UpdatedAt,
+	}, nil
+}
+
+func (c *cliClient) GetVaultsByTitle(title string) ([]onepassword.Vault, error) {
+	vaults, err := c.GetVaults()
+	if err != nil {
+		return nil, err
+	}
+	found := []onepassword.Vault{}
+	for _, vault := range vaults {
+		if vault.Name == title {
+			found = append(found, vault)
+		}
+	}
+	return found, nil
+}
+
+func (c *cliClient) GetItem(uuid string, vaultUUID string) (*onepassword.Item, error) {
+	cliItem := cliItem{}
+	err := c.run(nil, &cliItem, "item", "get", uuid, "--vault", vaultUUID)
+	if err != nil {
+		return nil, err
+	}
+	item := cliItem.toItem()
+	return &item, nil
+}
+
+func (c *cliClient) GetItems(vaultUUID string) ([]onepassword.Item, error) {
+	cliItems := []cliItem{}
+	err := c.run(nil, &cliItems, "item", "list", "--vault", vaultUUID)
+	if err != nil {
+		return nil, err
+	}
+	items := []onepassword.Item{}
+	for _, cliItem := range cliItems {
+		items = append(items, cliItem.toItem())
+	}
+	return items, nil
+}
+
+func (c *cliClient) GetItemsByTitle(title string, vaultUUID string) ([]onepassword.Item, error) {
+	items, err := c.GetItems(vaultUUID)
+	if err != nil {
+		return nil, err
+	}
+	found := []onepassword.Item{}
+	for _, item := range items {
+		if item.Title == title {
+			found = append(found, item)
+		}
+	}
+	return found, nil
+}
+
+func (c *cliClient) GetItemByTitle(title string, vaultUUID string) (*onepassword.Item, error) {
+	items, err := c.GetItemsByTitle(title, vaultUUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) != 1 {
+		return nil, fmt.Errorf("found %d items in vault %s with title %s", len(items), vaultUUID, title)
+	}
+	return c.GetItem(items[0].ID, vaultUUID)
+}
+
+func (c *cliClient) CreateItem(item *onepassword.Item, vaultUUID string) (*onepassword.Item, error) {
+	template, err := c.itemTemplate(item)
+	if err != nil {
+		return nil, err
+	}
+	created := cliItem{}
+	err = c.run(template, &created, "item", "create", "--vault", vaultUUID)
+	if err != nil {
+		return nil, err
+	}
+	createdItem := created.toItem()
+	return &createdItem, nil
+}
+
+func (c *cliClient) UpdateItem(item *onepassword.Item, vaultUUID string) (*onepassword.Item, error) {
+	template, err := c.itemTemplate(item)
+	if err != nil {
+		return nil, err
+	}
+	updated := cliItem{}
+	err = c.run(template, &updated, "item", "edit", item.ID, "--vault", vaultUUID)
+	if err != nil {
+		return nil, err
+	}
+	updatedItem := updated.toItem()
+	return &updatedItem, nil
+}
+
+func (c *cliClient) DeleteItem(item *onepassword.Item, vaultUUID string) error {
+	return c.run(nil, nil, "item", "delete", item.ID, "--vault", vaultUUID)
+}
+
+func (c *cliClient) GetFile(fileUUID string, itemUUID string, vaultUUID string) (*onepassword.File, error) {
+	return nil, fmt.Errorf("files are not supported by the op cli backend")
+}
+
+func (c *cliClient) GetFileContent(file *onepassword.File) ([]byte, error) {
+	return nil, fmt.Errorf("files are not supported by the op cli backend")
+}
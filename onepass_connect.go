@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/1Password/connect-sdk-go/connect"
+	"github.com/1Password/connect-sdk-go/onepassword"
+)
+
+// connectClient implements connect.Client with the REST API of the
+// 1Password Connect server on connectHTTPClient. The SDK client always uses
+// http.DefaultClient, which would apply the CA, proxy and retries of Connect
+// to all http traffic of the process.
+type connectClient struct {
+	host       string
+	token      string
+	httpClient *http.Client
+}
+
+// newConnectClient returns a client of OP_CONNECT_HOST authenticated with
+// OP_CONNECT_TOKEN
+func newConnectClient() (connect.Client, error) {
+	host, found := os.LookupEnv("OP_CONNECT_HOST")
+	if !found {
+		return nil, errors.New("OP_CONNECT_HOST is not set")
+	}
+	token, found := os.LookupEnv("OP_CONNECT_TOKEN")
+	if !found {
+		return nil, errors.New("OP_CONNECT_TOKEN is not set")
+	}
+	httpClient, err := getConnectHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	return &connectClient{host: strings.TrimSuffix(host, "/"), token: token, httpClient: httpClient}, nil
+}
+
+// do sends a request with body encoded as json to path and decodes the
+// response into result. A status other than expected is returned as
+// *onepassword.Error, like the SDK does.
+func (c *connectClient) do(method string, path string, body interface{}, expected int, result interface{}) error {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.host+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("User-Agent", "laps2onepassword/"+buildVersion())
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != expected {
+		opErr := &onepassword.Error{}
+		if err := json.Unmarshal(data, opErr); err != nil {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return opErr
+	}
+	if raw, ok := result.(*[]byte); ok {
+		*raw = data
+		return nil
+	}
+	if result == nil {
+		return nil
+	}
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return fmt.Errorf("decoding response: %v", err)
+	}
+	return nil
+}
+
+// titleFilter returns the query of a SCIM filter on the title
+func titleFilter(title string) string {
+	return "?filter=" + url.QueryEscape(fmt.Sprintf("title eq %q", title))
+}
+
+func (c *connectClient) GetVaults() ([]onepassword.Vault, error) {
+	vaults := []onepassword.Vault{}
+	err := c.do(http.MethodGet, "/v1/vaults", nil, http.StatusOK, &vaults)
+	return vaults, err
+}
+
+func (c *connectClient) GetVault(uuid string) (*onepassword.Vault, error) {
+	if uuid == "" {
+		return nil, errors.New("no uuid provided")
+	}
+	vault := &onepassword.Vault{}
+	err := c.do(http.MethodGet, "/v1/vaults/"+uuid, nil, http.StatusOK, vault)
+	if err != nil {
+		return nil, err
+	}
+	return vault, nil
+}
+
+func (c *connectClient) GetVaultsByTitle(title string) ([]onepassword.Vault, error) {
+	vaults := []onepassword.Vault{}
+	err := c.do(http.MethodGet, "/v1/vaults"+titleFilter(title), nil, http.StatusOK, &vaults)
+	return vaults, err
+}
+
+func (c *connectClient) GetItem(uuid string, vaultUUID string) (*onepassword.Item, error) {
+	item := &onepassword.Item{}
+	err := c.do(http.MethodGet, "/v1/vaults/"+vaultUUID+"/items/"+uuid, nil, http.StatusOK, item)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (c *connectClient) GetItems(vaultUUID string) ([]onepassword.Item, error) {
+	items := []onepassword.Item{}
+	err := c.do(http.MethodGet, "/v1/vaults/"+vaultUUID+"/items", nil, http.StatusOK, &items)
+	return items, err
+}
+
+func (c *connectClient) GetItemsByTitle(title string, vaultUUID string) ([]onepassword.Item, error) {
+	items := []onepassword.Item{}
+	err := c.do(http.MethodGet, "/v1/vaults/"+vaultUUID+"/items"+titleFilter(title), nil, http.StatusOK, &items)
+	return items, err
+}
+
+func (c *connectClient) GetItemByTitle(title string, vaultUUID string) (*onepassword.Item, error) {
+	items, err := c.GetItemsByTitle(title, vaultUUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) != 1 {
+		return nil, fmt.Errorf("found %d item(s) in vault %q with title %q", len(items), vaultUUID, title)
+	}
+	return c.GetItem(items[0].ID, items[0].Vault.ID)
+}
+
+func (c *connectClient) CreateItem(item *onepassword.Item, vaultUUID string) (*onepassword.Item, error) {
+	created := &onepassword.Item{}
+	err := c.do(http.MethodPost, "/v1/vaults/"+vaultUUID+"/items", item, http.StatusOK, created)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (c *connectClient) UpdateItem(item *onepassword.Item, vaultUUID string) (*onepassword.Item, error) {
+	updated := &onepassword.Item{}
+	err := c.do(http.MethodPut, "/v1/vaults/"+item.Vault.ID+"/items/"+item.ID, item, http.StatusOK, updated)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (c *connectClient) DeleteItem(item *onepassword.Item, vaultUUID string) error {
+	return c.do(http.MethodDelete, "/v1/vaults/"+item.Vault.ID+"/items/"+item.ID, nil, http.StatusNoContent, nil)
+}
+
+func (c *connectClient) GetFile(fileUUID string, itemUUID string, vaultUUID string) (*onepassword.File, error) {
+	file := &onepassword.File{}
+	err := c.do(http.MethodGet, "/v1/vaults/"+vaultUUID+"/items/"+itemUUID+"/files/"+fileUUID, nil, http.StatusOK, file)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (c *connectClient) GetFileContent(file *onepassword.File) ([]byte, error) {
+	if content, err := file.Content(); err == nil {
+		return content, nil
+	}
+	content := []byte{}
+	err := c.do(http.MethodGet, file.ContentPath, nil, http.StatusOK, &content)
+	if err != nil {
+		return nil, err
+	}
+	file.SetContent(content)
+	return content, nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/1Password/connect-sdk-go/connect"
+	"github.com/1Password/connect-sdk-go/onepassword"
+	onepasswordsdk "github.com/1password/onepassword-sdk-go"
+)
+
+// serviceAccountClient implements connect.Client with the 1Password Go SDK
+// authenticated by the service account in OP_SERVICE_ACCOUNT_TOKEN
+type serviceAccountClient struct {
+	client *onepasswordsdk.Client
+}
+
+var (
+	serviceAccountOnce sync.Once
+	serviceAccount     *serviceAccountClient
+	serviceAccountErr  error
+)
+
+// newServiceAccountClient returns the service account client, it is created
+// once because the SDK initialization is expensive
+func newServiceAccountClient() (connect.Client, error) {
+	serviceAccountOnce.Do(func() {
+		var client *onepasswordsdk.Client
+		client, serviceAccountErr = onepasswordsdk.NewClient(context.Background(),
+			onepasswordsdk.WithServiceAccountToken(os.Getenv("OP_SERVICE_ACCOUNT_TOKEN")),
+			onepasswordsdk.WithIntegrationInfo("laps2onepassword", "v1.0.0"),
+		)
+		serviceAccount = &serviceAccountClient{client: client}
+	})
+	if serviceAccountErr != nil {
+		return nil, serviceAccountErr
+	}
+	return serviceAccount, nil
+}
+
+// errNotSupportedBySDK is returned for Connect operations without SDK equivalent
+var errNotSupportedBySDK = errors.New("not supported by the 1Password SDK backend")
+
+// sdkCategories maps Connect item categories to SDK item categories
+var sdkCategories = map[onepassword.ItemCategory]onepasswordsdk.ItemCategory{
+	onepassword.Login:           onepasswordsdk.ItemCategoryLogin,
+	onepassword.Password:        onepasswordsdk.ItemCategoryPassword,
+	onepassword.Server:          onepasswordsdk.ItemCategoryServer,
+	onepassword.Database:        onepasswordsdk.ItemCategoryDatabase,
+	onepassword.SecureNote:      onepasswordsdk.ItemCategorySecureNote,
+	onepassword.WirelessRouter:  onepasswordsdk.ItemCategoryRouter,
+	onepassword.ApiCredential:   onepasswordsdk.ItemCategoryAPICredentials,
+	onepassword.SoftwareLicense: onepasswordsdk.ItemCategorySoftwareLicense,
+}
+
+// sdkFieldTypes maps Connect field types to SDK field types
+var sdkFieldTypes = map[string]onepasswordsdk.ItemFieldType{
+	"STRING":     onepasswordsdk.ItemFieldTypeText,
+	"CONCEALED":  onepasswordsdk.ItemFieldTypeConcealed,
+	"DATE":       onepasswordsdk.ItemFieldTypeDate,
+	"URL":        onepasswordsdk.ItemFieldTypeURL,
+	"EMAIL":      onepasswordsdk.ItemFieldTypeEmail,
+	"PHONE":      onepasswordsdk.ItemFieldTypePhone,
+	"OTP":        onepasswordsdk.ItemFieldTypeTOTP,
+	"MONTH_YEAR": onepasswordsdk.ItemFieldTypeMonthYear,
+	"MENU":       onepasswordsdk.ItemFieldTypeMenu,
+}
+
+// SDK ids of the built-in username and password fields
+const (
+	sdkUsernameFieldID = "username"
+	sdkPasswordFieldID = "password"
+)
+
+// toSDKItem converts a Connect item to an SDK item
+func toSDKItem(item *onepassword.Item, vaultUUID string) onepasswordsdk.Item {
+	sdkItem := onepasswordsdk.Item{
+		ID:       item.ID,
+		Title:    item.Title,
+		Category: onepasswordsdk.ItemCategoryLogin,
+		VaultID:  vaultUUID,
+		Fields:   []onepasswordsdk.ItemField{},
+		Sections: []onepasswordsdk.ItemSection{},
+		Tags:     item.Tags,
+		Websites: []onepasswordsdk.Website{},
+		Version:  uint32(item.Version),
+	}
+	if category, found := sdkCategories[item.Category]; found {
+		sdkItem.Category = category
+	}
+	for _, section := range item.Sections {
+		sdkItem.Sections = append(sdkItem.Sections, onepasswordsdk.ItemSection{ID: section.ID, Title: section.Label})
+	}
+	for _, field := range item.Fields {
+		fieldType, found := sdkFieldTypes[field.Type]
+		if !found {
+			fieldType = onepasswordsdk.ItemFieldTypeText
+		}
+		sdkField := onepasswordsdk.ItemField{ID: field.ID, Title: field.Label, FieldType: fieldType, Value: field.Value}
+		switch field.Purpose {
+		case "NOTES":
+			sdkItem.Notes = field.Value
+			continue
+		case "USERNAME":
+			sdkField.ID, sdkField.Title = sdkUsernameFieldID, sdkUsernameFieldID
+		case "PASSWORD":
+			sdkField.ID, sdkField.Title = sdkPasswordFieldID, sdkPasswordFieldID
+		}
+		if field.Section != nil {
+			sectionID := field.Section.ID
+			sdkField.SectionID = &sectionID
+		}
+		sdkItem.Fields = append(sdkItem.Fields, sdkField)
+	}
+	for _, url := range item.URLs {
+		sdkItem.Websites = append(sdkItem.Websites, onepasswordsdk.Website{
+			URL:              url.URL,
+			Label:            "website",
+			AutofillBehavior: onepasswordsdk.AutofillBehaviorNever,
+		})
+	}
+	return sdkItem
+}
+
+// fromSDKItem converts an SDK item to a Connect item
+func fromSDKItem(sdkItem onepasswordsdk.Item) *onepassword.Item {
+	item := &onepassword.Item{
+		ID:        sdkItem.ID,
+		Title:     sdkItem.Title,
+		Category:  onepassword.Custom,
+		Vault:     onepassword.ItemVault{ID: sdkItem.VaultID},
+		Tags:      sdkItem.Tags,
+		Version:   int(sdkItem.Version),
+		CreatedAt: sdkItem.CreatedAt,
+		UpdatedAt: sdkItem.UpdatedAt,
+	}
+	for category, sdkCategory := range sdkCategories {
+		if sdkCategory == sdkItem.Category {
+			item.Category = category
+		}
+	}
+	for _, section := range sdkItem.Sections {
+		item.Sections = append(item.Sections, &onepassword.ItemSection{ID: section.ID, Label: section.Title})
+	}
+	for _, sdkField := range sdkItem.Fields {
+		field := &onepassword.ItemField{ID: sdkField.ID, Type: "STRING", Label: sdkField.Title, Value: sdkField.Value}
+		for fieldType, sdkFieldType := range sdkFieldTypes {
+			if sdkFieldType == sdkField.FieldType {
+				field.Type = fieldType
+			}
+		}
+		if sdkField.SectionID != nil && *sdkField.SectionID != "" {
+			field.Section = &onepassword.ItemSection{ID: *sdkField.SectionID}
+		} else if sdkField.ID == sdkUsernameFieldID {
+			field.Purpose, field.Label = "USERNAME", "Username"
+		} else if sdkField.ID == sdkPasswordFieldID {
+			field.Purpose, field.Label = "PASSWORD", "Password"
+		}
+		item.Fields = append(item.Fields, field)
+	}
+	item.Fields = append(item.Fields, &onepassword.ItemField{ID: "notesPlain", Type: "STRING", Purpose: "NOTES", Label: "notesPlain", Value: sdkItem.Notes})
+	for index, website := range sdkItem.Websites {
+		item.URLs = append(item.URLs, onepassword.ItemURL{Primary: index == 0, URL: website.URL})
+	}
+	return item
+}
+
+// fromSDKItemOverview converts an SDK item overview to a Connect item without fields
+func fromSDKItemOverview(overview onepasswordsdk.ItemOverview) onepassword.Item {
+	item := fromSDKItem(onepasswordsdk.Item{
+		ID:        overview.ID,
+		Title:     overview.Title,
+		Category:  overview.Category,
+		VaultID:   overview.VaultID,
+		Tags:      overview.Tags,
+		Websites:  overview.Websites,
+		CreatedAt: overview.CreatedAt,
+		UpdatedAt: overview.UpdatedAt,
+	})
+	item.Fields = nil
+	return *item
+}
+
+func (c *serviceAccountClient) GetVaults() ([]onepassword.Vault, error) {
+	overviews, err := c.client.Vaults().List(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	vaults := []onepassword.Vault{}
+	for _, overview := range overviews {
+		vaults = append(vaults, onepassword.Vault{
+			ID:        overview.ID,
+			Name:      overview.Title,
+			CreatedAt: overview.CreatedAt,
+			UpdatedAt: overview.UpdatedAt,
+		})
+	}
+	return vaults, nil
+}
+
+func (c *serviceAccountClient) GetVault(uuid string) (*onepassword.Vault, error) {
+	vaults, err := c.GetVaults()
+	if err != nil {
+		return nil, err
+	}
+	for index := range vaults {
+		if vaults[index].ID == uuid {
+			return &vaults[index], nil
+		}
+	}
+	return nil, fmt.Errorf("vault %s not found or not accessible by the service account", uuid)
+}
+
+func (c *serviceAccountClient) GetVaultsByTitle(title string) ([]onepassword.Vault, error) {
+	vaults, err := c.GetVaults()
+	if err != nil {
+		return nil, err
+	}
+	found := []onepassword.Vault{}
+	for _, vault := range vaults {
+		if vault.Name == title {
+			found = append(found, vault)
+		}
+	}
+	return found, nil
+}
+
+func (c *serviceAccountClient) GetItem(uuid string, vaultUUID string) (*onepassword.Item, error) {
+	sdkItem, err := c.client.Items().Get(context.Background(), vaultUUID, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return fromSDKItem(sdkItem), nil
+}
+
+func (c *serviceAccountClient) GetItems(vaultUUID string) ([]onepassword.Item, error) {
+	overviews, err := c.client.Items().List(context.Background(), vaultUUID,
+		onepasswordsdk.NewItemListFilterTypeVariantByState(&onepasswordsdk.ItemListFilterByStateInner{Active: true}))
+	if err != nil {
+		return nil, err
+	}
+	items := []onepassword.Item{}
+	for _, overview := range overviews {
+		items = append(items, fromSDKItemOverview(overview))
+	}
+	return items, nil
+}
+
+func (c *serviceAccountClient) GetItemsByTitle(title string, vaultUUID string) ([]onepassword.Item, error) {
+	items, err := c.GetItems(vaultUUID)
+	if err != nil {
+		return nil, err
+	}
+	found := []onepassword.Item{}
+	for _, item := range items {
+		if item.Title == title {
+			found = append(found, item)
+		}
+	}
+	return found, nil
+}
+
+func (c *serviceAccountClient) GetItemByTitle(title string, vaultUUID string) (*onepassword.Item, error) {
+	items, err := c.GetItemsByTitle(title, vaultUUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) != 1 {
+		return nil, fmt.Errorf("found %d items in vault %s with title %s", len(items), vaultUUID, title)
+	}
+	return c.GetItem(items[0].ID, vaultUUID)
+}
+
+func (c *serviceAccountClient) CreateItem(item *onepassword.Item, vaultUUID string) (*onepassword.Item, error) {
+	sdkItem := toSDKItem(item, vaultUUID)
+	notes := sdkItem.Notes
+	created, err := c.client.Items().Create(context.Background(), onepasswordsdk.ItemCreateParams{
+		Category: sdkItem.Category,
+		VaultID:  vaultUUID,
+		Title:    sdkItem.Title,
+		Fields:   sdkItem.Fields,
+		Sections: sdkItem.Sections,
+		Notes:    &notes,
+		Tags:     sdkItem.Tags,
+		Websites: sdkItem.Websites,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromSDKItem(created), nil
+}
+
+func (c *serviceAccountClient) UpdateItem(item *onepassword.Item, vaultUUID string) (*onepassword.Item, error) {
+	updated, err := c.client.Items().Put(context.Background(), toSDKItem(item, vaultUUID))
+	if err != nil {
+		return nil, err
+	}
+	return fromSDKItem(updated), nil
+}
+
+func (c *serviceAccountClient) DeleteItem(item *onepassword.Item, vaultUUID string) error {
+	return c.client.Items().Delete(context.Background(), vaultUUID, item.ID)
+}
+
+func (c *serviceAccountClient) GetFile(fileUUID string, itemUUID string, vaultUUID string) (*onepassword.File, error) {
+	return nil, errNotSupportedBySDK
+}
+
+func (c *serviceAccountClient) GetFileContent(file *onepassword.File) ([]byte, error) {
+	return nil, errNotSupportedBySDK
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/1Password/connect-sdk-go/connect"
+	"github.com/1Password/connect-sdk-go/onepassword"
+	log "github.com/sirupsen/logrus"
+)
+
+// Supported OP_ORPHAN_ACTION values
+const (
+	orphanActionNone    = "none"    // leave items without computer untouched
+	orphanActionTag     = "tag"     // tag them as orphaned
+	orphanActionArchive = "archive" // move them to OP_ORPHAN_ARCHIVE_VAULT after the grace period
+	orphanActionDelete  = "delete"  // delete them after the grace period
+)
+
+// GetOrphanAction returns the configured OP_ORPHAN_ACTION, defaults to none
+func GetOrphanAction() string {
+	action := strings.ToLower(os.Getenv("OP_ORPHAN_ACTION"))
+	if action == "" {
+		return orphanActionNone
+	}
+	return action
+}
+
+// HandleOrphanedOnePassEntries applies OP_ORPHAN_ACTION to all managed items
+// of the vault without a matching LAPS entry. Items are tagged as orphaned first and
+// archived or deleted once they stayed unchanged for OP_ORPHAN_GRACE_PERIOD.
+// Only full runs know all computers, so this must not run incrementally.
+// Stops after the item in progress when ctx is cancelled.
+func HandleOrphanedOnePassEntries(ctx context.Context, lapsentries []LapsEntry, onepassentries []onepassword.Item) error {
+	// keys are prefixed with the vault id, items of computers routed to
+	// another vault are orphaned in their old vault
+	titles := map[string]bool{}
+	guids := map[string]bool{}
+	for _, lapsentry := range lapsentries {
+		vaultID := getVaultIDFor(lapsentry)
+		titles[vaultID+lapsentry.Title()] = true
+		if lapsentry.guid != "" {
+			guids[vaultID+lapsentry.guid] = true
+		}
+	}
+	for _, q := range quarantine {
+		titles[getVaultIDFor(LapsEntry{dn: q.DN, dnshostname: q.Hostname})+q.Hostname] = true
+	}
+
+	client, err := NewOnePassClient()
+	if err != nil {
+		log.Error("HandleOrphanedOnePassEntries: ", err)
+		return err
+	}
+	action := GetOrphanAction()
+	grace := getEnvDuration("OP_ORPHAN_GRACE_PERIOD", 30*24*time.Hour)
+
+	_tagged_total := 0
+	_archived_total := 0
+	_deleted_total := 0
+	p := startProgress("HandleOrphanedOnePassEntries", "items checked for orphans", len(onepassentries))
+	defer p.Stop()
+	for cur_op_idx := range onepassentries {
+		p.add(1)
+		if ctx.Err() != nil {
+			summary.add("orphaned", _archived_total+_deleted_total)
+			log.Warnf("HandleOrphanedOnePassEntries: Interrupted, tagged=%d archived=%d deleted=%d", _tagged_total, _archived_total, _deleted_total)
+			return nil
+		}
+		onepassentry := onepassentries[cur_op_idx]
+		vaultID := onepassentry.Vault.ID
+		if titles[vaultID+onepassentry.Title] || guids[vaultID+getItemSectionValue(onepassentry, syncSectionID, "objectGUID")] {
+			continue
+		}
+		if !syncHostFilter.MatchTitle(onepassentry.Title) {
+			log.Trace("HandleOrphanedOnePassEntries: Skipped ", onepassentry.Title, ", filtered by SYNC_INCLUDE or SYNC_EXCLUDE")
+			continue
+		}
+		if !isManagedItem(onepassentry) && !flag_force {
+			log.Debug("HandleOrphanedOnePassEntries: Skipped ", onepassentry.Title, ", not managed by laps2onepassword")
+			continue
+		}
+		if !containsString(onepassentry.Tags, orphanedTag) {
+			if flag_dry_run {
+				printDryRun("~", onepassentry.Title, "tag "+orphanedTag)
+				_tagged_total++
+				continue
+			}
+			setItemTag(&onepassentry, orphanedTag, true)
+			markItemSynced(&onepassentry)
+			_, err = client.UpdateItem(&onepassentry, onepassentry.Vault.ID)
+			writeAudit("tagged", destinationOnePassword, vaultID, onepassentry.Title, "no laps entry", err)
+			summary.addItem(newItemResult(onepassentry.Title, destinationOnePassword, vaultID, "tagged", "no laps entry", err))
+			if err != nil {
+				log.Error("HandleOrphanedOnePassEntries: ", err)
+				return err
+			}
+			log.Info("HandleOrphanedOnePassEntries: Tagged ", onepassentry.Title, " as ", orphanedTag)
+			_tagged_total++
+			continue
+		}
+		if action == orphanActionTag {
+			continue
+		}
+		if time.Since(onepassentry.UpdatedAt) < grace {
+			log.Debug("HandleOrphanedOnePassEntries: ", onepassentry.Title, " is orphaned since ", onepassentry.UpdatedAt)
+			continue
+		}
+		if flag_dry_run {
+			printDryRun("-", onepassentry.Title, action)
+			continue
+		}
+		if action == orphanActionArchive {
+			err = archiveOnePassEntry(client, onepassentry)
+			writeAudit("archived", destinationOnePassword, vaultID, onepassentry.Title, "orphaned since "+onepassentry.UpdatedAt.Format(time.DateOnly), err)
+			summary.addItem(newItemResult(onepassentry.Title, destinationOnePassword, vaultID, "archived", "orphaned since "+onepassentry.UpdatedAt.Format(time.DateOnly), err))
+			if err != nil {
+				log.Error("HandleOrphanedOnePassEntries: ", err)
+				return err
+			}
+			log.Info("HandleOrphanedOnePassEntries: Archived ", onepassentry.Title)
+			_archived_total++
+			continue
+		}
+		err = client.DeleteItem(&onepassentry, onepassentry.Vault.ID)
+		writeAudit("deleted", destinationOnePassword, vaultID, onepassentry.Title, "orphaned since "+onepassentry.UpdatedAt.Format(time.DateOnly), err)
+		summary.addItem(newItemResult(onepassentry.Title, destinationOnePassword, vaultID, "deleted", "orphaned since "+onepassentry.UpdatedAt.Format(time.DateOnly), err))
+		if err != nil {
+			log.Error("HandleOrphanedOnePassEntries: ", err)
+			return err
+		}
+		log.Info("HandleOrphanedOnePassEntries: Deleted ", onepassentry.Title)
+		_deleted_total++
+	}
+	summary.add("orphaned", _archived_total+_deleted_total)
+	log.Infof("HandleOrphanedOnePassEntries: Total tagged=%d archived=%d deleted=%d", _tagged_total, _archived_total, _deleted_total)
+	return nil
+}
+
+// archiveOnePassEntry moves onepassentry into OP_ORPHAN_ARCHIVE_VAULT, the
+// Connect API has no archive operation
+func archiveOnePassEntry(client connect.Client, onepassentry onepassword.Item) error {
+	vault, err := getVault(client, os.Getenv("OP_ORPHAN_ARCHIVE_VAULT"))
+	if err != nil {
+		return err
+	}
+	archived := onepassentry
+	archived.ID = ""
+	archived.Vault = onepassword.ItemVault{ID: vault.ID}
+	_, err = client.CreateItem(&archived, vault.ID)
+	if err != nil {
+		return err
+	}
+	return client.DeleteItem(&onepassentry, onepassentry.Vault.ID)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Formats of --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// flag_output is the format of the result of sync, verify and export on stdout
+var flag_output = outputText
+
+// IsJSONOutput returns true if the run result is written as json document
+func IsJSONOutput() bool {
+	return flag_output == outputJSON
+}
+
+// checkOutput returns an error for an unknown --output or a json result
+// which would be mixed with the export on stdout
+func checkOutput(command string) error {
+	switch flag_output {
+	case outputText, outputJSON:
+	default:
+		return fmt.Errorf("unknown output %s, use text or json", flag_output)
+	}
+	if IsJSONOutput() && command == "export" && flag_out == "" {
+		return fmt.Errorf("export --output json requires --out, the export can't share stdout with the result")
+	}
+	return nil
+}
+
+// itemResult is the outcome of a single item of a run
+type itemResult struct {
+	Title       string   `json:"title"`
+	Destination string   `json:"destination,omitempty"`
+	Vault       string   `json:"vault,omitempty"`
+	Action      string   `json:"action"` // created, updated, unchanged, skipped, tagged, archived, deleted, quarantined, exported or a verify status
+	Reason      string   `json:"reason,omitempty"`
+	Details     []string `json:"details,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	Attempts    int      `json:"attempts,omitempty"`
+	DurationMs  int64    `json:"durationMs,omitempty"`
+}
+
+// newItemResult returns the result of an item, err is redacted
+func newItemResult(title string, destination string, vault string, action string, reason string, err error) itemResult {
+	item := itemResult{Title: title, Destination: destination, Vault: vault, Action: action, Reason: reason}
+	if err != nil {
+		item.Error = redactSecrets(err.Error())
+	}
+	return item
+}
+
+// runResult is the json document of --output json, the totals of the
+// notification plus every item. It never contains passwords.
+type runResult struct {
+	runNotification
+	Command    string       `json:"command"`
+	Version    string       `json:"version"`
+	DryRun     bool         `json:"dryRun"`
+	Started    time.Time    `json:"started"`
+	Finished   time.Time    `json:"finished"`
+	DurationMs int64        `json:"durationMs"`
+	Items      []itemResult `json:"items"`
+}
+
+// dryRunActions maps the operations of printDryRun to the actions of the
+// json result
+var dryRunActions = map[string]string{
+	"+": "create",
+	"~": "update",
+	"-": "remove",
+}
+
+// writeRunResult writes the result of the run of command finished with
+// code as a single line json document to stdout
+func writeRunResult(command string, code int) {
+	result := runResult{
+		runNotification: newRunNotification(summary, code),
+		Command:         command,
+		Version:         buildVersion(),
+		DryRun:          flag_dry_run,
+		Finished:        time.Now(),
+	}
+	summary.mu.Lock()
+	result.Started = summary.started
+	result.Items = append([]itemResult{}, summary.items...)
+	summary.mu.Unlock()
+	result.DurationMs = result.Finished.Sub(result.Started).Milliseconds()
+	err := json.NewEncoder(os.Stdout).Encode(result)
+	if err != nil {
+		log.Error("writeRunResult: ", err)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+)
+
+// managedByLabel labels the ownership marker field, managedByValue is its value
+const (
+	managedByLabel = "managed-by"
+	managedByValue = "laps2onepassword"
+)
+
+// managedTag is set on every item written by laps2onepassword, unlike the
+// ownership marker it is part of the item list, see OP_LOAD_ITEMS
+const managedTag = "auto-managed"
+
+// ownershipFields returns the ownership marker, the source domain and the
+// build of laps2onepassword as item fields
+func ownershipFields(lapsEntry LapsEntry) []itemField {
+	domain, _ := domainOfDN(lapsEntry.dn)
+	return []itemField{
+		{label: managedByLabel, value: managedByValue},
+		{label: "Source domain", value: domain},
+		{label: "Sync version", value: buildVersion()},
+	}
+}
+
+// isManagedItem returns true if item carries the ownership marker. Items
+// written by versions before the marker are recognized by their objectGUID.
+func isManagedItem(item onepassword.Item) bool {
+	return getItemSectionValue(item, syncSectionID, managedByLabel) == managedByValue ||
+		getItemSectionValue(item, syncSectionID, "objectGUID") != ""
+}
+
+// checkManagedItem returns an error if item lacks the ownership marker and
+// --force isn't given, all updates, archives and deletes must check this
+func checkManagedItem(item onepassword.Item) error {
+	if isManagedItem(item) || flag_force {
+		return nil
+	}
+	return fmt.Errorf("item %s (%s) is not managed by laps2onepassword, use --force to change it", item.Title, item.ID)
+}
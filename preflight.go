@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+	log "github.com/sirupsen/logrus"
+)
+
+// describeOnePassError explains Connect API errors by status code
+func describeOnePassError(err error) string {
+	var opErr *onepassword.Error
+	if !errors.As(err, &opErr) {
+		return err.Error()
+	}
+	switch opErr.StatusCode {
+	case http.StatusUnauthorized:
+		return "token rejected (invalid, expired or revoked): " + opErr.Message
+	case http.StatusForbidden:
+		return "token has no permission: " + opErr.Message
+	case http.StatusNotFound:
+		return "not found or not accessible with this token: " + opErr.Message
+	}
+	return err.Error()
+}
+
+// checkConnectHealth requests the unauthenticated /health endpoint of OP_CONNECT_HOST
+func checkConnectHealth() error {
+	host := strings.TrimSuffix(os.Getenv("OP_CONNECT_HOST"), "/")
+	client, err := getConnectHTTPClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Get(host + "/health")
+	if err != nil {
+		return fmt.Errorf("connect server %s unreachable: %v", host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("connect server %s unhealthy: %s", host, resp.Status)
+	}
+	log.Debug("CheckOnePassAccess: Connect server ", host, " is healthy")
+	return nil
+}
+
+// CheckOnePassAccess verifies before a sync that the 1Password backend is
+// reachable, the token is accepted and every destination vault is readable,
+// so a run fails fast instead of after reading ldap (OP_PREFLIGHT=false skips it)
+func CheckOnePassAccess() error {
+	if !getEnvBool("OP_PREFLIGHT", true) {
+		return nil
+	}
+	if GetOnePassBackend() == onePassBackendConnect {
+		err := checkConnectHealth()
+		if err != nil {
+			return err
+		}
+	}
+	client, err := NewOnePassClient()
+	if err != nil {
+		return err
+	}
+	_, err = client.GetVaults()
+	if err != nil {
+		return fmt.Errorf("can't list vaults, %s", describeOnePassError(err))
+	}
+	for _, title := range GetVaultTitles() {
+		vault, err := getVault(client, title)
+		if err != nil {
+			return fmt.Errorf("vault %s: %s", vaultDisplayName(title), describeOnePassError(err))
+		}
+		if vault.ID == "" {
+			continue // created by a dry run
+		}
+		_, err = client.GetItems(vault.ID)
+		if err != nil {
+			return fmt.Errorf("can't read vault %s: %s", vault.Name, describeOnePassError(err))
+		}
+		log.Debug("CheckOnePassAccess: Vault ", vault.Name, " is accessible")
+	}
+	return nil
+}
+
+// vaultDisplayName returns title or for the defaultVault OP_VAULT_ID or OP_VAULT_TITLE
+func vaultDisplayName(title string) string {
+	if title != defaultVault {
+		return title
+	}
+	return getEnv("OP_VAULT_ID", os.Getenv("OP_VAULT_TITLE"))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GetProgressInterval returns PROGRESS_INTERVAL, the time between two
+// progress lines of a long run, 0 disables them
+func GetProgressInterval() time.Duration {
+	return getEnvDuration("PROGRESS_INTERVAL", 30*time.Second)
+}
+
+// progress logs the items processed, the rate and the remaining time of a
+// long running phase every PROGRESS_INTERVAL, so a large initial sync can
+// be told apart from a hanging one. The status is sent to systemd as well.
+type progress struct {
+	name    string // function logging the progress
+	label   string // what is processed
+	total   int
+	done    atomic.Int64
+	started time.Time
+	stop    chan struct{}
+}
+
+// startProgress reports the progress of total items of the phase name
+// until Stop is called
+func startProgress(name string, label string, total int) *progress {
+	p := &progress{name: name, label: label, total: total, started: time.Now(), stop: make(chan struct{})}
+	interval := GetProgressInterval()
+	if interval <= 0 || total <= 0 {
+		return p
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// add counts n processed items
+func (p *progress) add(n int) {
+	p.done.Add(int64(n))
+}
+
+// Stop ends the reporting
+func (p *progress) Stop() {
+	close(p.stop)
+}
+
+// String returns the progress, e.g. 1200 of 5000 (24%), 40.0/s, ETA 1m35s
+func (p *progress) String() string {
+	done := int(p.done.Load())
+	elapsed := time.Since(p.started)
+	status := fmt.Sprintf("%d of %d (%d%%)", done, p.total, done*100/p.total)
+	if done == 0 {
+		return status + ", ETA unknown"
+	}
+	rate := float64(done) / elapsed.Seconds()
+	eta := time.Duration(float64(elapsed) / float64(done) * float64(p.total-done))
+	return fmt.Sprintf("%s, %.1f/s, ETA %s", status, rate, eta.Round(time.Second))
+}
+
+// report logs the progress and sends it to systemd
+func (p *progress) report() {
+	status := p.String()
+	log.Info(p.name, ": Progress of ", p.label, " ", status)
+	sdNotify("STATUS=" + p.label + " " + status)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// QuarantinedEntry is a computer which is not synced because its LAPS data is invalid
+type QuarantinedEntry struct {
+	DN       string    `json:"dn"`
+	Hostname string    `json:"hostname"`
+	Source   string    `json:"source,omitempty"`
+	Reasons  []string  `json:"reasons"`
+	Time     time.Time `json:"time"`
+}
+
+// quarantine collects all entries quarantined by this run
+var quarantine = []QuarantinedEntry{}
+
+// quarantineEntry adds a computer to the quarantine
+func quarantineEntry(dn string, hostname string, source string, reasons ...string) {
+	log.Warn("quarantineEntry: Quarantined ", hostname, " (", dn, "): ", reasons)
+	summary.addItem(itemResult{Title: hostname, Action: "quarantined", Details: reasons})
+	quarantine = append(quarantine, QuarantinedEntry{
+		DN:       dn,
+		Hostname: hostname,
+		Source:   source,
+		Reasons:  reasons,
+		Time:     time.Now(),
+	})
+}
+
+// validateLapsEntry returns the reasons why lapsentry must not be synced
+func validateLapsEntry(lapsentry LapsEntry) []string {
+	reasons := append([]string{}, lapsentry.problems...)
+	if lapsentry.dnshostname == "" {
+		reasons = append(reasons, "empty hostname")
+	}
+	if lapsentry.password == "" {
+		reasons = append(reasons, "empty password")
+	}
+	if lapsentry.expirationstate == expirationKnown && (lapsentry.expiration.Year() < 1970 || lapsentry.expiration.Year() > 9999) {
+		reasons = append(reasons, "implausible expiration "+lapsentry.expiration.String())
+	}
+	return reasons
+}
+
+// ValidateLapsEntries returns the valid lapsentries and quarantines the others
+func ValidateLapsEntries(lapsentries []LapsEntry) []LapsEntry {
+	valid := []LapsEntry{}
+	for _, lapsentry := range lapsentries {
+		reasons := validateLapsEntry(lapsentry)
+		if len(reasons) > 0 {
+			quarantineEntry(lapsentry.dn, lapsentry.dnshostname, lapsentry.source, reasons...)
+			continue
+		}
+		valid = append(valid, lapsentry)
+	}
+	if len(quarantine) > 0 {
+		log.Warn("ValidateLapsEntries: Quarantined ", len(quarantine), " entries")
+	}
+	return valid
+}
+
+// WriteQuarantineReport writes all quarantined entries as JSON to
+// LAPS_QUARANTINE_REPORT, the report is replaced on every run
+func WriteQuarantineReport() error {
+	reportFile := os.Getenv("LAPS_QUARANTINE_REPORT")
+	if reportFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(quarantine, "", "  ")
+	if err != nil {
+		return err
+	}
+	log.Debug("WriteQuarantineReport: Writing ", len(quarantine), " entries to ", reportFile)
+	return os.WriteFile(reportFile, data, 0600)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redactedValue replaces secrets in log entries
+const redactedValue = "[REDACTED]"
+
+// redactMinLength is the length below which values aren't redacted, they
+// would garble every log line containing them. Passwords and tokens shorter
+// than this are logged in clear text wherever they appear, don't use them.
+const redactMinLength = 4
+
+// secretEnvKeys are the settings holding credentials
+var secretEnvKeys = []string{
+	"LDAP_AUTH_PW", "LDAP_NTLM_HASH", "OP_CONNECT_TOKEN", "OP_SERVICE_ACCOUNT_TOKEN",
+	"VAULT_TOKEN", "VAULT_SECRET_ID", "BW_SESSION", "BW_PASSWORD", "CYBERARK_PASSWORD",
+	"ENTRA_CLIENT_SECRET", "KDBX_PASSWORD", "WEBHOOK_TOKEN", "NOTIFY_SMTP_PASSWORD",
+	"SENTRY_DSN", "NOTIFY_SLACK_WEBHOOK_URL", "NOTIFY_TEAMS_WEBHOOK_URL", "NOTIFY_WEBHOOK_URL",
+}
+
+// knownSecrets are all values known to be secret, the replacer is rebuilt with
+// the next log entry after a secret was added
+var knownSecrets = struct {
+	sync.Mutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}{values: map[string]bool{}}
+
+// registerSecret redacts value in all following log entries
+func registerSecret(value string) {
+	if len(value) < redactMinLength {
+		return
+	}
+	knownSecrets.Lock()
+	defer knownSecrets.Unlock()
+	if !knownSecrets.values[value] {
+		knownSecrets.values[value] = true
+		knownSecrets.replacer = nil
+	}
+}
+
+// registerSecretEnv registers the credentials of secretEnvKeys. The path
+// of webhook urls is registered too, it holds the token and is logged on
+// its own by retryTransport.
+func registerSecretEnv() {
+	for _, key := range secretEnvKeys {
+		value := getEnv(key, "")
+		registerSecret(value)
+		if u, err := url.Parse(value); err == nil && strings.HasSuffix(key, "_URL") && u.Path != "/" {
+			registerSecret(u.Path)
+		}
+	}
+}
+
+// redactSecrets returns s with all registered secrets replaced
+func redactSecrets(s string) string {
+	knownSecrets.Lock()
+	defer knownSecrets.Unlock()
+	if len(knownSecrets.values) == 0 {
+		return s
+	}
+	if knownSecrets.replacer == nil {
+		values := make([]string, 0, len(knownSecrets.values))
+		for value := range knownSecrets.values {
+			values = append(values, value)
+		}
+		// longest first, a secret containing another must be replaced as a whole
+		sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+		pairs := make([]string, 0, 2*len(values))
+		for _, value := range values {
+			pairs = append(pairs, value, redactedValue)
+		}
+		knownSecrets.replacer = strings.NewReplacer(pairs...)
+	}
+	return knownSecrets.replacer.Replace(s)
+}
+
+// redactHook scrubs registered secrets from the message and fields of every
+// entry. It must be the first hook, so the other hooks get the redacted
+// entry too.
+type redactHook struct{}
+
+func (redactHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (redactHook) Fire(entry *log.Entry) error {
+	entry.Message = redactSecrets(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = redactSecrets(v)
+		case error:
+			entry.Data[key] = redactSecrets(v.Error())
+		default:
+			// slices, Stringers, structs: only replaced if they contain a
+			// secret, so numbers and bools keep their type in json logs
+			s := fmt.Sprint(v)
+			if redacted := redactSecrets(s); redacted != s {
+				entry.Data[key] = redacted
+			}
+		}
+	}
+	return nil
+}
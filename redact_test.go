@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// secretStringer hides its secret behind String
+type secretStringer struct{ secret string }
+
+func (s secretStringer) String() string {
+	return "token " + s.secret
+}
+
+// TestRedactHook logs registered secrets at every level through the hooks
+// of the standard logger and checks none of them reaches the output
+func TestRedactHook(t *testing.T) {
+	var buf bytes.Buffer
+	out, level, formatter := log.StandardLogger().Out, log.GetLevel(), log.StandardLogger().Formatter
+	log.SetOutput(&buf)
+	log.SetLevel(log.TraceLevel)
+	log.SetFormatter(&log.JSONFormatter{})
+	defer func() {
+		log.SetOutput(out)
+		log.SetLevel(level)
+		log.SetFormatter(formatter)
+	}()
+
+	const direct = "direct-Secret-1"
+	const fromEnv = "env-Secret-2"
+	t.Setenv("LDAP_AUTH_PW", fromEnv)
+	registerSecret(direct)
+	registerSecretEnv()
+
+	levels := []log.Level{log.TraceLevel, log.DebugLevel, log.InfoLevel, log.WarnLevel, log.ErrorLevel}
+	for _, secret := range []string{direct, fromEnv} {
+		for _, level := range levels {
+			buf.Reset()
+			log.WithFields(log.Fields{
+				"string":   "password " + secret,
+				"error":    errors.New("bind failed: " + secret),
+				"slice":    []string{"a", secret},
+				"stringer": secretStringer{secret},
+				"count":    42,
+			}).Log(level, "TestRedactHook: logged ", secret)
+			logged := buf.String()
+			if logged == "" {
+				t.Fatalf("nothing logged at %s", level)
+			}
+			if strings.Contains(logged, secret) {
+				t.Errorf("secret logged at %s: %s", level, logged)
+			}
+			if !strings.Contains(logged, redactedValue) {
+				t.Errorf("nothing redacted at %s: %s", level, logged)
+			}
+			if !strings.Contains(logged, `"count":42`) {
+				t.Errorf("field without secret changed at %s: %s", level, logged)
+			}
+		}
+	}
+}
+
+// TestRedactMinLength documents that secrets shorter than redactMinLength
+// are not redacted
+func TestRedactMinLength(t *testing.T) {
+	registerSecret("abc")
+	if got := redactSecrets("pw abc"); got != "pw abc" {
+		t.Errorf("short secret redacted: %s", got)
+	}
+}
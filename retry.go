@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// retryTransport retries requests answered with 429 Too Many Requests or a
+// 5xx status with exponential backoff and jitter. POST and PATCH are only
+// retried on 429, after a 5xx the item may have been written anyway.
+type retryTransport struct {
+	next      http.RoundTripper
+	retries   int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// newRetryTransport wraps next with the retry budget of OP_RETRY_MAX,
+// OP_RETRY_BASE_DELAY and OP_RETRY_MAX_DELAY
+func newRetryTransport(next http.RoundTripper) *retryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &retryTransport{
+		next:      next,
+		retries:   getEnvInt("OP_RETRY_MAX", 5),
+		baseDelay: getEnvDuration("OP_RETRY_BASE_DELAY", 500*time.Millisecond),
+		maxDelay:  getEnvDuration("OP_RETRY_MAX_DELAY", 30*time.Second),
+	}
+}
+
+// isRetryableStatus returns true for rate limit errors and, for idempotent
+// methods, server errors. A rate limited request wasn't processed, a POST
+// answered with 5xx may have created the item and is not sent again.
+func isRetryableStatus(method string, status int) bool {
+	if status == http.StatusTooManyRequests {
+		return true
+	}
+	return status >= 500 && method != http.MethodPost && method != http.MethodPatch
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || !isRetryableStatus(req.Method, resp.StatusCode) || attempt >= t.retries {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err // body can't be sent again
+		}
+		delay := t.backoff(attempt, resp.Header.Get("Retry-After"))
+		log.Warnf("retryTransport: %s %s returned %s, retry %d of %d in %s", req.Method, req.URL.Path, resp.Status, attempt+1, t.retries, delay)
+		resp.Body.Close()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the delay before retry attempt+1, the Retry-After header
+// in seconds is used if given, otherwise baseDelay doubled per attempt with
+// jitter, both limited to maxDelay
+func (t *retryTransport) backoff(attempt int, retryAfter string) time.Duration {
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		delay := time.Duration(seconds) * time.Second
+		if delay > t.maxDelay {
+			delay = t.maxDelay
+		}
+		return delay
+	}
+	delay := t.baseDelay << uint(attempt)
+	if delay > t.maxDelay || delay <= 0 {
+		delay = t.maxDelay
+	}
+	// full jitter in the upper half, so concurrent workers don't retry in lockstep
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
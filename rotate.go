@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// getFiletimeFromTime is the inverse of getTimeFromFiletime
+func getFiletimeFromTime(t time.Time) int64 {
+	const epochDiff = 116444736000000000 // 100-ns units between 1601-01-01 and 1970-01-01
+	return t.UnixNano()/100 + epochDiff
+}
+
+// findComputer searches all base DNs for exactly one computer object with
+// a dNSHostName or name of hostname
+func findComputer(ldapCON *ldap.Conn, hostname string, attributes []string) (*ldap.Entry, error) {
+	attrs := GetLapsAttributes(GetLapsMode())
+	filter := fmt.Sprintf("(&(objectClass=computer)(|(%s=%s)(%s=%s)))",
+		attrs.DNSHostName, ldap.EscapeFilter(hostname), attrs.Name, ldap.EscapeFilter(hostname))
+	entries := []*ldap.Entry{}
+	for _, baseDN := range GetSearchBaseDNs() {
+		searchReq := ldap.NewSearchRequest(baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, filter, attributes, nil)
+		result, err := ldapCON.Search(searchReq)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, result.Entries...)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("computer %s not found", hostname)
+	} else if len(entries) > 1 {
+		return nil, fmt.Errorf("computer %s found more than once", hostname)
+	}
+	return entries[0], nil
+}
+
+// lapsExpirationsOf returns the expiration attributes of expirations set on
+// entry, the LAPS families the computer uses. The first one, of LAPS_MODE,
+// is returned if none is set.
+func lapsExpirationsOf(entry *ldap.Entry, expirations []string) []string {
+	set := []string{}
+	for _, attribute := range expirations {
+		if entry.GetAttributeValue(attribute) != "" {
+			set = append(set, attribute)
+		}
+	}
+	if len(set) == 0 {
+		return expirations[:1]
+	}
+	return set
+}
+
+// confirm asks question on stdout and returns true if the answer is yes,
+// flag_yes skips the prompt
+func confirm(question string) bool {
+	if flag_yes {
+		return true
+	}
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// RotateLapsPassword sets the password expiration time of hostname to now,
+// forcing the LAPS client to rotate the password on the next policy refresh
+func RotateLapsPassword(ctx context.Context, hostname string) error {
+	if hostname == "" {
+		return errors.New("usage: rotate <hostname>")
+	}
+
+	ldapCON, ldapURL, err := ConnectLdap(ctx)
+	if err != nil {
+		return err
+	}
+	defer ldapCON.Close()
+	log.Debug("RotateLapsPassword: Connected to ", ldapURL)
+
+	attrs := GetLapsAttributes(GetLapsMode())
+	expirations := []string{attrs.Expiration}
+	if attrs.Fallback != nil {
+		expirations = append(expirations, attrs.Fallback.Expiration)
+	}
+	entry, err := findComputer(ldapCON, hostname, append([]string{attrs.DNSHostName}, expirations...))
+	if err != nil {
+		return err
+	}
+	expire := lapsExpirationsOf(entry, expirations)
+
+	if flag_dry_run {
+		printDryRun("~", entry.DN, "expire "+strings.Join(expire, ", "))
+		return nil
+	}
+
+	if !confirm(fmt.Sprintf("Expire LAPS password of %s?", entry.DN)) {
+		log.Info("RotateLapsPassword: Cancelled")
+		return nil
+	}
+
+	modifyReq := ldap.NewModifyRequest(entry.DN, nil)
+	now := strconv.FormatInt(getFiletimeFromTime(time.Now()), 10)
+	for _, attribute := range expire {
+		modifyReq.Replace(attribute, []string{now})
+	}
+	err = ldapCON.Modify(modifyReq)
+	writeAudit("expired", "ldap", "", hostname, "rotate command, "+strings.Join(expire, ", "), err)
+	if err != nil {
+		return err
+	}
+
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	log.WithFields(log.Fields{
+		"audit":      "rotate",
+		"computer":   entry.DN,
+		"user":       username,
+		"attributes": strings.Join(expire, ", "),
+	}).Info("RotateLapsPassword: Password of ", hostname, " expired, rotation on next policy refresh")
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// flag_every is the interval of install-schedule
+var flag_every time.Duration
+
+// scheduledTask is the periodic sync registered by install-schedule
+type scheduledTask struct {
+	name    string        // task, unit or crontab marker name
+	every   time.Duration // interval between two runs
+	command string        // absolute path of the binary
+	args    []string      // command line of the sync run
+	dir     string        // working directory, .env is read from there
+}
+
+// GetScheduleName returns the name of the scheduled task, suffixed with
+// the config profile so every profile gets its own schedule
+func GetScheduleName() string {
+	if profile := GetConfigProfile(); profile != "" {
+		return "laps2onepassword-" + profile
+	}
+	return "laps2onepassword"
+}
+
+// newScheduledTask returns the scheduled sync of this binary with the
+// current working directory, config file and profile
+func newScheduledTask(every time.Duration) (scheduledTask, error) {
+	task := scheduledTask{name: GetScheduleName(), every: every}
+	if task.every <= 0 {
+		task.every = GetSyncInterval()
+	}
+	if task.every < time.Minute {
+		return task, fmt.Errorf("interval %s is shorter than a minute", task.every)
+	}
+	var err error
+	task.command, err = os.Executable()
+	if err != nil {
+		return task, err
+	}
+	task.command, err = filepath.EvalSymlinks(task.command)
+	if err != nil {
+		return task, err
+	}
+	task.dir, err = os.Getwd()
+	if err != nil {
+		return task, err
+	}
+	if path := GetConfigFile(); path != "" {
+		path, err = filepath.Abs(path)
+		if err != nil {
+			return task, err
+		}
+		task.args = append(task.args, "--config", path)
+	}
+	if profile := GetConfigProfile(); profile != "" {
+		task.args = append(task.args, "--profile", profile)
+	}
+	task.args = append(task.args, "sync")
+	return task, nil
+}
+
+// InstallSchedule registers a sync every interval (SYNC_INTERVAL if zero)
+// with the Task Scheduler on Windows, a systemd timer when running as root
+// on systemd or the crontab of the current user otherwise
+func InstallSchedule(every time.Duration) error {
+	task, err := newScheduledTask(every)
+	if err != nil {
+		return err
+	}
+	err = installSchedule(task)
+	if err != nil {
+		return fmt.Errorf("can't install schedule %s: %v", task.name, err)
+	}
+	return nil
+}
+
+// UninstallSchedule removes the schedule of InstallSchedule
+func UninstallSchedule() error {
+	err := uninstallSchedule(GetScheduleName())
+	if err != nil {
+		return fmt.Errorf("can't uninstall schedule %s: %v", GetScheduleName(), err)
+	}
+	return nil
+}
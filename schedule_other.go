@@ -0,0 +1,237 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// systemdUnitDir holds the service and timer of install-schedule
+const systemdUnitDir = "/etc/systemd/system"
+
+// crontabMarker ends the crontab line of the schedule name
+func crontabMarker(name string) string {
+	return "# " + name + " schedule"
+}
+
+// usesSystemd returns true if the schedule is installed as systemd timer,
+// which requires root on a systemd system
+func usesSystemd() bool {
+	if os.Geteuid() != 0 {
+		return false
+	}
+	_, err := os.Stat("/run/systemd/system")
+	return err == nil
+}
+
+// run runs a command and returns its error with its output
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// installSchedule registers task as systemd timer or in the crontab, an
+// existing schedule of the same name is replaced
+func installSchedule(task scheduledTask) error {
+	if usesSystemd() {
+		return installSystemdTimer(task)
+	}
+	return installCrontab(task)
+}
+
+// uninstallSchedule removes the systemd timer or crontab line name
+func uninstallSchedule(name string) error {
+	if usesSystemd() {
+		return uninstallSystemdTimer(name)
+	}
+	return uninstallCrontab(name)
+}
+
+// systemdQuote quotes s as an argument of ExecStart
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// installSystemdTimer writes a oneshot service and a timer starting it
+// every task.every and enables the timer
+func installSystemdTimer(task scheduledTask) error {
+	execStart := []string{systemdQuote(task.command)}
+	for _, arg := range task.args {
+		execStart = append(execStart, systemdQuote(arg))
+	}
+	service := fmt.Sprintf(`[Unit]
+Description=laps2onepassword sync
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+WorkingDirectory=%s
+ExecStart=%s
+`, systemdQuote(task.dir), strings.Join(execStart, " "))
+	timer := fmt.Sprintf(`[Unit]
+Description=laps2onepassword sync every %s
+
+[Timer]
+OnBootSec=%d
+OnUnitActiveSec=%d
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, task.every, int(task.every.Seconds()), int(task.every.Seconds()))
+	err := os.WriteFile(filepath.Join(systemdUnitDir, task.name+".service"), []byte(service), 0644)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(systemdUnitDir, task.name+".timer"), []byte(timer), 0644)
+	if err != nil {
+		return err
+	}
+	err = run("systemctl", "daemon-reload")
+	if err != nil {
+		return err
+	}
+	err = run("systemctl", "enable", "--now", task.name+".timer")
+	if err != nil {
+		return err
+	}
+	log.Info("installSchedule: Enabled ", task.name, ".timer running ", strings.Join(execStart, " "), " every ", task.every)
+	return nil
+}
+
+// uninstallSystemdTimer disables and removes the timer and service name
+func uninstallSystemdTimer(name string) error {
+	timer := filepath.Join(systemdUnitDir, name+".timer")
+	if _, err := os.Stat(timer); err != nil {
+		return fmt.Errorf("%s not installed", timer)
+	}
+	err := run("systemctl", "disable", "--now", name+".timer")
+	if err != nil {
+		return err
+	}
+	for _, unit := range []string{timer, filepath.Join(systemdUnitDir, name+".service")} {
+		err = os.Remove(unit)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	err = run("systemctl", "daemon-reload")
+	if err != nil {
+		return err
+	}
+	log.Info("uninstallSchedule: Removed ", name, ".timer")
+	return nil
+}
+
+// cronSpec returns the crontab time fields of every, which must divide an
+// hour or a day
+func cronSpec(every time.Duration) (string, error) {
+	switch {
+	case every%time.Minute == 0 && every < time.Hour && time.Hour%every == 0:
+		return fmt.Sprintf("*/%d * * * *", int(every.Minutes())), nil
+	case every%time.Hour == 0 && every < 24*time.Hour && 24*time.Hour%every == 0:
+		return fmt.Sprintf("0 */%d * * *", int(every.Hours())), nil
+	case every == 24*time.Hour:
+		return "0 0 * * *", nil
+	}
+	return "", fmt.Errorf("cron can't run every %s, use minutes dividing an hour or hours dividing a day", every)
+}
+
+// shellQuote quotes s for the shell of cron, % ends the command in crontabs
+func shellQuote(s string) string {
+	return strings.ReplaceAll("'"+strings.ReplaceAll(s, "'", `'\''`)+"'", "%", `\%`)
+}
+
+// readCrontab returns the lines of the crontab of the current user without
+// the line of the schedule name
+func readCrontab(name string) ([]string, bool, error) {
+	out, err := exec.Command("crontab", "-l").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, false, err
+		}
+		// no crontab yet
+		out = nil
+	}
+	lines := []string{}
+	found := false
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if strings.HasSuffix(line, crontabMarker(name)) {
+			found = true
+			continue
+		}
+		if line != "" || len(lines) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines, found, nil
+}
+
+// writeCrontab replaces the crontab of the current user with lines
+func writeCrontab(lines []string) error {
+	cmd := exec.Command("crontab", "-")
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("crontab: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// installCrontab adds task to the crontab of the current user
+func installCrontab(task scheduledTask) error {
+	spec, err := cronSpec(task.every)
+	if err != nil {
+		return err
+	}
+	lines, _, err := readCrontab(task.name)
+	if err != nil {
+		return err
+	}
+	command := []string{shellQuote(task.command)}
+	for _, arg := range task.args {
+		command = append(command, shellQuote(arg))
+	}
+	line := fmt.Sprintf("%s cd %s && %s >/dev/null 2>&1 %s", spec, shellQuote(task.dir), strings.Join(command, " "), crontabMarker(task.name))
+	err = writeCrontab(append(lines, line))
+	if err != nil {
+		return err
+	}
+	log.Info("installSchedule: Added crontab line ", line)
+	return nil
+}
+
+// uninstallCrontab removes the line of the schedule name from the crontab
+func uninstallCrontab(name string) error {
+	lines, found, err := readCrontab(name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("not in the crontab")
+	}
+	err = writeCrontab(lines)
+	if err != nil {
+		return err
+	}
+	log.Info("uninstallSchedule: Removed ", name, " from the crontab")
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// psQuote quotes s as a PowerShell string literal
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// windowsArgs joins args to a command line, quoting arguments with spaces
+func windowsArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if strings.ContainsAny(arg, " \t\"") {
+			arg = `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// runPowerShell runs script with powershell.exe
+func runPowerShell(script string) error {
+	out, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// installSchedule registers task in the Task Scheduler, running as SYSTEM
+// every task.every from now on. An existing task of the same name is replaced.
+func installSchedule(task scheduledTask) error {
+	script := fmt.Sprintf(`$ErrorActionPreference = 'Stop'
+$action = New-ScheduledTaskAction -Execute %s -Argument %s -WorkingDirectory %s
+$trigger = New-ScheduledTaskTrigger -Once -At (Get-Date) -RepetitionInterval (New-TimeSpan -Seconds %d)
+$settings = New-ScheduledTaskSettingsSet -MultipleInstances IgnoreNew -StartWhenAvailable
+Register-ScheduledTask -TaskName %s -Action $action -Trigger $trigger -Settings $settings -User 'SYSTEM' -RunLevel Highest -Force | Out-Null`,
+		psQuote(task.command), psQuote(windowsArgs(task.args)), psQuote(task.dir), int(task.every.Seconds()), psQuote(task.name))
+	err := runPowerShell(script)
+	if err != nil {
+		return err
+	}
+	log.Info("installSchedule: Registered scheduled task ", task.name, " running ", task.command, " ", windowsArgs(task.args), " every ", task.every, " as SYSTEM")
+	return nil
+}
+
+// uninstallSchedule removes the scheduled task name
+func uninstallSchedule(name string) error {
+	err := runPowerShell(fmt.Sprintf("$ErrorActionPreference = 'Stop'\nUnregister-ScheduledTask -TaskName %s -Confirm:$false", psQuote(name)))
+	if err != nil {
+		return err
+	}
+	log.Info("uninstallSchedule: Removed scheduled task ", name)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// IsSentryEnabled returns whether errors are reported to SENTRY_DSN
+func IsSentryEnabled() bool {
+	return os.Getenv("SENTRY_DSN") != ""
+}
+
+// InitSentry reports panics, failed items and failed runs to SENTRY_DSN.
+// Events carry the run id, command and destinations, all registered
+// secrets are scrubbed before they are sent.
+func InitSentry() error {
+	if !IsSentryEnabled() {
+		return nil
+	}
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:         os.Getenv("SENTRY_DSN"),
+		Environment: getEnv("SENTRY_ENVIRONMENT", "production"),
+		Release:     "laps2onepassword@" + version,
+		BeforeSend:  scrubSentryEvent,
+	})
+	if err != nil {
+		return fmt.Errorf("SENTRY_DSN: %v", err)
+	}
+	log.Debug("InitSentry: Reporting errors to sentry")
+	return nil
+}
+
+// scrubSentryEvent adds the run context to event and redacts all known
+// secrets from it
+func scrubSentryEvent(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+	if event.Tags == nil {
+		event.Tags = map[string]string{}
+	}
+	event.Tags["run_id"] = runID
+	event.Tags["destinations"] = strings.Join(GetDestinations(), ",")
+	event.Tags["dry_run"] = fmt.Sprint(flag_dry_run)
+
+	event.Message = redactSecrets(event.Message)
+	for i := range event.Exception {
+		event.Exception[i].Value = redactSecrets(event.Exception[i].Value)
+	}
+	for _, breadcrumb := range event.Breadcrumbs {
+		breadcrumb.Message = redactSecrets(breadcrumb.Message)
+	}
+	for key, value := range event.Extra {
+		if s, ok := value.(string); ok {
+			event.Extra[key] = redactSecrets(s)
+		}
+	}
+	event.Request = nil
+	return event
+}
+
+// reportPanic reports a panic to sentry and panics again, deferred at the
+// top of main and of the worker goroutines
+func reportPanic() {
+	if !IsSentryEnabled() {
+		return
+	}
+	if r := recover(); r != nil {
+		sentry.CurrentHub().Recover(r)
+		sentry.Flush(5 * time.Second)
+		panic(r)
+	}
+}
+
+// reportItemError reports the failed write of an item
+func reportItemError(job writeJob, err error) {
+	if !IsSentryEnabled() || err == nil || err == errInterrupted {
+		return
+	}
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("item", job.title)
+		scope.SetTag("destination", job.destination)
+		scope.SetTag("action", job.kind)
+		scope.SetExtra("vault", job.vault)
+		scope.SetExtra("reason", job.reason)
+		sentry.CaptureException(err)
+	})
+}
+
+// reportRun reports a failed run of command with the errors logged during
+// the run and sends all pending events
+func reportRun(command string, code int) {
+	if !IsSentryEnabled() {
+		return
+	}
+	if code != exitOK && code != exitDrift {
+		if command == "" {
+			command = "sync"
+		}
+		sentry.WithScope(func(scope *sentry.Scope) {
+			scope.SetTag("command", command)
+			scope.SetTag("exit_code", fmt.Sprint(code))
+			summary.mu.Lock()
+			scope.SetExtra("errors", strings.Join(summary.errors, "\n"))
+			summary.mu.Unlock()
+			sentry.CaptureMessage(fmt.Sprintf("%s failed with exit code %d", command, code))
+		})
+	}
+	sentry.Flush(5 * time.Second)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Supported LDAP_SERVER_TYPE values
+const (
+	ldapServerAD    = "ad"    // Microsoft Active Directory
+	ldapServerSamba = "samba" // Samba AD DC
+	ldapServerADLDS = "adlds" // Active Directory Lightweight Directory Services
+)
+
+// GetLdapServerType returns the configured LDAP_SERVER_TYPE, defaults to ad
+func GetLdapServerType() string {
+	servertype := strings.ToLower(os.Getenv("LDAP_SERVER_TYPE"))
+	if servertype == "" {
+		return ldapServerAD
+	}
+	return servertype
+}
+
+// IsSamba returns true if LDAP_SERVER_TYPE is samba
+func IsSamba() bool {
+	return GetLdapServerType() == ldapServerSamba
+}
+
+// IsADLDS returns true if LDAP_SERVER_TYPE is adlds
+func IsADLDS() bool {
+	return GetLdapServerType() == ldapServerADLDS
+}
+
+// getNamingContext returns LDAP_NAMING_CONTEXT or the defaultNamingContext of
+// the RootDSE. AD LDS instances often have no defaultNamingContext, there the
+// first application partition of namingContexts is used.
+func getNamingContext(ldapCON *ldap.Conn) (string, error) {
+	if namingContext := os.Getenv("LDAP_NAMING_CONTEXT"); namingContext != "" {
+		return namingContext, nil
+	}
+	result, err := ldapCON.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)", []string{"defaultNamingContext", "namingContexts", "configurationNamingContext", "schemaNamingContext"}, nil))
+	if err != nil {
+		return "", err
+	}
+	if len(result.Entries) != 1 {
+		return "", fmt.Errorf("unexpected RootDSE result with %d entries", len(result.Entries))
+	}
+	rootDSE := result.Entries[0]
+	if namingContext := rootDSE.GetAttributeValue("defaultNamingContext"); namingContext != "" {
+		return namingContext, nil
+	}
+	if IsADLDS() {
+		for _, namingContext := range rootDSE.GetAttributeValues("namingContexts") {
+			if !strings.EqualFold(namingContext, rootDSE.GetAttributeValue("configurationNamingContext")) &&
+				!strings.EqualFold(namingContext, rootDSE.GetAttributeValue("schemaNamingContext")) {
+				return namingContext, nil
+			}
+		}
+	}
+	return "", errors.New("no default naming context, set LDAP_NAMING_CONTEXT")
+}
+
+// parseFiletime converts a FILETIME attribute value into an expiration state
+// and time. Active Directory uses 0 for "not set" and the maximum int64 for
+// "never". Samba does not enforce the range of Integer8 attributes, so values
+// written by scripts on Samba DCs may be negative, which Samba mode treats as
+// "never" like -1 is handled by Samba's own accountExpires logic.
+func parseFiletime(value string) (int, time.Time, error) {
+	filetime, err := strconv.ParseInt(value, 10, 64)
+	switch {
+	case err != nil:
+		return expirationUnknown, time.Time{}, err
+	case filetime == 0:
+		return expirationUnknown, time.Time{}, nil
+	case filetime == filetimeNever:
+		return expirationNever, time.Time{}, nil
+	case filetime < 0 && IsSamba():
+		return expirationNever, time.Time{}, nil
+	case filetime < 0:
+		return expirationUnknown, time.Time{}, nil
+	}
+	return expirationKnown, getTimeFromFiletime(filetime), nil
+}
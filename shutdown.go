@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// exitInterrupted is the exit code of a run stopped by SIGINT or SIGTERM
+const exitInterrupted = 130
+
+// errInterrupted is the result of write jobs not started because the run
+// was interrupted
+var errInterrupted = errors.New("interrupted before writing")
+
+// NewSignalContext returns a context which is cancelled by SIGINT or
+// SIGTERM. Runs stop after the items in progress and log what they have
+// written so far, a second signal exits at once.
+func NewSignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warn("NewSignalContext: Received ", sig, ", stopping after the items in progress")
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+		sig := <-signals
+		log.Error("NewSignalContext: Received ", sig, " again, exiting immediately")
+		os.Exit(exitInterrupted)
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// countInterrupted returns the number of results not written because the
+// run was interrupted
+func countInterrupted(results []writeResult) int {
+	interrupted := 0
+	for _, result := range results {
+		if result.err == errInterrupted {
+			interrupted++
+		}
+	}
+	return interrupted
+}
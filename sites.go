@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// SiteFilter restricts the sync to computers of specific AD sites
+type SiteFilter struct {
+	sites     []string
+	dnPattern string
+}
+
+// NewSiteFilter returns a SiteFilter for the semicolon separated, case
+// insensitive site names of LDAP_SITES
+func NewSiteFilter() SiteFilter {
+	sitefilter := SiteFilter{dnPattern: getEnv("LDAP_SITE_DN_PATTERN", "OU=%s,")}
+	for _, site := range getEnvList("LDAP_SITES", ";") {
+		log.Debug("NewSiteFilter: LDAP_SITES contains ", site)
+		sitefilter.sites = append(sitefilter.sites, strings.ToLower(site))
+	}
+	return sitefilter
+}
+
+// Enabled returns true if LDAP_SITES is set
+func (f SiteFilter) Enabled() bool {
+	return len(f.sites) > 0
+}
+
+// Match returns true if the computer belongs to a configured site. Domain
+// controllers are resolved by their server object in serverReferenceBL,
+// other computers by LDAP_SITE_DN_PATTERN (%s = site) in their DN
+func (f SiteFilter) Match(entry *ldap.Entry) bool {
+	if !f.Enabled() {
+		return true
+	}
+	for _, serverReference := range entry.GetAttributeValues("serverReferenceBL") {
+		if site := siteOfServerReference(serverReference); site != "" {
+			return containsString(f.sites, site)
+		}
+	}
+	dn := strings.ToLower(entry.DN)
+	for _, site := range f.sites {
+		if strings.Contains(dn, strings.ToLower(fmt.Sprintf(f.dnPattern, site))) {
+			return true
+		}
+	}
+	return false
+}
+
+// siteOfServerReference returns the lower case site name of a server object like
+// CN=DC01,CN=Servers,CN=Berlin,CN=Sites,CN=Configuration,DC=domain,DC=loc
+func siteOfServerReference(serverReference string) string {
+	dn, err := ldap.ParseDN(serverReference)
+	if err != nil {
+		return ""
+	}
+	for i := 0; i+3 < len(dn.RDNs); i++ {
+		if rdnValue(dn.RDNs[i+1]) == "servers" && rdnValue(dn.RDNs[i+3]) == "sites" {
+			return rdnValue(dn.RDNs[i+2])
+		}
+	}
+	return ""
+}
+
+// rdnValue returns the lower case value of a single valued RDN
+func rdnValue(rdn *ldap.RelativeDN) string {
+	if len(rdn.Attributes) != 1 {
+		return ""
+	}
+	return strings.ToLower(rdn.Attributes[0].Value)
+}
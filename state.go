@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SyncState is persisted between runs in LDAP_STATE_FILE
+type SyncState struct {
+	// HighestUSN maps a domain controller to the highestCommittedUSN
+	// seen at the start of the last successful run
+	HighestUSN map[string]int64 `json:"highestUSN"`
+	// Computers maps the lower case name of every synced computer
+	// to its dNSHostName, used to detect deleted computers
+	Computers map[string]string `json:"computers,omitempty"`
+	// Hosts maps the lower case title of every computer to its sync
+	// state, only kept with SYNC_SKIP_UNCHANGED
+	Hosts map[string]HostState `json:"hosts,omitempty"`
+	// LastFullSync is the end of the last run without skipped computers
+	LastFullSync time.Time `json:"lastFullSync,omitempty"`
+	// Orphans maps each destination other than 1Password to the lower case
+	// titles of its orphaned secrets and when they were first found
+	// orphaned, the start of OP_ORPHAN_GRACE_PERIOD
+	Orphans map[string]map[string]time.Time `json:"orphans,omitempty"`
+
+	pendingServer    string
+	pendingUSN       int64
+	pendingComputers map[string]string
+	incrementalSince int64 // first USN read by an incremental run, 0 on full runs
+	skippedHosts     int   // computers skipped by SYNC_SKIP_UNCHANGED
+	unresolved       int   // computers of domains the global catalog couldn't resolve
+}
+
+// syncState is loaded once by LoadSyncState
+var syncState = &SyncState{HighestUSN: map[string]int64{}}
+
+// GetStateFile returns the configured LDAP_STATE_FILE
+func GetStateFile() string {
+	return getEnv("LDAP_STATE_FILE", "laps2onepassword.state.json")
+}
+
+// LoadSyncState reads the state file, a missing file results in an empty state
+func LoadSyncState() error {
+	data, err := os.ReadFile(GetStateFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Debug("LoadSyncState: No state file ", GetStateFile())
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, syncState)
+	if err != nil {
+		return err
+	}
+	if syncState.HighestUSN == nil {
+		syncState.HighestUSN = map[string]int64{}
+	}
+	log.Debug("LoadSyncState: Loaded ", GetStateFile())
+	return nil
+}
+
+// SaveSyncState commits pending watermarks and writes the state file,
+// it must only be called after a successful run
+func SaveSyncState() error {
+	if syncState.pendingServer != "" {
+		syncState.HighestUSN[syncState.pendingServer] = syncState.pendingUSN
+	}
+	if syncState.pendingComputers != nil {
+		syncState.Computers = syncState.pendingComputers
+	}
+	if IsSkipUnchanged() && !isPartialRun() {
+		pruneHostStates(summary.started)
+		syncState.LastFullSync = time.Now()
+	}
+	return writeSyncState()
+}
+
+// SaveHostStates writes the computers synced so far without committing the
+// watermarks, so an interrupted run is resumed by the next one
+func SaveHostStates() error {
+	if !IsSkipUnchanged() || flag_dry_run {
+		return nil
+	}
+	return writeSyncState()
+}
+
+// writeSyncState writes syncState to the state file
+func writeSyncState() error {
+	hostStateMutex.Lock()
+	defer hostStateMutex.Unlock()
+	data, err := json.MarshalIndent(syncState, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpfile := GetStateFile() + ".tmp"
+	err = os.WriteFile(tmpfile, data, 0600)
+	if err != nil {
+		return err
+	}
+	log.Debug("SaveSyncState: Saved ", GetStateFile())
+	return os.Rename(tmpfile, GetStateFile())
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SecretStore is a destination the LAPS passwords are synced to
+type SecretStore interface {
+	Name() string
+	// List returns the secrets written by laps2onepassword, it stops
+	// reading when ctx is cancelled
+	List(ctx context.Context) ([]StoredSecret, error)
+	Create(lapsEntry LapsEntry) error
+	Update(secret StoredSecret, lapsEntry LapsEntry) error
+	// Archive removes the secret of a computer that no longer exists,
+	// the store keeps it recoverable where it can
+	Archive(secret StoredSecret) error
+}
+
+// StoredSecret is a secret of a SecretStore
+type StoredSecret struct {
+	ID      string // store specific id or path
+	Title   string
+	GUID    string    // objectGUID of the computer
+	Hash    string    // sync hash of the content written last, see hash.go
+	Updated time.Time // last write, zero if unknown
+	ref     interface{}
+}
+
+// secretStoreSyncer is implemented by stores with their own sync logic
+type secretStoreSyncer interface {
+	Sync(ctx context.Context, lapsentries []LapsEntry, deleted []string) error
+}
+
+// secretStoreCommitter is implemented by stores committing all writes of a
+// sync at once
+type secretStoreCommitter interface {
+	Commit(message string) error
+}
+
+// Supported DESTINATION values
+const (
+	destinationOnePassword = "1password"
+	destinationVault       = "vault"     // HashiCorp Vault KV v2
+	destinationBitwarden   = "bitwarden" // Bitwarden or Vaultwarden organization collection
+	destinationAWS         = "aws"       // AWS Secrets Manager
+	destinationCyberArk    = "cyberark"  // CyberArk PAM accounts via the PVWA REST API
+	destinationPass        = "pass"      // passwordstore.org (pass, gopass) directory
+)
+
+// GetDestinations returns the comma separated DESTINATION list, defaults
+// to 1password
+func GetDestinations() []string {
+	destinations := []string{}
+	for _, destination := range getEnvList("DESTINATION", ",") {
+		destination = strings.ToLower(destination)
+		if !containsString(destinations, destination) {
+			destinations = append(destinations, destination)
+		}
+	}
+	if len(destinations) == 0 {
+		return []string{destinationOnePassword}
+	}
+	return destinations
+}
+
+// usesDestination returns true if destination is one of the DESTINATION list
+func usesDestination(destination string) bool {
+	return containsString(GetDestinations(), destination)
+}
+
+// NewSecretStore returns the SecretStore of destination
+func NewSecretStore(destination string) (SecretStore, error) {
+	switch destination {
+	case destinationOnePassword:
+		return &onePasswordStore{}, nil
+	case destinationVault:
+		return newVaultStore()
+	case destinationBitwarden:
+		return newBitwardenStore()
+	case destinationAWS:
+		return newAWSSecretsManagerStore()
+	case destinationCyberArk:
+		return newCyberArkStore()
+	case destinationPass:
+		return newPassStore()
+	}
+	return nil, fmt.Errorf("unknown destination %s", destination)
+}
+
+// findStoredSecret returns the index of the secret of lapsEntry, matched
+// by objectGUID first and by title otherwise
+func findStoredSecret(lapsEntry LapsEntry, secrets []StoredSecret) (int, bool) {
+	if lapsEntry.guid != "" {
+		for cur_idx := range secrets {
+			if secrets[cur_idx].GUID == lapsEntry.guid {
+				return cur_idx, true
+			}
+		}
+	}
+	for cur_idx := range secrets {
+		if strings.EqualFold(secrets[cur_idx].Title, lapsEntry.Title()) {
+			return cur_idx, true
+		}
+	}
+	return 0, false
+}
+
+// SyncSecretStore writes lapsentries to store. Stores implementing
+// secretStoreSyncer sync on their own, all others get created, updated and
+// orphaned secrets the same way as 1Password items. Only the syncers get the
+// deleted computers, orphan tags are rejected for the other stores.
+func SyncSecretStore(ctx context.Context, store SecretStore, lapsentries []LapsEntry, deleted []string) error {
+	if syncer, ok := store.(secretStoreSyncer); ok {
+		return syncer.Sync(ctx, lapsentries, deleted)
+	}
+	listCtx, span := tracer.Start(ctx, store.Name()+".list")
+	secrets, err := store.List(listCtx)
+	span.SetAttributes(attribute.Int("secrets", len(secrets)))
+	endSpan(span, err)
+	if err != nil {
+		log.Error("SyncSecretStore: ", store.Name(), ": ", err)
+		return err
+	}
+	if len(secrets) < 1 {
+		log.Warn("SyncSecretStore: No entries returned from ", store.Name())
+	}
+
+	_unchanged_total := 0
+	matched := make([]bool, len(secrets))
+	jobs := []writeJob{}
+	for cur_laps_idx := range lapsentries {
+		lapsentry := lapsentries[cur_laps_idx]
+		cur_idx, found := findStoredSecret(lapsentry, secrets)
+		if !found {
+			if flag_dry_run {
+				printDryRun("+", lapsentry.Title(), store.Name())
+				continue
+			}
+			jobs = append(jobs, writeJob{title: lapsentry.Title(), kind: "created", entry: &lapsentry, destination: store.Name(), reason: "new computer", write: func() error {
+				return store.Create(lapsentry)
+			}})
+			continue
+		}
+		matched[cur_idx] = true
+		secret := secrets[cur_idx]
+		if syncHashMatches(secret.Hash, lapsentry) {
+			log.Trace("SyncSecretStore: Unchanged ", lapsentry.dnshostname, ", skipped")
+			recordHostState(store.Name(), lapsentry)
+			summary.addItem(itemResult{Title: secret.Title, Destination: store.Name(), Action: "unchanged"})
+			_unchanged_total++
+			continue
+		}
+		if flag_dry_run {
+			printDryRun("~", lapsentry.Title(), store.Name())
+			continue
+		}
+		jobs = append(jobs, writeJob{title: lapsentry.Title(), kind: "updated", entry: &lapsentry, destination: store.Name(), reason: "laps entry changed", write: func() error {
+			return store.Update(secret, lapsentry)
+		}})
+	}
+
+	// Secrets without computer, only full runs know all computers. The grace
+	// period starts when a secret is first found orphaned, not at its last
+	// write, quarantined computers still exist.
+	action := GetOrphanAction()
+	if (action == orphanActionArchive || action == orphanActionDelete) && !isPartialRun() {
+		grace := getEnvDuration("OP_ORPHAN_GRACE_PERIOD", 30*24*time.Hour)
+		quarantined := map[string]bool{}
+		for _, q := range quarantine {
+			quarantined[strings.ToLower(q.Hostname)] = true
+		}
+		orphans := map[string]time.Time{}
+		for cur_idx := range secrets {
+			secret := secrets[cur_idx]
+			if matched[cur_idx] || quarantined[strings.ToLower(secret.Title)] || !syncHostFilter.MatchTitle(secret.Title) {
+				continue
+			}
+			since := orphanedSince(store.Name(), secret.Title)
+			orphans[strings.ToLower(secret.Title)] = since
+			if time.Since(since) < grace {
+				log.Debug("SyncSecretStore: ", store.Name(), ": ", secret.Title, " is orphaned since ", since)
+				continue
+			}
+			if flag_dry_run {
+				printDryRun("-", secret.Title, store.Name())
+				continue
+			}
+			jobs = append(jobs, writeJob{title: secret.Title, kind: "archived", destination: store.Name(), reason: "orphaned since " + since.Format(time.DateOnly), write: func() error {
+				return store.Archive(secret)
+			}})
+		}
+		setOrphans(store.Name(), orphans)
+	}
+
+	results := runWriteJobs(ctx, jobs)
+	totals := map[string]int{}
+	for _, result := range results {
+		if result.err == nil {
+			totals[result.job.kind]++
+		}
+	}
+	summary.add("unchanged", _unchanged_total)
+	summary.addResults(results)
+	log.Infof("SyncSecretStore: %s total created=%d updated=%d unchanged=%d archived=%d failed=%d interrupted=%d", store.Name(), totals["created"], totals["updated"], _unchanged_total, totals["archived"], countFailed(results), countInterrupted(results))
+	err = writeErrors(results)
+	if err != nil {
+		log.Error("SyncSecretStore: ", store.Name(), ": ", err)
+	}
+	// successful writes are committed even if others failed
+	if committer, ok := store.(secretStoreCommitter); ok && len(jobs) > 0 {
+		commitErr := committer.Commit(fmt.Sprintf("laps2onepassword sync %s: created=%d updated=%d archived=%d", runID, totals["created"], totals["updated"], totals["archived"]))
+		if commitErr != nil {
+			log.Error("SyncSecretStore: ", store.Name(), ": ", commitErr)
+			if err == nil {
+				err = commitErr
+			}
+		}
+	}
+	return err
+}
+
+// usesOrphanState returns true if orphaned secrets of destinations other
+// than 1Password are archived or deleted, their grace period is kept in the
+// state file
+func usesOrphanState() bool {
+	action := GetOrphanAction()
+	if action != orphanActionArchive && action != orphanActionDelete {
+		return false
+	}
+	for _, destination := range GetDestinations() {
+		if destination != destinationOnePassword {
+			return true
+		}
+	}
+	return false
+}
+
+// orphanedSince returns when the secret title of destination was first
+// found orphaned according to the state file, now for new orphans
+func orphanedSince(destination string, title string) time.Time {
+	hostStateMutex.Lock()
+	defer hostStateMutex.Unlock()
+	if since, found := syncState.Orphans[destination][strings.ToLower(title)]; found {
+		return since
+	}
+	return time.Now()
+}
+
+// setOrphans replaces the orphaned secrets of destination in the state
+// file, secrets found again or removed are forgotten
+func setOrphans(destination string, orphans map[string]time.Time) {
+	hostStateMutex.Lock()
+	defer hostStateMutex.Unlock()
+	if syncState.Orphans == nil {
+		syncState.Orphans = map[string]map[string]time.Time{}
+	}
+	syncState.Orphans[destination] = orphans
+}
+
+// usesOnePassword returns true if 1Password is a destination of the sync
+func usesOnePassword() bool {
+	return usesDestination(destinationOnePassword)
+}
+
+// SyncDestinations writes lapsentries to all destinations at the same time.
+// A failing destination doesn't stop the others, returns the failed ones.
+func SyncDestinations(ctx context.Context, lapsentries []LapsEntry, deleted []string) []string {
+	destinations := GetDestinations()
+	errs := make([]error, len(destinations))
+	var wg sync.WaitGroup
+	for cur_idx, destination := range destinations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store, err := NewSecretStore(destination)
+			if err == nil {
+				err = SyncSecretStore(ctx, store, lapsentries, deleted)
+			}
+			errs[cur_idx] = err
+		}()
+	}
+	wg.Wait()
+
+	failed := []string{}
+	for cur_idx, destination := range destinations {
+		if errs[cur_idx] != nil {
+			log.Error("SyncDestinations: ", destination, " failed: ", errs[cur_idx])
+			failed = append(failed, destination)
+			continue
+		}
+		log.Info("SyncDestinations: ", destination, " succeeded")
+	}
+	return failed
+}
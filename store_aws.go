@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// awsTagPrefix prefixes the tags written by laps2onepassword
+const awsTagPrefix = "laps2onepassword:"
+
+// awsSecretsManagerStore is the SecretStore of AWS Secrets Manager. Every
+// LAPS entry is one secret named AWS_SM_PREFIX<hostname> with a JSON payload,
+// an update stores a new version and the previous one stays AWSPREVIOUS.
+// Credentials and region are read from the default AWS configuration
+// (AWS_REGION, AWS_PROFILE, environment, instance role).
+type awsSecretsManagerStore struct {
+	client *secretsmanager.Client
+	prefix string
+}
+
+// awsSecretPayload is the SecretString of a secret
+type awsSecretPayload struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Expiration string `json:"expiration"`
+	DN         string `json:"dn"`
+	SyncHash   string `json:"sync_hash"`
+}
+
+// newAWSSecretsManagerStore returns the store of the default AWS configuration
+func newAWSSecretsManagerStore() (*awsSecretsManagerStore, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &awsSecretsManagerStore{
+		client: secretsmanager.NewFromConfig(cfg),
+		prefix: getEnv("AWS_SM_PREFIX", "laps/"),
+	}, nil
+}
+
+func (s *awsSecretsManagerStore) Name() string {
+	return destinationAWS
+}
+
+// awsSecretTags returns the tags of lapsEntry: the objectGUID, source and
+// ownership marker and the rendered AWS_SM_TAGS (; separated key=template)
+func awsSecretTags(lapsEntry LapsEntry) ([]types.Tag, error) {
+	tags := []types.Tag{
+		{Key: aws.String(awsTagPrefix + managedByLabel), Value: aws.String(managedByValue)},
+		{Key: aws.String(awsTagPrefix + "hostname"), Value: aws.String(lapsEntry.Title())},
+		{Key: aws.String(awsTagPrefix + "objectGUID"), Value: aws.String(lapsEntry.guid)},
+		{Key: aws.String(awsTagPrefix + "source"), Value: aws.String(lapsEntry.source)},
+	}
+	for _, tag := range getEnvList("AWS_SM_TAGS", ";") {
+		key, value, found := strings.Cut(tag, "=")
+		if !found {
+			return nil, fmt.Errorf("AWS_SM_TAGS %s is not key=value", tag)
+		}
+		values, err := renderTemplates("AWS_SM_TAGS", []string{value}, lapsEntry)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 0 {
+			tags = append(tags, types.Tag{Key: aws.String(strings.TrimSpace(key)), Value: aws.String(values[0])})
+		}
+	}
+	return tags, nil
+}
+
+// awsSecretString returns the JSON payload of lapsEntry
+func awsSecretString(lapsEntry LapsEntry) (string, error) {
+	payload, err := json.Marshal(awsSecretPayload{
+		Username:   lapsEntry.Username(),
+		Password:   lapsEntry.password,
+		Expiration: expirationDate(lapsEntry),
+		DN:         lapsEntry.dn,
+		SyncHash:   newSyncHash(lapsEntry),
+	})
+	return string(payload), err
+}
+
+// awsTag returns the value of tag key
+func awsTag(tags []types.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+// List returns the managed secrets named AWS_SM_PREFIX*, the payload of
+// every secret is read for its sync hash
+func (s *awsSecretsManagerStore) List(ctx context.Context) ([]StoredSecret, error) {
+	secrets := []StoredSecret{}
+	paginator := secretsmanager.NewListSecretsPaginator(s.client, &secretsmanager.ListSecretsInput{
+		Filters: []types.Filter{{Key: types.FilterNameStringTypeName, Values: []string{s.prefix}}},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range page.SecretList {
+			name := aws.ToString(entry.Name)
+			if !strings.HasPrefix(name, s.prefix) {
+				continue // the name filter matches prefixes of words
+			}
+			if awsTag(entry.Tags, awsTagPrefix+managedByLabel) != managedByValue && !flag_force {
+				log.Debug("awsSecretsManagerStore: Skipped ", name, ", not managed by laps2onepassword")
+				continue
+			}
+			value, err := s.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: entry.ARN})
+			if err != nil {
+				return nil, err
+			}
+			payload := awsSecretPayload{}
+			err = json.Unmarshal([]byte(aws.ToString(value.SecretString)), &payload)
+			if err != nil {
+				log.Warn("awsSecretsManagerStore: ", name, " has no JSON payload: ", err)
+			}
+			title := awsTag(entry.Tags, awsTagPrefix+"hostname")
+			if title == "" {
+				title = strings.TrimPrefix(name, s.prefix)
+			}
+			secrets = append(secrets, StoredSecret{
+				ID:      aws.ToString(entry.ARN),
+				Title:   title,
+				GUID:    awsTag(entry.Tags, awsTagPrefix+"objectGUID"),
+				Hash:    payload.SyncHash,
+				Updated: aws.ToTime(entry.LastChangedDate),
+			})
+		}
+	}
+	log.Debug("awsSecretsManagerStore: Got ", len(secrets), " secrets named ", s.prefix, "*")
+	return secrets, nil
+}
+
+// Create creates the secret of lapsEntry, encrypted with AWS_SM_KMS_KEY_ID
+// or the aws/secretsmanager key
+func (s *awsSecretsManagerStore) Create(lapsEntry LapsEntry) error {
+	secretString, err := awsSecretString(lapsEntry)
+	if err != nil {
+		return err
+	}
+	tags, err := awsSecretTags(lapsEntry)
+	if err != nil {
+		return err
+	}
+	input := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(s.prefix + lapsEntry.Title()),
+		Description:  aws.String("LAPS password of " + lapsEntry.Title() + " synced by laps2onepassword"),
+		SecretString: aws.String(secretString),
+		Tags:         tags,
+	}
+	if kmsKey := getEnv("AWS_SM_KMS_KEY_ID", ""); kmsKey != "" {
+		input.KmsKeyId = aws.String(kmsKey)
+	}
+	log.Info("awsSecretsManagerStore: Create ", aws.ToString(input.Name))
+	_, err = s.client.CreateSecret(context.Background(), input)
+	return err
+}
+
+// Update stores a new version of the secret and updates its tags
+func (s *awsSecretsManagerStore) Update(secret StoredSecret, lapsEntry LapsEntry) error {
+	secretString, err := awsSecretString(lapsEntry)
+	if err != nil {
+		return err
+	}
+	tags, err := awsSecretTags(lapsEntry)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	log.Info("awsSecretsManagerStore: Update ", secret.ID)
+	_, err = s.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(secret.ID),
+		SecretString: aws.String(secretString),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TagResource(ctx, &secretsmanager.TagResourceInput{
+		SecretId: aws.String(secret.ID),
+		Tags:     tags,
+	})
+	return err
+}
+
+// Archive schedules the deletion of the secret after
+// AWS_SM_RECOVERY_WINDOW_DAYS, it can be restored until then
+func (s *awsSecretsManagerStore) Archive(secret StoredSecret) error {
+	log.Info("awsSecretsManagerStore: Delete ", secret.ID)
+	_, err := s.client.DeleteSecret(context.Background(), &secretsmanager.DeleteSecretInput{
+		SecretId:             aws.String(secret.ID),
+		RecoveryWindowInDays: aws.Int64(int64(getEnvInt("AWS_SM_RECOVERY_WINDOW_DAYS", 30))),
+	})
+	return err
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// bitwardenStore is the SecretStore of a Bitwarden or Vaultwarden
+// organization collection. Vault items are end-to-end encrypted and can't be
+// written with the organization public API, so the Bitwarden CLI (bw) is used.
+// It must be logged in to the server (bw config server, bw login --apikey).
+type bitwardenStore struct {
+	path    string
+	session string
+	mutex   sync.Mutex // bw doesn't support concurrent runs
+	synced  bool
+}
+
+// bwItem is a login item as printed by bw list items, unknown attributes
+// are kept on updates
+type bwItem map[string]interface{}
+
+// bwField is a custom field of a bwItem
+type bwField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  int    `json:"type"` // 0 text, 1 hidden
+}
+
+// newBitwardenStore returns the store running BW_CLI_PATH (default bw)
+func newBitwardenStore() (*bitwardenStore, error) {
+	path, err := exec.LookPath(getEnv("BW_CLI_PATH", "bw"))
+	if err != nil {
+		return nil, err
+	}
+	return &bitwardenStore{path: path, session: os.Getenv("BW_SESSION")}, nil
+}
+
+func (s *bitwardenStore) Name() string {
+	return destinationBitwarden
+}
+
+// run executes bw with args and decodes its JSON output into result
+func (s *bitwardenStore) run(result interface{}, args ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.runLocked(result, nil, args...)
+}
+
+// runInput is run with input on stdin, items are passed this way as they
+// contain the password and the command line is readable by all local users
+func (s *bitwardenStore) runInput(result interface{}, input []byte, args ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.runLocked(result, input, args...)
+}
+
+// runLocked is run with the mutex already held. The session is passed in
+// the environment, not with --session on the command line.
+func (s *bitwardenStore) runLocked(result interface{}, input []byte, args ...string) error {
+	args = append(args, "--nointeraction")
+	cmd := exec.Command(s.path, args...)
+	cmd.Env = os.Environ()
+	if s.session != "" {
+		cmd.Env = append(cmd.Env, "BW_SESSION="+s.session)
+	}
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	log.Trace("bitwardenStore: bw ", args[0], " ", args[1])
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("bw %s %s failed: %v %s", args[0], args[1], err, strings.TrimSpace(stderr.String()+stdout.String()))
+	}
+	if result == nil || stdout.Len() == 0 {
+		return nil
+	}
+	if raw, ok := result.(*string); ok {
+		*raw = strings.TrimSpace(stdout.String())
+		return nil
+	}
+	return json.Unmarshal(stdout.Bytes(), result)
+}
+
+// unlock unlocks the vault with BW_PASSWORD if BW_SESSION isn't set and
+// pulls the latest items from the server, once per run
+func (s *bitwardenStore) unlock() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.synced {
+		return nil
+	}
+	if s.session == "" && os.Getenv("BW_PASSWORD") != "" {
+		err := s.runLocked(&s.session, nil, "unlock", "--passwordenv", "BW_PASSWORD", "--raw")
+		if err != nil {
+			return err
+		}
+		registerSecret(s.session)
+	}
+	err := s.runLocked(nil, nil, "sync")
+	if err != nil {
+		return err
+	}
+	s.synced = true
+	return nil
+}
+
+// getField returns the value of the custom field name of item
+func (i bwItem) getField(name string) string {
+	fields, _ := i["fields"].([]interface{})
+	for _, field := range fields {
+		field, _ := field.(map[string]interface{})
+		if field["name"] == name {
+			value, _ := field["value"].(string)
+			return value
+		}
+	}
+	return ""
+}
+
+// List returns the managed items of BW_COLLECTION_ID
+func (s *bitwardenStore) List(ctx context.Context) ([]StoredSecret, error) {
+	err := s.unlock()
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	items := []bwItem{}
+	err = s.run(&items, "list", "items", "--organizationid", os.Getenv("BW_ORGANIZATION_ID"), "--collectionid", os.Getenv("BW_COLLECTION_ID"))
+	if err != nil {
+		return nil, err
+	}
+	secrets := []StoredSecret{}
+	for _, item := range items {
+		name, _ := item["name"].(string)
+		if item.getField(managedByLabel) != managedByValue && item.getField("objectGUID") == "" && !flag_force {
+			log.Debug("bitwardenStore: Skipped ", name, ", not managed by laps2onepassword")
+			continue
+		}
+		id, _ := item["id"].(string)
+		revision, _ := item["revisionDate"].(string)
+		updated, _ := time.Parse(time.RFC3339, revision)
+		secrets = append(secrets, StoredSecret{
+			ID:      id,
+			Title:   name,
+			GUID:    item.getField("objectGUID"),
+			Hash:    item.getField(syncHashLabel),
+			Updated: updated,
+			ref:     item,
+		})
+	}
+	log.Debug("bitwardenStore: Got ", len(secrets), " items from collection ", os.Getenv("BW_COLLECTION_ID"))
+	return secrets, nil
+}
+
+// setBwItem writes lapsEntry into item, custom fields of other names are kept
+func setBwItem(item bwItem, lapsEntry LapsEntry) {
+	item["type"] = 1 // login
+	item["name"] = lapsEntry.Title()
+	login, _ := item["login"].(map[string]interface{})
+	if login == nil {
+		login = map[string]interface{}{}
+	}
+	login["username"] = lapsEntry.Username()
+	login["password"] = lapsEntry.password
+	item["login"] = login
+
+	synced := []bwField{
+		{Name: "objectGUID", Value: lapsEntry.guid},
+		{Name: "distinguishedName", Value: lapsEntry.dn},
+		{Name: "Password expires", Value: expirationDate(lapsEntry)},
+		{Name: "Source", Value: lapsEntry.source},
+		{Name: syncHashLabel, Value: newSyncHash(lapsEntry), Type: 1},
+		{Name: managedByLabel, Value: managedByValue},
+	}
+	fields := []interface{}{}
+	existing, _ := item["fields"].([]interface{})
+	for _, field := range existing {
+		name, _ := field.(map[string]interface{})["name"].(string)
+		found := false
+		for _, s := range synced {
+			found = found || s.Name == name
+		}
+		if !found {
+			fields = append(fields, field)
+		}
+	}
+	for _, field := range synced {
+		fields = append(fields, field)
+	}
+	item["fields"] = fields
+}
+
+// encodeBwItem returns item as base64 encoded JSON for bw create/edit
+func encodeBwItem(item bwItem) ([]byte, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(data)))
+	base64.StdEncoding.Encode(encoded, data)
+	return encoded, nil
+}
+
+// Create creates a login item in BW_COLLECTION_ID
+func (s *bitwardenStore) Create(lapsEntry LapsEntry) error {
+	err := s.unlock()
+	if err != nil {
+		return err
+	}
+	item := bwItem{
+		"organizationId": os.Getenv("BW_ORGANIZATION_ID"),
+		"collectionIds":  []string{os.Getenv("BW_COLLECTION_ID")},
+		"notes":          nil,
+		"favorite":       isFavorite(lapsEntry),
+		"reprompt":       0,
+	}
+	setBwItem(item, lapsEntry)
+	encoded, err := encodeBwItem(item)
+	if err != nil {
+		return err
+	}
+	log.Info("bitwardenStore: Create ", lapsEntry.Title())
+	return s.runInput(nil, encoded, "create", "item")
+}
+
+// Update writes lapsEntry into the item
+func (s *bitwardenStore) Update(secret StoredSecret, lapsEntry LapsEntry) error {
+	item := secret.ref.(bwItem)
+	setBwItem(item, lapsEntry)
+	encoded, err := encodeBwItem(item)
+	if err != nil {
+		return err
+	}
+	log.Info("bitwardenStore: Update ", lapsEntry.Title())
+	return s.runInput(nil, encoded, "edit", "item", secret.ID)
+}
+
+// Archive moves the item to the trash, it can be restored until the
+// server purges the trash
+func (s *bitwardenStore) Archive(secret StoredSecret) error {
+	log.Info("bitwardenStore: Delete ", secret.Title)
+	return s.run(nil, "delete", "item", secret.ID)
+}
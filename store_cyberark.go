@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Platform properties of the accounts written by laps2onepassword, they
+// must be defined as optional properties of CYBERARK_PLATFORM_ID
+const (
+	cyberArkGUIDProperty      = "LAPSObjectGUID"
+	cyberArkHashProperty      = "LAPSSyncHash"
+	cyberArkManagedByProperty = "LAPSManagedBy"
+)
+
+// cyberArkStore is the SecretStore of CyberArk PAM accounts written with the
+// PVWA REST API, the Central Credential Provider (CCP) can only read them.
+// Every LAPS entry is an account in the safe selected by CYBERARK_SAFE_ROUTES.
+type cyberArkStore struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+	logon      sync.Once
+	logonErr   error
+}
+
+// cyberArkAccount is an account of the PVWA Accounts API
+type cyberArkAccount struct {
+	ID                        string            `json:"id,omitempty"`
+	Name                      string            `json:"name"`
+	Address                   string            `json:"address"`
+	UserName                  string            `json:"userName"`
+	PlatformID                string            `json:"platformId"`
+	SafeName                  string            `json:"safeName"`
+	SecretType                string            `json:"secretType"`
+	Secret                    string            `json:"secret,omitempty"`
+	PlatformAccountProperties map[string]string `json:"platformAccountProperties"`
+	SecretManagement          struct {
+		AutomaticManagementEnabled bool   `json:"automaticManagementEnabled"`
+		ManualManagementReason     string `json:"manualManagementReason,omitempty"`
+		LastModifiedTime           int64  `json:"lastModifiedTime,omitempty"`
+	} `json:"secretManagement"`
+}
+
+// newCyberArkStore returns the store of the PVWA at CYBERARK_URL, it logs
+// on with the first request
+func newCyberArkStore() (*cyberArkStore, error) {
+	return &cyberArkStore{
+		httpClient: &http.Client{Transport: newRetryTransport(nil), Timeout: time.Minute},
+		baseURL:    strings.TrimSuffix(os.Getenv("CYBERARK_URL"), "/"),
+	}, nil
+}
+
+func (s *cyberArkStore) Name() string {
+	return destinationCyberArk
+}
+
+// GetCyberArkSafeRules returns the CYBERARK_SAFE_ROUTES rules, the value is
+// the safe of the selected computers
+func GetCyberArkSafeRules() ([]ItemRule, error) {
+	return parseItemRules("CYBERARK_SAFE_ROUTES", true)
+}
+
+// cyberArkSafeFor returns the safe of the first CYBERARK_SAFE_ROUTES rule
+// matching lapsEntry, CYBERARK_SAFE if none matches
+func cyberArkSafeFor(lapsEntry LapsEntry) string {
+	rules, _ := GetCyberArkSafeRules()
+	for _, rule := range rules {
+		if rule.Match(lapsEntry) {
+			return rule.value
+		}
+	}
+	return os.Getenv("CYBERARK_SAFE")
+}
+
+// cyberArkSafes returns all safes accounts are written to
+func cyberArkSafes() []string {
+	safes := []string{os.Getenv("CYBERARK_SAFE")}
+	rules, _ := GetCyberArkSafeRules()
+	for _, rule := range rules {
+		if !containsString(safes, rule.value) {
+			safes = append(safes, rule.value)
+		}
+	}
+	return safes
+}
+
+// authenticate logs on with CYBERARK_USERNAME and CYBERARK_PASSWORD using
+// the CYBERARK_AUTH_TYPE method (cyberark, ldap or radius)
+func (s *cyberArkStore) authenticate() error {
+	s.logon.Do(func() {
+		s.logonErr = s.request(http.MethodPost, "/API/auth/"+getEnv("CYBERARK_AUTH_TYPE", "cyberark")+"/Logon", map[string]interface{}{
+			"username":          os.Getenv("CYBERARK_USERNAME"),
+			"password":          os.Getenv("CYBERARK_PASSWORD"),
+			"concurrentSession": true,
+		}, &s.token)
+		if s.logonErr == nil {
+			registerSecret(s.token)
+			log.Debug("cyberArkStore: Logged on as ", os.Getenv("CYBERARK_USERNAME"))
+		}
+	})
+	return s.logonErr
+}
+
+// request sends a request to the PVWA API path and decodes the json
+// response into result
+func (s *cyberArkStore) request(method string, path string, body interface{}, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", s.token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("cyberark %s %s failed with status %d: %s", method, path, resp.StatusCode, data)
+	}
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// List returns the managed accounts of all safes
+func (s *cyberArkStore) List(ctx context.Context) ([]StoredSecret, error) {
+	err := s.authenticate()
+	if err != nil {
+		return nil, err
+	}
+	secrets := []StoredSecret{}
+	for _, safe := range cyberArkSafes() {
+		next := "/API/Accounts?limit=1000&filter=" + url.QueryEscape("safeName eq "+safe)
+		for next != "" {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			page := struct {
+				Value    []cyberArkAccount `json:"value"`
+				NextLink string            `json:"nextLink"`
+			}{}
+			err = s.request(http.MethodGet, next, nil, &page)
+			if err != nil {
+				return nil, err
+			}
+			for _, account := range page.Value {
+				properties := account.PlatformAccountProperties
+				if properties[cyberArkManagedByProperty] != managedByValue && !flag_force {
+					log.Debug("cyberArkStore: Skipped ", safe, "/", account.Name, ", not managed by laps2onepassword")
+					continue
+				}
+				secrets = append(secrets, StoredSecret{
+					ID:      account.ID,
+					Title:   account.Name,
+					GUID:    properties[cyberArkGUIDProperty],
+					Hash:    properties[cyberArkHashProperty],
+					Updated: time.Unix(account.SecretManagement.LastModifiedTime, 0),
+					ref:     account,
+				})
+			}
+			next = ""
+			if page.NextLink != "" {
+				next = "/" + strings.TrimPrefix(page.NextLink, "/")
+			}
+		}
+	}
+	log.Debug("cyberArkStore: Got ", len(secrets), " accounts from ", strings.Join(cyberArkSafes(), ", "))
+	return secrets, nil
+}
+
+// cyberArkProperties returns the platform properties of lapsEntry
+func cyberArkProperties(lapsEntry LapsEntry) map[string]string {
+	return map[string]string{
+		cyberArkGUIDProperty:      lapsEntry.guid,
+		cyberArkHashProperty:      newSyncHash(lapsEntry),
+		cyberArkManagedByProperty: managedByValue,
+	}
+}
+
+// Create adds the account of lapsEntry to its safe, automatic password
+// management is disabled as LAPS rotates the password
+func (s *cyberArkStore) Create(lapsEntry LapsEntry) error {
+	err := s.authenticate()
+	if err != nil {
+		return err
+	}
+	account := cyberArkAccount{
+		Name:                      lapsEntry.Title(),
+		Address:                   lapsEntry.Title(),
+		UserName:                  lapsEntry.Username(),
+		PlatformID:                os.Getenv("CYBERARK_PLATFORM_ID"),
+		SafeName:                  cyberArkSafeFor(lapsEntry),
+		SecretType:                "password",
+		Secret:                    lapsEntry.password,
+		PlatformAccountProperties: cyberArkProperties(lapsEntry),
+	}
+	account.SecretManagement.ManualManagementReason = "Managed by Windows LAPS, synced by laps2onepassword"
+	log.Info("cyberArkStore: Create ", account.SafeName, "/", account.Name)
+	return s.request(http.MethodPost, "/API/Accounts", account, nil)
+}
+
+// Update sets the password in the vault and updates the properties, an
+// account of a computer routed to another safe is moved by recreating it
+func (s *cyberArkStore) Update(secret StoredSecret, lapsEntry LapsEntry) error {
+	err := s.authenticate()
+	if err != nil {
+		return err
+	}
+	account := secret.ref.(cyberArkAccount)
+	if account.SafeName != cyberArkSafeFor(lapsEntry) {
+		err = s.Create(lapsEntry)
+		if err != nil {
+			return err
+		}
+		return s.Archive(secret)
+	}
+	log.Info("cyberArkStore: Update ", account.SafeName, "/", account.Name)
+	err = s.request(http.MethodPost, "/API/Accounts/"+url.PathEscape(secret.ID)+"/Password/Update", map[string]interface{}{
+		"ChangeEntireGroup": false,
+		"NewCredentials":    lapsEntry.password,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	patch := []map[string]string{
+		{"op": "replace", "path": "/userName", "value": lapsEntry.Username()},
+	}
+	for name, value := range cyberArkProperties(lapsEntry) {
+		patch = append(patch, map[string]string{"op": "add", "path": "/platformAccountProperties/" + name, "value": value})
+	}
+	return s.request(http.MethodPatch, "/API/Accounts/"+url.PathEscape(secret.ID), patch, nil)
+}
+
+// Archive deletes the account, the vault keeps it for the retention
+// period of the safe
+func (s *cyberArkStore) Archive(secret StoredSecret) error {
+	err := s.authenticate()
+	if err != nil {
+		return err
+	}
+	log.Info("cyberArkStore: Delete ", secret.Title)
+	return s.request(http.MethodDelete, "/API/Accounts/"+url.PathEscape(secret.ID), nil, nil)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+	log "github.com/sirupsen/logrus"
+)
+
+// onePasswordStore is the SecretStore of 1Password items
+type onePasswordStore struct{}
+
+func (s *onePasswordStore) Name() string {
+	return destinationOnePassword
+}
+
+// List returns the items of all vaults as secrets
+func (s *onePasswordStore) List(ctx context.Context) ([]StoredSecret, error) {
+	onepassentries, err := GetOnePassEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make([]StoredSecret, 0, len(onepassentries))
+	for _, onepassentry := range onepassentries {
+		secrets = append(secrets, StoredSecret{
+			ID:      onepassentry.ID,
+			Title:   onepassentry.Title,
+			GUID:    getItemSectionValue(onepassentry, syncSectionID, "objectGUID"),
+			Hash:    getItemSectionValue(onepassentry, syncSectionID, syncHashLabel),
+			Updated: onepassentry.UpdatedAt,
+			ref:     onepassentry,
+		})
+	}
+	return secrets, nil
+}
+
+func (s *onePasswordStore) Create(lapsEntry LapsEntry) error {
+	return CreateOnPassEntryFromLapsEntry(lapsEntry)
+}
+
+func (s *onePasswordStore) Update(secret StoredSecret, lapsEntry LapsEntry) error {
+	return UpdateOnPassEntry(secret.ref.(onepassword.Item), lapsEntry)
+}
+
+// Archive moves the item into OP_ORPHAN_ARCHIVE_VAULT
+func (s *onePasswordStore) Archive(secret StoredSecret) error {
+	client, err := NewOnePassClient()
+	if err != nil {
+		return err
+	}
+	return archiveOnePassEntry(client, secret.ref.(onepassword.Item))
+}
+
+// Sync compares the items with lapsentries and applies OP_ORPHAN_ACTION,
+// with conflict detection and orphan tags only 1Password supports
+func (s *onePasswordStore) Sync(ctx context.Context, lapsentries []LapsEntry, deleted []string) error {
+	onepassentries, err := GetOnePassEntries(ctx)
+	if err != nil {
+		return err
+	}
+	if len(onepassentries) < 1 {
+		log.Warn("No entries returned from onepass")
+	}
+
+	err = CompareLapsToOnepass(ctx, lapsentries, onepassentries)
+	if err != nil || ctx.Err() != nil {
+		return err
+	}
+	if len(deleted) > 0 {
+		err = TagOrphanedOnePassEntries(deleted, onepassentries)
+		if err != nil {
+			return err
+		}
+	}
+	if GetOrphanAction() != orphanActionNone {
+		if isPartialRun() {
+			log.Info("Sync: Skipped orphaned items on partial run")
+		} else {
+			return HandleOrphanedOnePassEntries(ctx, lapsentries, onepassentries)
+		}
+	}
+	return nil
+}
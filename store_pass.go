@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// passStore is the SecretStore of a passwordstore.org (pass, gopass)
+// compatible directory. Every LAPS entry is one GPG encrypted file
+// <PASS_PREFIX>/<hostname>.gpg, the password in the first line followed by
+// key: value lines. Every sync with changes is one git commit.
+type passStore struct {
+	dir    string
+	prefix string
+	gpg    string
+}
+
+// newPassStore returns the store in PASS_STORE_DIR, default
+// PASSWORD_STORE_DIR or ~/.password-store like pass
+func newPassStore() (*passStore, error) {
+	dir := getEnv("PASS_STORE_DIR", os.Getenv("PASSWORD_STORE_DIR"))
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(home, ".password-store")
+	}
+	gpg, err := exec.LookPath(getEnv("PASS_GPG_PATH", "gpg"))
+	if err != nil {
+		return nil, err
+	}
+	return &passStore{dir: dir, prefix: getEnv("PASS_PREFIX", "laps"), gpg: gpg}, nil
+}
+
+func (s *passStore) Name() string {
+	return destinationPass
+}
+
+// secretFile returns the file of hostname
+func (s *passStore) secretFile(hostname string) string {
+	return filepath.Join(s.dir, s.prefix, strings.NewReplacer("/", "_", "\\", "_").Replace(hostname)+".gpg")
+}
+
+// recipients returns the GPG ids of file from the nearest .gpg-id like pass
+func (s *passStore) recipients(file string) ([]string, error) {
+	for dir := filepath.Dir(file); ; dir = filepath.Dir(dir) {
+		data, err := os.ReadFile(filepath.Join(dir, ".gpg-id"))
+		if err == nil {
+			return strings.Fields(string(data)), nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if dir == s.dir || dir == filepath.Dir(dir) {
+			return nil, fmt.Errorf("no .gpg-id found in %s", s.dir)
+		}
+	}
+}
+
+// gpgRun runs gpg with args and stdin, returns its output
+func (s *passStore) gpgRun(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command(s.gpg, append([]string{"--batch", "--quiet", "--yes"}, args...)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("gpg %s failed: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// passContent returns the file content of lapsEntry
+func passContent(lapsEntry LapsEntry) []byte {
+	var content bytes.Buffer
+	fmt.Fprintln(&content, lapsEntry.password)
+	fmt.Fprintln(&content, "username:", lapsEntry.Username())
+	fmt.Fprintln(&content, "expiration:", expirationDate(lapsEntry))
+	fmt.Fprintln(&content, "dn:", lapsEntry.dn)
+	fmt.Fprintln(&content, "objectGUID:", lapsEntry.guid)
+	fmt.Fprintln(&content, "source:", lapsEntry.source)
+	fmt.Fprintln(&content, "sync_hash:", newSyncHash(lapsEntry))
+	fmt.Fprintln(&content, managedByLabel+":", managedByValue)
+	return content.Bytes()
+}
+
+// parsePassContent returns the key: value lines after the password
+func parsePassContent(content []byte) map[string]string {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Scan() // password
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if found {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// List returns the files below PASS_PREFIX. Files are decrypted for their
+// sync hash and objectGUID, without the private key every file is rewritten.
+func (s *passStore) List(ctx context.Context) ([]StoredSecret, error) {
+	secrets := []StoredSecret{}
+	root := filepath.Join(s.dir, s.prefix)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == root {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.IsDir() || !strings.HasSuffix(path, ".gpg") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		secret := StoredSecret{
+			ID:      path,
+			Title:   strings.TrimSuffix(entry.Name(), ".gpg"),
+			Updated: info.ModTime(),
+		}
+		content, err := s.gpgRun(nil, "--decrypt", path)
+		if err != nil {
+			log.Debug("passStore: Can't decrypt ", path, ": ", err)
+		} else {
+			values := parsePassContent(content)
+			if values[managedByLabel] != managedByValue && !flag_force {
+				log.Debug("passStore: Skipped ", path, ", not managed by laps2onepassword")
+				return nil
+			}
+			secret.GUID = values["objectGUID"]
+			secret.Hash = values["sync_hash"]
+		}
+		secrets = append(secrets, secret)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("passStore: Got ", len(secrets), " files from ", root)
+	return secrets, nil
+}
+
+// write encrypts the content of lapsEntry into file for the recipients of
+// its .gpg-id
+func (s *passStore) write(file string, lapsEntry LapsEntry) error {
+	recipients, err := s.recipients(file)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+	args := []string{"--encrypt", "--output", file}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+	_, err = s.gpgRun(passContent(lapsEntry), args...)
+	return err
+}
+
+func (s *passStore) Create(lapsEntry LapsEntry) error {
+	file := s.secretFile(lapsEntry.Title())
+	log.Info("passStore: Create ", file)
+	return s.write(file, lapsEntry)
+}
+
+func (s *passStore) Update(secret StoredSecret, lapsEntry LapsEntry) error {
+	file := s.secretFile(lapsEntry.Title())
+	log.Info("passStore: Update ", file)
+	err := s.write(file, lapsEntry)
+	if err != nil || file == secret.ID {
+		return err
+	}
+	return os.Remove(secret.ID) // renamed computer
+}
+
+// Archive removes the file, it stays in the git history of the store
+func (s *passStore) Archive(secret StoredSecret) error {
+	log.Info("passStore: Delete ", secret.ID)
+	return os.Remove(secret.ID)
+}
+
+// Commit commits all changes below PASS_PREFIX if the store is a git
+// repository and pushes them with PASS_GIT_PUSH
+func (s *passStore) Commit(message string) error {
+	if _, err := os.Stat(filepath.Join(s.dir, ".git")); err != nil {
+		return nil
+	}
+	git := func(args ...string) (string, error) {
+		output, err := exec.Command("git", append([]string{"-C", s.dir}, args...)...).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s failed: %v %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+		return string(output), nil
+	}
+	_, err := git("add", "--all", "--", s.prefix)
+	if err != nil {
+		return err
+	}
+	status, err := git("status", "--porcelain", "--", s.prefix)
+	if err != nil || strings.TrimSpace(status) == "" {
+		return err
+	}
+	_, err = git("commit", "--quiet", "-m", message, "--", s.prefix)
+	if err != nil {
+		return err
+	}
+	log.Info("passStore: Committed ", message)
+	if getEnvBool("PASS_GIT_PUSH", false) {
+		_, err = git("push", "--quiet")
+	}
+	return err
+}
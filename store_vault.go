@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultVaultPathTemplate is the default VAULT_PATH_TEMPLATE
+const defaultVaultPathTemplate = "laps/{{.Hostname}}"
+
+// vaultStore is the SecretStore of a HashiCorp Vault KV v2 secrets engine.
+// Every LAPS entry is one secret, an update writes a new version of it so
+// previous passwords stay in the KV version history.
+type vaultStore struct {
+	httpClient *http.Client
+	addr       string
+	mount      string
+	token      string
+	login      sync.Once
+	loginErr   error
+}
+
+// errVaultNotFound is returned for missing paths
+var errVaultNotFound = errors.New("not found")
+
+// vaultSecretVersion is the current version of a secret, used as
+// check-and-set on updates
+type vaultSecretVersion struct {
+	path    string
+	version int
+}
+
+// newVaultStore returns the store of VAULT_ADDR and VAULT_KV_MOUNT, it
+// authenticates on the first request
+func newVaultStore() (*vaultStore, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile := os.Getenv("VAULT_CACERT"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &vaultStore{
+		httpClient: &http.Client{Transport: newRetryTransport(transport), Timeout: time.Minute},
+		addr:       strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/"),
+		mount:      strings.Trim(getEnv("VAULT_KV_MOUNT", "secret"), "/"),
+	}, nil
+}
+
+func (s *vaultStore) Name() string {
+	return destinationVault
+}
+
+// authenticate uses VAULT_TOKEN or logs in with VAULT_ROLE_ID and
+// VAULT_SECRET_ID at the AppRole auth method VAULT_APPROLE_MOUNT
+func (s *vaultStore) authenticate() error {
+	s.login.Do(func() {
+		s.token = os.Getenv("VAULT_TOKEN")
+		if s.token != "" {
+			return
+		}
+		login := struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}{}
+		s.loginErr = s.request(http.MethodPost, "auth/"+strings.Trim(getEnv("VAULT_APPROLE_MOUNT", "approle"), "/")+"/login", map[string]string{
+			"role_id":   os.Getenv("VAULT_ROLE_ID"),
+			"secret_id": os.Getenv("VAULT_SECRET_ID"),
+		}, &login)
+		if s.loginErr == nil {
+			s.token = login.Auth.ClientToken
+			registerSecret(s.token)
+			log.Debug("vaultStore: Logged in with AppRole ", os.Getenv("VAULT_ROLE_ID"))
+		}
+	})
+	return s.loginErr
+}
+
+// request sends a request to the Vault API path below /v1 and decodes the json
+// response into result. Returns errVaultNotFound on 404.
+func (s *vaultStore) request(method string, path string, body interface{}, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.addr+"/v1/"+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return errVaultNotFound
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("vault %s %s failed with status %d: %s", method, path, resp.StatusCode, data)
+	}
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// secretPath returns the rendered VAULT_PATH_TEMPLATE of lapsEntry
+func secretPath(lapsEntry LapsEntry) (string, error) {
+	paths, err := renderTemplates("VAULT_PATH_TEMPLATE", []string{getEnv("VAULT_PATH_TEMPLATE", defaultVaultPathTemplate)}, lapsEntry)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("VAULT_PATH_TEMPLATE is empty for %s", lapsEntry.Title())
+	}
+	return strings.Trim(paths[0], "/"), nil
+}
+
+// secretPathPrefix returns the static folder of VAULT_PATH_TEMPLATE, all
+// secrets written by laps2onepassword are below it
+func secretPathPrefix() string {
+	prefix := getEnv("VAULT_PATH_TEMPLATE", defaultVaultPathTemplate)
+	if i := strings.Index(prefix, "{{"); i >= 0 {
+		prefix = prefix[:i]
+	}
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		return strings.Trim(prefix[:i+1], "/")
+	}
+	return ""
+}
+
+// listPaths returns all secret paths below folder
+func (s *vaultStore) listPaths(folder string) ([]string, error) {
+	list := struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}{}
+	err := s.request("LIST", s.mount+"/metadata/"+folder, nil, &list)
+	if err == errVaultNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, key := range list.Data.Keys {
+		path := strings.TrimPrefix(folder+"/"+key, "/")
+		if strings.HasSuffix(key, "/") {
+			subpaths, err := s.listPaths(strings.TrimSuffix(path, "/"))
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, subpaths...)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// List returns the current version of all secrets below the
+// VAULT_PATH_TEMPLATE folder, deleted versions are skipped
+func (s *vaultStore) List(ctx context.Context) ([]StoredSecret, error) {
+	err := s.authenticate()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := s.listPaths(secretPathPrefix())
+	if err != nil {
+		return nil, err
+	}
+	secrets := []StoredSecret{}
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		secret := struct {
+			Data struct {
+				Data     map[string]string `json:"data"`
+				Metadata struct {
+					CreatedTime time.Time `json:"created_time"`
+					Version     int       `json:"version"`
+				} `json:"metadata"`
+			} `json:"data"`
+		}{}
+		err = s.request(http.MethodGet, s.mount+"/data/"+path, nil, &secret)
+		if err == errVaultNotFound {
+			log.Trace("vaultStore: Skipped deleted ", path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data := secret.Data.Data
+		if data[managedByLabel] != managedByValue && !flag_force {
+			log.Debug("vaultStore: Skipped ", path, ", not managed by laps2onepassword")
+			continue
+		}
+		secrets = append(secrets, StoredSecret{
+			ID:      path,
+			Title:   data["hostname"],
+			GUID:    data["objectGUID"],
+			Hash:    data["sync_hash"],
+			Updated: secret.Data.Metadata.CreatedTime, // creation of the current version
+			ref:     vaultSecretVersion{path: path, version: secret.Data.Metadata.Version},
+		})
+	}
+	log.Debug("vaultStore: Got ", len(secrets), " secrets from ", s.mount, "/", secretPathPrefix())
+	return secrets, nil
+}
+
+// secretData returns the keys written for lapsEntry
+func secretData(lapsEntry LapsEntry) map[string]string {
+	return map[string]string{
+		"username":     lapsEntry.Username(),
+		"password":     lapsEntry.password,
+		"expiration":   expirationDate(lapsEntry),
+		"hostname":     lapsEntry.Title(),
+		"dn":           lapsEntry.dn,
+		"objectGUID":   lapsEntry.guid,
+		"source":       lapsEntry.source,
+		"sync_hash":    newSyncHash(lapsEntry),
+		managedByLabel: managedByValue,
+	}
+}
+
+// write writes a new version of the secret at path. cas is the expected
+// current version, 0 requires the path to be unused.
+func (s *vaultStore) write(path string, lapsEntry LapsEntry, cas int) error {
+	err := s.authenticate()
+	if err != nil {
+		return err
+	}
+	return s.request(http.MethodPost, s.mount+"/data/"+path, map[string]interface{}{
+		"options": map[string]int{"cas": cas},
+		"data":    secretData(lapsEntry),
+	}, nil)
+}
+
+// Create writes the first version of the secret of lapsEntry, the number
+// of versions kept is set by VAULT_KV_MAX_VERSIONS
+func (s *vaultStore) Create(lapsEntry LapsEntry) error {
+	path, err := secretPath(lapsEntry)
+	if err != nil {
+		return err
+	}
+	log.Info("vaultStore: Create ", path)
+	err = s.write(path, lapsEntry, 0)
+	if err != nil {
+		return err
+	}
+	if maxVersions := getEnvInt("VAULT_KV_MAX_VERSIONS", 0); maxVersions > 0 {
+		return s.request(http.MethodPost, s.mount+"/metadata/"+path, map[string]int{"max_versions": maxVersions}, nil)
+	}
+	return nil
+}
+
+// Update writes a new version of the secret, fails if the secret was
+// written by someone else since it was listed
+func (s *vaultStore) Update(secret StoredSecret, lapsEntry LapsEntry) error {
+	current := secret.ref.(vaultSecretVersion)
+	path, err := secretPath(lapsEntry)
+	if err != nil {
+		return err
+	}
+	if path != current.path {
+		// moved by a changed VAULT_PATH_TEMPLATE or hostname
+		err = s.Create(lapsEntry)
+		if err != nil {
+			return err
+		}
+		return s.Archive(secret)
+	}
+	log.Info("vaultStore: Update ", path, " version ", current.version+1)
+	return s.write(path, lapsEntry, current.version)
+}
+
+// Archive soft deletes the current version, it can be restored with
+// vault kv undelete
+func (s *vaultStore) Archive(secret StoredSecret) error {
+	err := s.authenticate()
+	if err != nil {
+		return err
+	}
+	log.Info("vaultStore: Delete ", secret.ID)
+	return s.request(http.MethodDelete, s.mount+"/data/"+secret.ID, nil, nil)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Exit codes, see README
+const (
+	exitOK          = 0
+	exitError       = 1 // unexpected error
+	exitDrift       = 2 // verify found drift, missing or orphaned items
+	exitConfig      = 3 // invalid settings or command line
+	exitLdap        = 4 // reading ldap or entra failed
+	exitDestination = 5 // 1Password or another destination failed, nothing written
+	exitPartial     = 6 // some items or destinations failed, the others were written
+	exitLocked      = 7 // another instance holds the lock file, nothing done
+	// exitDeadline = 8, see deadline.go
+	// exitFailures = 9, see kubernetes.go
+	// exitInterrupted = 130, see shutdown.go
+)
+
+// RunSummary counts the results of a sync run over all destinations
+type RunSummary struct {
+	mu          sync.Mutex
+	started     time.Time
+	read        int
+	quarantined int
+	totals      map[string]int // created, updated, unchanged, orphaned, failed
+	errors      []string       // error messages for notifications
+	items       []itemResult   // every item for --output json
+}
+
+// summary is the RunSummary of the current run
+var summary = newRunSummary()
+
+// newRunSummary returns an empty summary started now
+func newRunSummary() *RunSummary {
+	return &RunSummary{started: time.Now(), totals: map[string]int{}}
+}
+
+// add counts n results of kind
+func (s *RunSummary) add(kind string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.totals[kind] += n
+}
+
+// addError keeps message for the notifications, up to notifyMaxErrors
+func (s *RunSummary) addError(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errors) < notifyMaxErrors {
+		s.errors = append(s.errors, message)
+	}
+}
+
+// addItem keeps the result of an item for --output json
+func (s *RunSummary) addItem(item itemResult) {
+	if !IsJSONOutput() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, item)
+}
+
+// addResults counts the written results by their kind and the failed ones
+func (s *RunSummary) addResults(results []writeResult) {
+	for _, result := range results {
+		// the items of a dry run are added by printDryRun
+		if !flag_dry_run && result.err != errInterrupted {
+			item := newItemResult(result.job.title, result.job.destination, result.job.vault, result.job.kind, result.job.reason, result.err)
+			item.Attempts = result.attempts
+			item.DurationMs = result.duration.Milliseconds()
+			s.addItem(item)
+		}
+		switch {
+		case result.err == errInterrupted:
+		case result.err != nil:
+			s.add("failed", 1)
+		case result.job.kind == "archived" || result.job.kind == "deleted":
+			s.add("orphaned", 1)
+		default:
+			s.add(result.job.kind, 1)
+		}
+	}
+}
+
+// written returns the number of successful writes
+func (s *RunSummary) written() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.totals["created"] + s.totals["updated"] + s.totals["orphaned"]
+}
+
+// Log writes the summary of the run finished with code
+func (s *RunSummary) Log(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message := fmt.Sprintf("runSync: Summary read=%d quarantined=%d created=%d updated=%d unchanged=%d orphaned=%d failed=%d duration=%s exit=%d",
+		s.read, s.quarantined, s.totals["created"], s.totals["updated"], s.totals["unchanged"], s.totals["orphaned"], s.totals["failed"],
+		time.Since(s.started).Round(time.Millisecond), code)
+	if code == exitOK {
+		logSummary(log.InfoLevel, message)
+	} else {
+		logSummary(log.WarnLevel, message)
+	}
+}
+
+// commandExitCode returns the exit code of a 1Password command finished
+// with err
+func commandExitCode(ctx context.Context, err error) int {
+	if ctx.Err() != nil {
+		return stoppedCode(ctx)
+	}
+	if err != nil {
+		log.Error("Main: ", err)
+		return exitDestination
+	}
+	return exitOK
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runStarted is the start of the sync run in progress, zero between runs
+var (
+	runStarted      time.Time
+	runStartedMutex sync.Mutex
+)
+
+// setRunStarted records the start (or the end with a zero time) of a sync
+// run for the watchdog
+func setRunStarted(t time.Time) {
+	runStartedMutex.Lock()
+	defer runStartedMutex.Unlock()
+	runStarted = t
+}
+
+// sdNotify sends state to the systemd notification socket NOTIFY_SOCKET,
+// it does nothing if the service isn't started with Type=notify
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:] // abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Warn("sdNotify: ", err)
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		log.Warn("sdNotify: ", err)
+	}
+}
+
+// getWatchdogInterval returns the systemd WatchdogSec of this process, zero
+// if the watchdog is disabled
+func getWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// startWatchdog pings the systemd watchdog at half its interval as long as
+// no sync run takes longer than SYNC_RUN_MAX (default SYNC_INTERVAL), so
+// systemd restarts a hanging daemon
+func startWatchdog(done <-chan struct{}) {
+	interval := getWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	maxRun := getEnvDuration("SYNC_RUN_MAX", GetSyncInterval())
+	log.Debug("startWatchdog: Pinging systemd every ", interval/2)
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				runStartedMutex.Lock()
+				started := runStarted
+				runStartedMutex.Unlock()
+				if !started.IsZero() && time.Since(started) > maxRun {
+					log.Error("startWatchdog: Run is in progress since ", started.Format(time.RFC3339), ", no longer pinging systemd")
+					continue
+				}
+				sdNotify("WATCHDOG=1")
+			}
+		}
+	}()
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+	"github.com/go-ldap/ldap/v3"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// ItemTemplate defines the layout of created items, read from the YAML or
+// JSON file in OP_ITEM_TEMPLATE. Field values are text/template strings
+// rendered with itemTemplateData.
+type ItemTemplate struct {
+	Category   string                `yaml:"category"`
+	Tags       []string              `yaml:"tags"`
+	Attributes []string              `yaml:"attributes"` // additional ldap attributes for Attr
+	Sections   []ItemTemplateSection `yaml:"sections"`
+	Fields     []ItemTemplateField   `yaml:"fields"`
+}
+
+// ItemTemplateSection is a section of an ItemTemplate
+type ItemTemplateSection struct {
+	ID    string `yaml:"id"`
+	Label string `yaml:"label"`
+}
+
+// ItemTemplateField is a field of an ItemTemplate, either a built-in field
+// selected by Purpose (USERNAME, PASSWORD or NOTES) or a field in Section
+type ItemTemplateField struct {
+	Section string `yaml:"section"`
+	Purpose string `yaml:"purpose"`
+	Label   string `yaml:"label"`
+	Type    string `yaml:"type"`
+	Value   string `yaml:"value"`
+
+	value *template.Template
+}
+
+// itemTemplate caches the template loaded by LoadItemTemplate
+var itemTemplate *ItemTemplate
+
+// LoadItemTemplate reads and checks OP_ITEM_TEMPLATE, returns nil if unset
+func LoadItemTemplate() (*ItemTemplate, error) {
+	filename := os.Getenv("OP_ITEM_TEMPLATE")
+	if filename == "" || itemTemplate != nil {
+		return itemTemplate, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// YAML is a superset of JSON, so this reads both
+	t := &ItemTemplate{}
+	err = yaml.Unmarshal(data, t)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse %s: %v", filename, err)
+	}
+	sections := map[string]bool{}
+	for _, section := range t.Sections {
+		sections[section.ID] = true
+	}
+	for index := range t.Fields {
+		field := &t.Fields[index]
+		field.Purpose = strings.ToUpper(field.Purpose)
+		switch {
+		case field.Purpose != "" && field.Purpose != "USERNAME" && field.Purpose != "PASSWORD" && field.Purpose != "NOTES":
+			return nil, fmt.Errorf("field %s in %s has unknown purpose %s", field.Label, filename, field.Purpose)
+		case field.Purpose == "" && !sections[field.Section]:
+			return nil, fmt.Errorf("field %s in %s needs a purpose or a defined section", field.Label, filename)
+		}
+		field.value, err = template.New(field.Label).Option("missingkey=error").Parse(field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s in %s: %v", field.Label, filename, err)
+		}
+	}
+	log.Debug("LoadItemTemplate: Loaded ", len(t.Fields), " fields from ", filename)
+	itemTemplate = t
+	return itemTemplate, nil
+}
+
+// itemTemplateAttributes returns the additional ldap attributes of the item template
+func itemTemplateAttributes() []string {
+	t, err := LoadItemTemplate()
+	if err != nil || t == nil {
+		return nil
+	}
+	return t.Attributes
+}
+
+// itemTemplateData is available in the field values of an ItemTemplate
+type itemTemplateData struct {
+	Title                  string
+	Hostname               string
+	Name                   string
+	Username               string
+	Password               string
+	Source                 string
+	Domain                 string // dns domain of DN
+	OU                     string // name of the OU containing the computer
+	Expiration             string
+	DN                     string
+	GUID                   string
+	Description            string
+	OperatingSystem        string
+	OperatingSystemVersion string
+	Action                 string // Created or Updated, only in OP_ITEM_NOTES
+	Time                   string // time of the write, only in OP_ITEM_NOTES
+	RunID                  string // id of the sync run
+	Version                string // version of laps2onepassword
+	Commit                 string // commit laps2onepassword was built from
+	BuildDate              string
+
+	attributes map[string]string
+}
+
+// Attr returns an additional ldap attribute listed in the template attributes
+func (d itemTemplateData) Attr(name string) string {
+	return d.attributes[name]
+}
+
+// newItemTemplateData returns the template data of lapsEntry
+func newItemTemplateData(lapsEntry LapsEntry) itemTemplateData {
+	domain, _ := domainOfDN(lapsEntry.dn)
+	return itemTemplateData{
+		Title:                  lapsEntry.Title(),
+		Hostname:               lapsEntry.dnshostname,
+		Name:                   lapsEntry.name,
+		Username:               lapsEntry.Username(),
+		Password:               lapsEntry.password,
+		Source:                 lapsEntry.source,
+		Domain:                 domain,
+		OU:                     ouOfDN(lapsEntry.dn),
+		Expiration:             lapsEntry.ExpirationString(),
+		DN:                     lapsEntry.dn,
+		GUID:                   lapsEntry.guid,
+		Description:            lapsEntry.description,
+		OperatingSystem:        lapsEntry.os,
+		OperatingSystemVersion: lapsEntry.osversion,
+		RunID:                  runID,
+		Version:                version,
+		Commit:                 commit,
+		BuildDate:              buildDate,
+		attributes:             lapsEntry.attributes,
+	}
+}
+
+// apply writes tags and fields of the template into item, the category
+// is set by CreateOnPassEntryFromLapsEntry as it can't be changed later
+func (t *ItemTemplate) apply(item *onepassword.Item, lapsEntry LapsEntry) error {
+	for _, tag := range t.Tags {
+		setItemTag(item, tag, true)
+	}
+	data := newItemTemplateData(lapsEntry)
+	sectionLabels := map[string]string{}
+	for _, section := range t.Sections {
+		sectionLabels[section.ID] = section.Label
+	}
+	for _, field := range t.Fields {
+		var value bytes.Buffer
+		err := field.value.Execute(&value, data)
+		if err != nil {
+			return fmt.Errorf("item template field %s: %v", field.Label, err)
+		}
+		if field.Purpose != "" {
+			itemfield := getItemCredentialField(item, field.Purpose, field.Label)
+			itemfield.Label = field.Label
+			itemfield.Value = value.String()
+			continue
+		}
+		setItemSectionFields(item, field.Section, sectionLabels[field.Section], []itemField{
+			{label: field.Label, value: value.String(), fieldType: strings.ToUpper(field.Type)},
+		})
+	}
+	return nil
+}
+
+// itemCategories are the categories items can be created with
+var itemCategories = []onepassword.ItemCategory{
+	onepassword.Login, onepassword.Password, onepassword.Server, onepassword.Database,
+	onepassword.WirelessRouter, onepassword.ApiCredential, onepassword.SecureNote, onepassword.Custom,
+}
+
+// isItemCategory returns true if category is one of itemCategories
+func isItemCategory(category string) bool {
+	for _, c := range itemCategories {
+		if string(c) == strings.ToUpper(category) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetItemCategory returns the category of created items, the category of the
+// item template takes precedence over OP_ITEM_CATEGORY, defaults to LOGIN.
+// The category of existing items is never changed.
+func GetItemCategory() onepassword.ItemCategory {
+	category := os.Getenv("OP_ITEM_CATEGORY")
+	if itemTemplate != nil && itemTemplate.Category != "" {
+		category = itemTemplate.Category
+	}
+	if category == "" {
+		return onepassword.Login
+	}
+	return onepassword.ItemCategory(strings.ToUpper(category))
+}
+
+// ouOfDN returns the name of the first OU in dn
+func ouOfDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return ""
+	}
+	for _, rdn := range parsed.RDNs {
+		for _, attr := range rdn.Attributes {
+			if strings.EqualFold(attr.Type, "OU") {
+				return attr.Value
+			}
+		}
+	}
+	return ""
+}
+
+// defaultItemTags are set on synced items if OP_ITEM_TAGS is unset
+var defaultItemTags = []string{"laps", "auto-managed"}
+
+// GetItemTags returns the comma separated OP_ITEM_TAGS, which may contain
+// templates like {{.Domain}} or {{.OU}}
+func GetItemTags() []string {
+	if _, found := os.LookupEnv("OP_ITEM_TAGS"); !found {
+		return defaultItemTags
+	}
+	return getEnvList("OP_ITEM_TAGS", ",")
+}
+
+// renderTemplates renders the templates of the list environment variable
+// key for lapsEntry, empty results are skipped
+func renderTemplates(key string, templates []string, lapsEntry LapsEntry) ([]string, error) {
+	values := []string{}
+	data := newItemTemplateData(lapsEntry)
+	for _, text := range templates {
+		t, err := template.New(key).Parse(text)
+		if err != nil {
+			return values, err
+		}
+		var value bytes.Buffer
+		err = t.Execute(&value, data)
+		if err != nil {
+			return values, err
+		}
+		if value.Len() > 0 {
+			values = append(values, value.String())
+		}
+	}
+	return values, nil
+}
+
+// itemTags returns the rendered OP_ITEM_TAGS of lapsEntry
+func itemTags(lapsEntry LapsEntry) ([]string, error) {
+	return renderTemplates("OP_ITEM_TAGS", GetItemTags(), lapsEntry)
+}
+
+// setItemTags adds the OP_ITEM_TAGS of lapsEntry and the managedTag to item
+func setItemTags(item *onepassword.Item, lapsEntry LapsEntry) error {
+	tags, err := itemTags(lapsEntry)
+	if err != nil {
+		return fmt.Errorf("OP_ITEM_TAGS: %v", err)
+	}
+	for _, tag := range tags {
+		setItemTag(item, tag, true)
+	}
+	if !containsString(item.Tags, managedTag) {
+		setItemTag(item, managedTag, true)
+	}
+	return nil
+}
+
+// GetItemURLs returns the comma separated OP_ITEM_URLS templates, defaults
+// to a rdp:// url of the computer
+func GetItemURLs() []string {
+	if _, found := os.LookupEnv("OP_ITEM_URLS"); !found {
+		return []string{"rdp://{{.Hostname}}"}
+	}
+	return getEnvList("OP_ITEM_URLS", ",")
+}
+
+// itemURLs returns the rendered OP_ITEM_URLS of lapsEntry
+func itemURLs(lapsEntry LapsEntry) ([]string, error) {
+	return renderTemplates("OP_ITEM_URLS", GetItemURLs(), lapsEntry)
+}
+
+// setItemURLs adds the OP_ITEM_URLS of lapsEntry to item, the first one
+// becomes the primary url unless item already has one
+func setItemURLs(item *onepassword.Item, lapsEntry LapsEntry) error {
+	urls, err := itemURLs(lapsEntry)
+	if err != nil {
+		return fmt.Errorf("OP_ITEM_URLS: %v", err)
+	}
+	if item.Category == onepassword.Server && len(urls) > 0 {
+		// SERVER items show the built-in url field instead of the website urls
+		urlField := getItemCredentialField(item, "URL", "URL")
+		if urlField.Value == "" {
+			urlField.Value = urls[0]
+		}
+	}
+	primary := false
+	for _, itemurl := range item.URLs {
+		primary = primary || itemurl.Primary
+	}
+	for _, url := range urls {
+		found := false
+		for _, itemurl := range item.URLs {
+			found = found || itemurl.URL == url
+		}
+		if !found {
+			item.URLs = append(item.URLs, onepassword.ItemURL{URL: url, Primary: !primary})
+			primary = true
+		}
+	}
+	return nil
+}
+
+// GetItemNotes returns the OP_ITEM_NOTES template of the item notes
+func GetItemNotes() string {
+	return getEnv("OP_ITEM_NOTES", "{{.Action}} by laps2onepassword {{.Version}}{{with .Commit}} ({{.}}){{end}} on {{.Time}} from {{.Source}} LAPS")
+}
+
+// setItemNotes writes the rendered OP_ITEM_NOTES of lapsEntry into the
+// notes of item, action is Created or Updated
+func setItemNotes(item *onepassword.Item, lapsEntry LapsEntry, action string) error {
+	t, err := template.New("OP_ITEM_NOTES").Parse(strings.ReplaceAll(GetItemNotes(), `\n`, "\n"))
+	if err != nil {
+		return fmt.Errorf("OP_ITEM_NOTES: %v", err)
+	}
+	data := newItemTemplateData(lapsEntry)
+	data.Action = action
+	data.Time = time.Now().String()
+	var notes bytes.Buffer
+	err = t.Execute(&notes, data)
+	if err != nil {
+		return fmt.Errorf("OP_ITEM_NOTES: %v", err)
+	}
+	getItemFieldByPurpose(item, "NOTES", "notesPlain").Value = notes.String()
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of a run, they are only exported after
+// InitTracing installed a provider
+var tracer = otel.Tracer("laps2onepassword")
+
+// tracerProvider is set by InitTracing
+var tracerProvider *sdktrace.TracerProvider
+
+// IsTracingEnabled returns whether an OTLP endpoint is configured with
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+func IsTracingEnabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// InitTracing exports the spans with OTLP over HTTP. The exporter is
+// configured by the standard OTEL_EXPORTER_OTLP_* variables (endpoint,
+// headers, certificate, timeout), the service name defaults to
+// laps2onepassword and can be changed with OTEL_SERVICE_NAME.
+func InitTracing() error {
+	if !IsTracingEnabled() {
+		return nil
+	}
+	ctx := context.Background()
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", "laps2onepassword"),
+			attribute.String("service.version", version),
+		),
+		resource.WithFromEnv(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return err
+	}
+	tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tracerProvider)
+	log.Debug("InitTracing: Exporting spans to ", getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")))
+	return nil
+}
+
+// startRunSpan starts the root span of a run of command
+func startRunSpan(ctx context.Context, command string) (context.Context, trace.Span) {
+	if command == "" {
+		command = "sync"
+	}
+	return tracer.Start(ctx, command, trace.WithAttributes(
+		attribute.String("run.id", runID),
+		attribute.StringSlice("destinations", GetDestinations()),
+		attribute.Bool("dry_run", flag_dry_run),
+	))
+}
+
+// endRunSpan ends the root span of a run with its exit code and exports the
+// spans before the process exits
+func endRunSpan(span trace.Span, code int) {
+	span.SetAttributes(attribute.Int("exit_code", code))
+	if code != exitOK {
+		span.SetStatus(codes.Error, "exit code "+strconv.Itoa(code))
+	}
+	span.End()
+	if tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracerProvider.ForceFlush(ctx); err != nil {
+		log.Warn("endRunSpan: Can't export spans: ", err)
+	}
+}
+
+// endSpan ends span and records err
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// writeSpanName returns the span name of a write job, e.g. op.create for
+// an item created in 1Password or vault.update
+func writeSpanName(job writeJob) string {
+	prefix := job.destination
+	if prefix == destinationOnePassword {
+		prefix = "op"
+	}
+	action := strings.TrimSuffix(job.kind, "d") // created, updated, archived
+	return prefix + "." + action
+}
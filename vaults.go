@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/1Password/connect-sdk-go/connect"
+	"github.com/1Password/connect-sdk-go/onepassword"
+	log "github.com/sirupsen/logrus"
+)
+
+// VaultRoute sends computers whose DN or hostname matches pattern to vault
+type VaultRoute struct {
+	field   string // dn or host
+	pattern *regexp.Regexp
+	vault   string
+}
+
+// GetVaultRoutes parses the semicolon separated OP_VAULT_ROUTES. Each route
+// is <dn|host>:<case insensitive regular expression>=><vault title>, the
+// first matching route wins, other computers go to OP_VAULT_TITLE.
+func GetVaultRoutes() ([]VaultRoute, error) {
+	routes := []VaultRoute{}
+	for _, route := range getEnvList("OP_VAULT_ROUTES", ";") {
+		parts := strings.SplitN(route, "=>", 2)
+		fieldPattern := strings.SplitN(parts[0], ":", 2)
+		if len(parts) != 2 || len(fieldPattern) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return routes, fmt.Errorf("invalid route %s, expected <dn|host>:<pattern>=><vault>", route)
+		}
+		field := strings.ToLower(strings.TrimSpace(fieldPattern[0]))
+		if field != "dn" && field != "host" {
+			return routes, fmt.Errorf("invalid route %s, field must be dn or host", route)
+		}
+		pattern, err := regexp.Compile("(?i)" + fieldPattern[1])
+		if err != nil {
+			return routes, fmt.Errorf("invalid pattern in route %s: %v", route, err)
+		}
+		routes = append(routes, VaultRoute{field: field, pattern: pattern, vault: strings.TrimSpace(parts[1])})
+	}
+	return routes, nil
+}
+
+// defaultVault refers to the vault in OP_VAULT_ID or OP_VAULT_TITLE
+const defaultVault = ""
+
+// GetVaultTitleFor returns the title of the vault lapsEntry is synced to,
+// defaultVault if no route matches
+func GetVaultTitleFor(lapsEntry LapsEntry) string {
+	routes, _ := GetVaultRoutes()
+	for _, route := range routes {
+		value := lapsEntry.dn
+		if route.field == "host" {
+			value = lapsEntry.dnshostname
+		}
+		if route.pattern.MatchString(value) {
+			return route.vault
+		}
+	}
+	return defaultVault
+}
+
+// GetVaultTitles returns the titles of all destination vaults
+func GetVaultTitles() []string {
+	titles := []string{defaultVault}
+	routes, _ := GetVaultRoutes()
+	for _, route := range routes {
+		if !containsString(titles, route.vault) {
+			titles = append(titles, route.vault)
+		}
+	}
+	return titles
+}
+
+// vaultCache maps vault titles to vaults already looked up
+var vaultCache = map[string]onepassword.Vault{}
+
+// vaultCacheMutex guards vaultCache against concurrent writers
+var vaultCacheMutex sync.Mutex
+
+// getVault returns the vault with title, which must exist exactly once.
+// The defaultVault is looked up by OP_VAULT_ID if set, titles don't have to
+// be unique.
+func getVault(client connect.Client, title string) (onepassword.Vault, error) {
+	vaultCacheMutex.Lock()
+	defer vaultCacheMutex.Unlock()
+	key := title
+	if vault, found := vaultCache[key]; found {
+		return vault, nil
+	}
+	if title == defaultVault {
+		if id := os.Getenv("OP_VAULT_ID"); id != "" {
+			vault, err := client.GetVault(id)
+			if err != nil {
+				return onepassword.Vault{}, err
+			}
+			log.Debug("getVault: Found vault ", vault.Name, " ", vault.ID)
+			vaultCache[key] = *vault
+			return *vault, nil
+		}
+		title = os.Getenv("OP_VAULT_TITLE")
+	}
+	vaults, err := client.GetVaultsByTitle(title)
+	if err != nil {
+		return onepassword.Vault{}, err
+	}
+	if len(vaults) == 0 && getEnvBool("OP_VAULT_AUTOCREATE", false) {
+		vault, err := createVault(title)
+		if err != nil {
+			return onepassword.Vault{}, err
+		}
+		vaultCache[key] = vault
+		return vault, nil
+	}
+	if len(vaults) == 0 {
+		return onepassword.Vault{}, fmt.Errorf("vault %s not found", title)
+	} else if len(vaults) > 1 {
+		return onepassword.Vault{}, fmt.Errorf("vault %s found more than once", title)
+	}
+	log.Debug("getVault: Found vault ", vaults[0].Name, " ", vaults[0].ID)
+	vaultCache[key] = vaults[0]
+	return vaults[0], nil
+}
+
+// getVaultIDFor returns the id of the vault lapsEntry is synced to, the
+// vault must have been looked up by GetOnePassEntries before
+func getVaultIDFor(lapsEntry LapsEntry) string {
+	vaultCacheMutex.Lock()
+	defer vaultCacheMutex.Unlock()
+	return vaultCache[GetVaultTitleFor(lapsEntry)].ID
+}
+
+// createVault creates a vault with title, the Connect token needs
+// permission to create vaults. The SDK has no call for this.
+func createVault(title string) (onepassword.Vault, error) {
+	vault := onepassword.Vault{Name: title}
+	if GetOnePassBackend() != onePassBackendConnect {
+		return vault, fmt.Errorf("can't create vault %s, OP_VAULT_AUTOCREATE requires OP_BACKEND=connect", title)
+	}
+	if flag_dry_run {
+		printDryRun("+", "vault "+title)
+		return vault, nil
+	}
+	body, err := json.Marshal(map[string]string{"name": title, "description": "Created by laps2onepassword"})
+	if err != nil {
+		return vault, err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(os.Getenv("OP_CONNECT_HOST"), "/")+"/v1/vaults", bytes.NewReader(body))
+	if err != nil {
+		return vault, err
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("OP_CONNECT_TOKEN"))
+	req.Header.Set("Content-Type", "application/json")
+	client, err := getConnectHTTPClient()
+	if err != nil {
+		return vault, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return vault, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		message, _ := io.ReadAll(resp.Body)
+		return vault, fmt.Errorf("can't create vault %s: %s %s", title, resp.Status, strings.TrimSpace(string(message)))
+	}
+	err = json.NewDecoder(resp.Body).Decode(&vault)
+	if err != nil {
+		return vault, err
+	}
+	log.Info("createVault: Created vault ", vault.Name, " ", vault.ID)
+	return vault, nil
+}
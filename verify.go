@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/1Password/connect-sdk-go/onepassword"
+	log "github.com/sirupsen/logrus"
+)
+
+// Statuses of the verify report
+const (
+	verifyOK       = "ok"
+	verifyDrift    = "drift"
+	verifyMissing  = "missing"  // computer without item
+	verifyOrphaned = "orphaned" // managed item without computer
+)
+
+// verifyFields returns the differences of password, username and expiration
+// between onepassentry and lapsEntry, passwords are never shown
+func verifyFields(onepassentry onepassword.Item, lapsEntry LapsEntry) []string {
+	drift := []string{}
+	if getItemCredential(onepassentry, "PASSWORD") != lapsEntry.password {
+		drift = append(drift, "password")
+	}
+	if username := getItemCredential(onepassentry, "USERNAME"); username != lapsEntry.Username() {
+		drift = append(drift, fmt.Sprintf("username %q, expected %q", username, lapsEntry.Username()))
+	}
+	if expiration := getItemSectionValue(onepassentry, syncSectionID, "Password expires"); expiration != expirationDate(lapsEntry) {
+		drift = append(drift, fmt.Sprintf("expiration %q, expected %q", expiration, expirationDate(lapsEntry)))
+	}
+	return drift
+}
+
+// VerifyOnePassEntries compares every computer with its item without writing
+// and prints a report with the status of each item to stdout, with
+// --output json the statuses are items of the run result. Managed items
+// (with an objectGUID) without computer are reported as orphaned.
+// Returns the number of items which are not ok.
+func VerifyOnePassEntries(lapsentries []LapsEntry, onepassentries []onepassword.Item) int {
+	var out io.Writer = os.Stdout
+	if IsJSONOutput() {
+		out = io.Discard
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tITEM\tDETAILS")
+	matched := map[string]bool{}
+	counts := map[string]int{}
+	report := func(status string, title string, details ...string) {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", status, title, strings.Join(details, ", "))
+		summary.addItem(itemResult{Title: title, Destination: destinationOnePassword, Action: status, Details: details})
+		counts[status]++
+	}
+	for _, lapsentry := range lapsentries {
+		cur_op_idx, found := findOnePassEntry(lapsentry, onepassentries)
+		if !found {
+			report(verifyMissing, lapsentry.Title(), "no item for "+lapsentry.source+" LAPS computer")
+			continue
+		}
+		onepassentry := onepassentries[cur_op_idx]
+		matched[onepassentry.ID] = true
+		drift := verifyFields(onepassentry, lapsentry)
+		if len(drift) > 0 {
+			report(verifyDrift, onepassentry.Title, drift...)
+			continue
+		}
+		report(verifyOK, onepassentry.Title)
+	}
+	for _, onepassentry := range onepassentries {
+		if matched[onepassentry.ID] || getItemSectionValue(onepassentry, syncSectionID, "objectGUID") == "" || !syncHostFilter.MatchTitle(onepassentry.Title) {
+			continue
+		}
+		report(verifyOrphaned, onepassentry.Title, "no computer for managed item")
+	}
+	w.Flush()
+	log.Infof("VerifyOnePassEntries: Total ok=%d drift=%d missing=%d orphaned=%d", counts[verifyOK], counts[verifyDrift], counts[verifyMissing], counts[verifyOrphaned])
+	return counts[verifyDrift] + counts[verifyMissing] + counts[verifyOrphaned]
+}
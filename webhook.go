@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// webhookResponse is the json body of a POST /sync response
+type webhookResponse struct {
+	Host     string `json:"host,omitempty"`
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+}
+
+// isWebhookEnabled returns true if WEBHOOK_LISTEN is set
+func isWebhookEnabled() bool {
+	return os.Getenv("WEBHOOK_LISTEN") != ""
+}
+
+// webhookAuthorized returns true if r carries WEBHOOK_TOKEN as bearer token
+func webhookAuthorized(r *http.Request) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	expected := os.Getenv("WEBHOOK_TOKEN")
+	return found && expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// writeWebhookResponse writes response with status as json
+func writeWebhookResponse(w http.ResponseWriter, status int, response webhookResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleWebhookSync runs command for the computer in the host parameter
+// (all computers without it) and responds with its exit code, 409 if
+// another run is in progress
+func handleWebhookSync(ctx context.Context, command string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeWebhookResponse(w, http.StatusMethodNotAllowed, webhookResponse{ExitCode: 1, Error: "method not allowed"})
+			return
+		}
+		if !webhookAuthorized(r) {
+			log.Warn("handleWebhookSync: Unauthorized request from ", r.RemoteAddr)
+			writeWebhookResponse(w, http.StatusUnauthorized, webhookResponse{ExitCode: 1, Error: "unauthorized"})
+			return
+		}
+		host := strings.TrimSpace(r.FormValue("host"))
+		hosts := []string{}
+		if host != "" {
+			hosts = append(hosts, host)
+			log.Info("handleWebhookSync: Sync of ", host, " requested by ", r.RemoteAddr)
+		} else {
+			log.Info("handleWebhookSync: Sync requested by ", r.RemoteAddr)
+		}
+		code, ran := runSyncExclusive(ctx, command, hosts)
+		if !ran {
+			w.Header().Set("Retry-After", "60")
+			writeWebhookResponse(w, http.StatusConflict, webhookResponse{Host: host, ExitCode: 1, Error: "a run is in progress"})
+			return
+		}
+		status := http.StatusOK
+		if code != 0 {
+			status = http.StatusInternalServerError
+		}
+		writeWebhookResponse(w, status, webhookResponse{Host: host, ExitCode: code})
+	}
+}
+
+// startWebhook serves POST /sync on WEBHOOK_LISTEN, with TLS if
+// WEBHOOK_TLS_CERT and WEBHOOK_TLS_KEY are set, until ctx is cancelled
+func startWebhook(ctx context.Context, command string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sync", handleWebhookSync(ctx, command))
+	server := &http.Server{
+		Addr:              os.Getenv("WEBHOOK_LISTEN"),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		var err error
+		if cert := os.Getenv("WEBHOOK_TLS_CERT"); cert != "" {
+			log.Info("startWebhook: Listening on https://", server.Addr, "/sync")
+			err = server.ListenAndServeTLS(cert, os.Getenv("WEBHOOK_TLS_KEY"))
+		} else {
+			log.Info("startWebhook: Listening on http://", server.Addr, "/sync")
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("startWebhook: ", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// windowsLapsPassword represents the JSON structure stored by Windows LAPS
+// in the msLAPS-Password attribute
+type windowsLapsPassword struct {
+	Account   string `json:"n"` // name of the managed local account
+	Timestamp string `json:"t"` // hex encoded FILETIME of the last password update
+	Password  string `json:"p"`
+}
+
+// parseWindowsLapsPassword parses the JSON value of msLAPS-Password
+func parseWindowsLapsPassword(value string) (windowsLapsPassword, error) {
+	wlp := windowsLapsPassword{}
+	if value == "" {
+		return wlp, errors.New("empty msLAPS-Password value")
+	}
+	err := json.Unmarshal([]byte(value), &wlp)
+	if err != nil {
+		return wlp, err
+	}
+	if wlp.Password == "" {
+		return wlp, errors.New("msLAPS-Password contains no password")
+	}
+	return wlp, nil
+}
+
+// UpdateTime returns the password update timestamp of a Windows LAPS entry
+func (wlp windowsLapsPassword) UpdateTime() (time.Time, error) {
+	filetime, err := strconv.ParseInt(wlp.Timestamp, 16, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return getTimeFromFiletime(filetime), nil
+}
+
+// lapsHistoryEntry is a previous password read from the password history
+type lapsHistoryEntry struct {
+	password string
+	updated  time.Time
+}
+
+// parseWindowsLapsHistory decodes all values of the password history
+// attribute, encrypted values require a decryptor
+func parseWindowsLapsHistory(values [][]byte, decryptor LapsDecryptor) ([]lapsHistoryEntry, error) {
+	history := []lapsHistoryEntry{}
+	for _, value := range values {
+		var wlp windowsLapsPassword
+		var err error
+		if decryptor != nil {
+			wlp, err = decryptWindowsLapsPassword(decryptor, value)
+		} else {
+			wlp, err = parseWindowsLapsPassword(string(value))
+		}
+		if err != nil {
+			return history, err
+		}
+		updated, err := wlp.UpdateTime()
+		if err != nil {
+			return history, err
+		}
+		registerSecret(wlp.Password)
+		history = append(history, lapsHistoryEntry{password: wlp.Password, updated: updated})
+	}
+	return history, nil
+}
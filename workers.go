@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// writeJob is a single write of an item to 1Password or another destination
+type writeJob struct {
+	title       string
+	kind        string // created, updated, ...
+	destination string // for the audit log
+	vault       string
+	reason      string
+	entry       *LapsEntry // written entry, recorded in the state file
+	write       func() error
+}
+
+// writeResult is the outcome of a writeJob after all attempts
+type writeResult struct {
+	job      writeJob
+	attempts int
+	duration time.Duration // of all attempts
+	err      error
+}
+
+// GetWriteWorkers returns the number of concurrent 1Password writes (OP_WRITE_WORKERS)
+func GetWriteWorkers() int {
+	workers := getEnvInt("OP_WRITE_WORKERS", 1)
+	if workers < 1 {
+		return 1
+	}
+	return workers
+}
+
+// runWriteJobs runs jobs with GetWriteWorkers concurrent workers. A failed job
+// other than a create is retried OP_WRITE_RETRIES times after
+// OP_WRITE_RETRY_DELAY, further jobs are run even if one fails. Once ctx is
+// cancelled the jobs in progress are finished and the others fail with
+// errInterrupted. Returns the results in the order of jobs.
+func runWriteJobs(ctx context.Context, jobs []writeJob) []writeResult {
+	retries := getEnvInt("OP_WRITE_RETRIES", 2)
+	delay := getEnvDuration("OP_WRITE_RETRY_DELAY", time.Second)
+	results := make([]writeResult, len(jobs))
+	destination := ""
+	if len(jobs) > 0 {
+		destination = jobs[0].destination
+	}
+	p := startProgress("runWriteJobs", "writes to "+destination, len(jobs))
+	defer p.Stop()
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < GetWriteWorkers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer reportPanic()
+			for i := range indexes {
+				results[i] = runWriteJob(ctx, jobs[i], retries, delay)
+				p.add(1)
+			}
+		}()
+	}
+	for i := range jobs {
+		if ctx.Err() == nil {
+			select {
+			case indexes <- i:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		results[i] = writeResult{job: jobs[i], err: errInterrupted}
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// runWriteJob runs job and retries it up to retries times, not after ctx
+// is cancelled. A failed create isn't retried, it may have created the item
+// before failing and a second create would duplicate it; the next run finds
+// the item or creates it. A write exceeding OP_WRITE_TIMEOUT isn't retried
+// either, it may still complete.
+func runWriteJob(ctx context.Context, job writeJob, retries int, delay time.Duration) writeResult {
+	result := writeResult{job: job}
+	started := time.Now()
+	_, span := tracer.Start(ctx, writeSpanName(job), trace.WithAttributes(
+		attribute.String("item.title", job.title),
+		attribute.String("destination", job.destination),
+		attribute.String("vault", job.vault),
+		attribute.String("reason", job.reason),
+	))
+	defer func() {
+		result.duration = time.Since(started)
+		span.SetAttributes(attribute.Int("attempts", result.attempts))
+		endSpan(span, result.err)
+		reportItemError(job, result.err)
+	}()
+	for {
+		result.attempts++
+		result.err = writeWithTimeout(job.write)
+		if result.err == nil && job.entry != nil {
+			recordHostState(job.destination, *job.entry)
+		}
+		if result.err == nil || result.err == errWriteTimeout || job.kind == "created" || result.attempts > retries || ctx.Err() != nil {
+			writeAudit(job.kind, job.destination, job.vault, job.title, job.reason, result.err)
+			return result
+		}
+		log.Warnf("runWriteJob: %s failed (attempt %d of %d), retrying: %v", job.title, result.attempts, retries+1, result.err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			writeAudit(job.kind, job.destination, job.vault, job.title, job.reason, result.err)
+			return result
+		}
+	}
+}
+
+// writeErrors combines the errors of failed results into one error, nil if
+// all jobs succeeded or were interrupted
+func writeErrors(results []writeResult) error {
+	failed := []string{}
+	for _, result := range results {
+		if result.err != nil && result.err != errInterrupted {
+			failed = append(failed, fmt.Sprintf("%s: %v", result.job.title, result.err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d items failed: %s", len(failed), len(results), strings.Join(failed, "; "))
+}